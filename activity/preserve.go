@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package activity
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Runs f without counting its changes to reviews as activity.
+// Triggers on the review table record activity on the current day, so
+// activity from today onwards gets restored after f returns.
+// tx: transaction on a review DB
+func Preserve(tx *sql.Tx, f func() error) error {
+	today := time.Now().Unix() / 60 / 60 / 24
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS temp.activity_backup`); err != nil {
+		return fmt.Errorf("failed to back up activity: %v", err)
+	}
+	query := `
+		CREATE TEMP TABLE activity_backup AS
+		SELECT * FROM activity WHERE days_since_epoch >= ?
+	`
+	if _, err := tx.Exec(query, today); err != nil {
+		return fmt.Errorf("failed to back up activity: %v", err)
+	}
+
+	if err := f(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM activity WHERE days_since_epoch >= ?`, today); err != nil {
+		return fmt.Errorf("failed to restore activity: %v", err)
+	}
+	queries := []string{
+		`INSERT INTO activity SELECT * FROM temp.activity_backup`,
+		`DROP TABLE temp.activity_backup`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to restore activity: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Anki packages (.apkg).
+// An .apkg file is a zip file that contains an SQLite collection
+// (collection.anki2) and a JSON map of media files.
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Name of collection file inside .apkg files.
+const collectionName = "collection.anki2"
+
+// Note type.
+type Model struct {
+	Name   string
+	Fields []string
+
+	// Card templates, e.g. "{{Word}}".
+	Front string
+	Back  string
+	CSS   string
+}
+
+// Scheduling info of a card.
+// Cards with zero Due are new.
+type Card struct {
+	Due      time.Time
+	Interval time.Duration
+	Reps     int
+}
+
+func (c Card) isNew() bool {
+	return c.Due.IsZero()
+}
+
+type Note struct {
+	// HTML of fields, in the same order as in the model.
+	Fields []string
+
+	// Tags can't contain spaces.
+	Tags []string
+
+	Card Card
+}
+
+type Deck struct {
+	Name        string
+	Description string
+	Model       Model
+	Notes       []Note
+}
+
+type object = map[string]any
+
+// Derives ID from name, so that importing the same deck again updates it
+// instead of creating a copy.
+// IDs fit in 52 bits, because Anki's frontend uses JavaScript numbers.
+func stableID(name string) int64 {
+	sum := sha1.Sum([]byte(name))
+	return int64(binary.BigEndian.Uint64(sum[:8]) >> 12)
+}
+
+// Derives note GUID from the deck and the first field of the note.
+func noteGUID(deck Deck, note Note) string {
+	sum := sha1.Sum([]byte(deck.Name + "\x1f" + note.Fields[0]))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
+
+var (
+	tagPattern   = regexp.MustCompile(`<[^>]*>`)
+	soundPattern = regexp.MustCompile(`\[sound:[^\]]*\]`)
+)
+
+// Converts field to plain text.
+// Removes HTML tags and sound references.
+func StripHTML(field string) string {
+	field = soundPattern.ReplaceAllString(field, "")
+	return html.UnescapeString(tagPattern.ReplaceAllString(field, ""))
+}
+
+// Computes checksum that Anki uses to find duplicate notes.
+func checksum(field string) int64 {
+	sum := sha1.Sum([]byte(StripHTML(field)))
+	n, err := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	var cleaned []string
+	for _, tag := range tags {
+		cleaned = append(cleaned, strings.ReplaceAll(tag, " ", "_"))
+	}
+	return " " + strings.Join(cleaned, " ") + " "
+}
+
+// Returns start of day in the same location.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// Returns interval in days.
+// Anki can't schedule review cards less than a day apart.
+func intervalDays(interval time.Duration) int {
+	days := int(math.Round(interval.Hours() / 24))
+	if days < 1 {
+		return 1
+	}
+	return days
+}
+
+func (d Deck) check() error {
+	if d.Name == "" {
+		return fmt.Errorf("deck has no name")
+	}
+	if len(d.Model.Fields) == 0 {
+		return fmt.Errorf("model has no fields")
+	}
+	for i, note := range d.Notes {
+		if len(note.Fields) != len(d.Model.Fields) {
+			return fmt.Errorf("note %v has %v fields, expected %v", i, len(note.Fields), len(d.Model.Fields))
+		}
+	}
+	return nil
+}
+
+func (d Deck) modelsJSON(modelID, deckID, mod int64) (string, error) {
+	var fields []object
+	for i, name := range d.Model.Fields {
+		fields = append(fields, object{
+			"name":   name,
+			"ord":    i,
+			"sticky": false,
+			"rtl":    false,
+			"font":   "Arial",
+			"size":   20,
+			"media":  []string{},
+		})
+	}
+	model := object{
+		"id":    modelID,
+		"name":  d.Model.Name,
+		"type":  0,
+		"mod":   mod,
+		"usn":   -1,
+		"sortf": 0,
+		"did":   deckID,
+		"tmpls": []object{{
+			"name":  "Card 1",
+			"ord":   0,
+			"qfmt":  d.Model.Front,
+			"afmt":  d.Model.Back,
+			"did":   nil,
+			"bqfmt": "",
+			"bafmt": "",
+		}},
+		"flds":      fields,
+		"css":       d.Model.CSS,
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"tags":      []string{},
+		"vers":      []string{},
+		"req":       []any{[]any{0, "any", []int{0}}},
+	}
+	bytes, err := json.Marshal(object{fmt.Sprint(modelID): model})
+	return string(bytes), err
+}
+
+func deckJSON(id int64, name, description string, mod int64) object {
+	return object{
+		"id":               id,
+		"name":             name,
+		"desc":             description,
+		"mod":              mod,
+		"usn":              -1,
+		"collapsed":        false,
+		"browserCollapsed": false,
+		"newToday":         []int{0, 0},
+		"revToday":         []int{0, 0},
+		"lrnToday":         []int{0, 0},
+		"timeToday":        []int{0, 0},
+		"dyn":              0,
+		"conf":             1,
+		"extendNew":        0,
+		"extendRev":        0,
+	}
+}
+
+func (d Deck) decksJSON(deckID, mod int64) (string, error) {
+	bytes, err := json.Marshal(object{
+		"1":                deckJSON(1, "Default", "", mod),
+		fmt.Sprint(deckID): deckJSON(deckID, d.Name, d.Description, mod),
+	})
+	return string(bytes), err
+}
+
+// Writes deck into new collection.
+func (d Deck) writeCollection(db *sql.DB, now time.Time) error {
+	mod := now.Unix()
+	crt := startOfDay(now)
+	modelID := stableID("model:" + d.Model.Name)
+	deckID := stableID("deck:" + d.Name)
+
+	models, err := d.modelsJSON(modelID, deckID, mod)
+	if err != nil {
+		return err
+	}
+	decks, err := d.decksJSON(deckID, mod)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO col (id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags)
+		VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')
+	`
+	_, err = tx.Exec(query, crt.Unix(), now.UnixMilli(), now.UnixMilli(), collectionConf, models, decks, deckConf)
+	if err != nil {
+		return err
+	}
+
+	insertNote := `
+		INSERT INTO notes (id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data)
+		VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')
+	`
+	insertCard := `
+		INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+		VALUES (?, ?, ?, 0, ?, -1, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, 0, '')
+	`
+
+	// Note and card IDs are creation times in milliseconds.
+	base := now.UnixMilli()
+	for i, note := range d.Notes {
+		id := base + int64(i)
+		first := note.Fields[0]
+		_, err := tx.Exec(
+			insertNote,
+			id,
+			noteGUID(d, note),
+			modelID,
+			mod,
+			formatTags(note.Tags),
+			strings.Join(note.Fields, "\x1f"),
+			StripHTML(first),
+			checksum(first),
+		)
+		if err != nil {
+			return err
+		}
+
+		// New cards are due in the order they were added.
+		cardType, queue, due, ivl, factor := 0, 0, int64(i+1), 0, 0
+		if !note.Card.isNew() {
+			cardType, queue, factor = 2, 2, 2500
+			due = int64(math.Floor(note.Card.Due.Sub(crt).Hours() / 24))
+			ivl = intervalDays(note.Card.Interval)
+		}
+		_, err = tx.Exec(insertCard, id, id, deckID, mod, cardType, queue, due, ivl, factor, note.Card.Reps)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Writes deck as .apkg file.
+func WriteAPKG(w io.Writer, deck Deck) error {
+	return writeAPKGAt(w, deck, time.Now())
+}
+
+func writeAPKGAt(w io.Writer, deck Deck, now time.Time) error {
+	if err := deck.check(); err != nil {
+		return fmt.Errorf("invalid deck: %v", err)
+	}
+
+	// The SQLite driver can only write collections to files.
+	f, err := os.CreateTemp("", "polycloze-*.anki2")
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+	if err := deck.writeCollection(db, now); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+
+	collection, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+	defer collection.Close()
+
+	zw := zip.NewWriter(w)
+	cw, err := zw.Create(collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if _, err := io.Copy(cw, collection); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+
+	// The deck has no media files.
+	mw, err := zw.Create("media")
+	if err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if _, err := io.WriteString(mw, "{}"); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDeck() Deck {
+	return Deck{
+		Name: "polycloze::spa",
+		Model: Model{
+			Name:   "polycloze",
+			Fields: []string{"Word", "Sentence"},
+			Front:  "{{Word}}",
+			Back:   "{{FrontSide}}<hr id=answer>{{Sentence}}",
+		},
+		Notes: []Note{
+			{Fields: []string{"hola", "¡Hola!"}, Tags: []string{"polycloze"}},
+			{
+				Fields: []string{"mundo", "Hola, mundo."},
+				Card: Card{
+					Due:      time.Date(2022, 10, 13, 12, 0, 0, 0, time.UTC),
+					Interval: 72 * time.Hour,
+					Reps:     3,
+				},
+			},
+		},
+	}
+}
+
+// Extracts collection from .apkg file.
+func openPackage(t *testing.T, body []byte) *sql.DB {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var collection []byte
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		contents, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+
+		switch f.Name {
+		case collectionName:
+			collection = contents
+		case "media":
+			if string(contents) != "{}" {
+				t.Fatal("expected empty media map:", string(contents))
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), collectionName)
+	if err := os.WriteFile(path, collection, 0o644); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return db
+}
+
+func TestWriteAPKG(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 10, 10, 8, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := writeAPKGAt(&buf, testDeck(), now); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	db := openPackage(t, buf.Bytes())
+	defer db.Close()
+
+	var models, decks string
+	if err := db.QueryRow(`SELECT models, decks FROM col`).Scan(&models, &decks); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !strings.Contains(models, `"polycloze"`) || !strings.Contains(decks, `"polycloze::spa"`) {
+		t.Fatal("expected model and deck in collection:", models, decks)
+	}
+
+	query := `
+		SELECT flds, tags, type, queue, due, ivl, reps FROM notes
+		JOIN cards ON (notes.id = cards.nid)
+		ORDER BY notes.id
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer rows.Close()
+
+	type row struct {
+		fields, tags                    string
+		cardType, queue, due, ivl, reps int
+	}
+	var results []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.fields, &r.tags, &r.cardType, &r.queue, &r.due, &r.ivl, &r.reps); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		results = append(results, r)
+	}
+
+	expected := []row{
+		{"hola\x1f¡Hola!", " polycloze ", 0, 0, 1, 0, 0},
+		{"mundo\x1fHola, mundo.", "", 2, 2, 3, 3, 3},
+	}
+	if len(results) != len(expected) {
+		t.Fatal("expected one card per note:", results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatal("unexpected note:", results[i], expected[i])
+		}
+	}
+}
+
+func TestWriteAPKGStableIDs(t *testing.T) {
+	// Exporting again should produce the same GUIDs, so that Anki updates
+	// notes instead of duplicating them.
+	t.Parallel()
+
+	deck := testDeck()
+	a := noteGUID(deck, deck.Notes[0])
+	b := noteGUID(deck, Note{Fields: []string{"hola", "Otra frase."}})
+	if a != b {
+		t.Fatal("expected GUID to only depend on the first field:", a, b)
+	}
+	if stableID("deck:a") != stableID("deck:a") || stableID("deck:a") >= 1<<52 {
+		t.Fatal("expected stable 52-bit IDs")
+	}
+}
+
+func TestWriteAPKGInvalidDeck(t *testing.T) {
+	t.Parallel()
+
+	deck := testDeck()
+	deck.Notes = append(deck.Notes, Note{Fields: []string{"only one field"}})
+	if err := WriteAPKG(io.Discard, deck); err == nil {
+		t.Fatal("expected error for note with wrong number of fields")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	if checksum("<b>hola</b>") != checksum("hola") {
+		t.Fatal("expected checksum to ignore HTML")
+	}
+	// First 8 hex digits of sha1("hola").
+	if checksum("hola") != 0x99800b85 {
+		t.Fatal("unexpected checksum:", checksum("hola"))
+	}
+}
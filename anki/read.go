@@ -0,0 +1,293 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Collection files in .apkg files, most preferred first.
+// Recent versions of Anki also put a placeholder collection.anki2 that only
+// asks the user to upgrade Anki.
+var collectionNames = []string{"collection.anki21", collectionName}
+
+// Newer collections are compressed with zstd.
+const compressedCollectionName = "collection.anki21b"
+
+var ErrUnsupportedPackage = errors.New("unsupported package: export the deck from Anki with \"Support older Anki versions\" checked")
+
+// Note read from a collection.
+type StoredNote struct {
+	ID    int64
+	Model string // Name of note type
+
+	// Field HTML by field name.
+	Fields map[string]string
+
+	// Names of fields, in order.
+	FieldNames []string
+	Tags       []string
+}
+
+// Entry in the review log.
+type Review struct {
+	Time   time.Time
+	NoteID int64
+	Ease   int // 1 (again) to 4 (easy), 0 for manual reschedules (see Collection.SchedulerVersion)
+	Type   int // 0 (learn), 1 (review), 2 (relearn), 3 (filtered deck), 4 (manual)
+}
+
+// Review types.
+const (
+	ReviewLearn = iota
+	ReviewReview
+	ReviewRelearn
+	ReviewFiltered
+	ReviewManual
+)
+
+// Checks if the answer was correct.
+func (r Review) Correct() bool {
+	return r.Ease > 1
+}
+
+type Collection struct {
+	Notes   []StoredNote
+	Reviews []Review // Oldest first
+
+	// Version of the scheduler (1 if not set).
+	// The v1 scheduler only has three buttons for cards in learning.
+	SchedulerVersion int
+}
+
+// Note type as stored in the col table.
+type storedModel struct {
+	Name   string `json:"name"`
+	Fields []struct {
+		Name string `json:"name"`
+		Ord  int    `json:"ord"`
+	} `json:"flds"`
+}
+
+// Returns names of fields, in order.
+func (m storedModel) fieldNames() []string {
+	fields := append(m.Fields[:0:0], m.Fields...)
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Ord < fields[j].Ord
+	})
+
+	var names []string
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+func readModels(db *sql.DB) (map[int64]storedModel, error) {
+	var models string
+	if err := db.QueryRow(`SELECT models FROM col`).Scan(&models); err != nil {
+		return nil, err
+	}
+
+	var byID map[string]storedModel
+	if err := json.Unmarshal([]byte(models), &byID); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]storedModel)
+	for key, model := range byID {
+		var id int64
+		if _, err := fmt.Sscan(key, &id); err != nil {
+			return nil, fmt.Errorf("invalid model ID: %v", key)
+		}
+		result[id] = model
+	}
+	return result, nil
+}
+
+func readNotes(db *sql.DB, models map[int64]storedModel) ([]StoredNote, error) {
+	rows, err := db.Query(`SELECT id, mid, tags, flds FROM notes ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []StoredNote
+	for rows.Next() {
+		var note StoredNote
+		var mid int64
+		var tags, fields string
+		if err := rows.Scan(&note.ID, &mid, &tags, &fields); err != nil {
+			return nil, err
+		}
+
+		model, ok := models[mid]
+		if !ok {
+			return nil, fmt.Errorf("note %v has unknown model: %v", note.ID, mid)
+		}
+		note.Model = model.Name
+		note.FieldNames = model.fieldNames()
+		note.Tags = strings.Fields(tags)
+		note.Fields = make(map[string]string)
+		for i, value := range strings.Split(fields, "\x1f") {
+			if i < len(note.FieldNames) {
+				note.Fields[note.FieldNames[i]] = value
+			}
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// Returns scheduler version of collection.
+// Newer versions of Anki keep it in the config table instead of col.conf.
+func readSchedulerVersion(db *sql.DB) (int, error) {
+	var value []byte
+	err := db.QueryRow(`SELECT val FROM config WHERE key = 'schedVer'`).Scan(&value)
+	if err == nil {
+		var version int
+		if err := json.Unmarshal(value, &version); err != nil {
+			return 0, fmt.Errorf("invalid scheduler version: %v", err)
+		}
+		return version, nil
+	}
+	// Older collections don't have a config table.
+
+	var conf string
+	if err := db.QueryRow(`SELECT conf FROM col`).Scan(&conf); err != nil {
+		return 0, err
+	}
+	var parsed struct {
+		SchedulerVersion int `json:"schedVer"`
+	}
+	if conf != "" {
+		if err := json.Unmarshal([]byte(conf), &parsed); err != nil {
+			return 0, fmt.Errorf("invalid collection config: %v", err)
+		}
+	}
+	if parsed.SchedulerVersion == 0 {
+		return 1, nil
+	}
+	return parsed.SchedulerVersion, nil
+}
+
+func readReviews(db *sql.DB) ([]Review, error) {
+	// Revlog IDs are review times in milliseconds.
+	query := `
+		SELECT revlog.id, cards.nid, revlog.ease, revlog.type
+		FROM revlog JOIN cards ON (revlog.cid = cards.id)
+		ORDER BY revlog.id
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []Review
+	for rows.Next() {
+		var review Review
+		var id int64
+		if err := rows.Scan(&id, &review.NoteID, &review.Ease, &review.Type); err != nil {
+			return nil, err
+		}
+		review.Time = time.UnixMilli(id).UTC()
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// Reads notes and review log from collection file (collection.anki2).
+func ReadCollection(path string) (Collection, error) {
+	var collection Collection
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return collection, fmt.Errorf("failed to read collection: %v", err)
+	}
+	defer db.Close()
+
+	models, err := readModels(db)
+	if err != nil {
+		return collection, fmt.Errorf("failed to read collection: %v", err)
+	}
+	if collection.Notes, err = readNotes(db, models); err != nil {
+		return collection, fmt.Errorf("failed to read collection: %v", err)
+	}
+	if collection.Reviews, err = readReviews(db); err != nil {
+		return collection, fmt.Errorf("failed to read collection: %v", err)
+	}
+	if collection.SchedulerVersion, err = readSchedulerVersion(db); err != nil {
+		return collection, fmt.Errorf("failed to read collection: %v", err)
+	}
+	return collection, nil
+}
+
+// Reads collection in .apkg file.
+func ReadAPKG(path string) (Collection, error) {
+	var collection Collection
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return collection, fmt.Errorf("failed to read package: %v", err)
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var file *zip.File
+	for _, name := range collectionNames {
+		if f, ok := files[name]; ok {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		if _, ok := files[compressedCollectionName]; ok {
+			return collection, ErrUnsupportedPackage
+		}
+		return collection, fmt.Errorf("failed to read package: no collection in %v", path)
+	}
+
+	// The SQLite driver can only read collections from files.
+	tmp, err := os.CreateTemp("", "polycloze-*.anki2")
+	if err != nil {
+		return collection, fmt.Errorf("failed to read package: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	rc, err := file.Open()
+	if err != nil {
+		return collection, fmt.Errorf("failed to read package: %v", err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(tmp, rc); err != nil {
+		return collection, fmt.Errorf("failed to read package: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return collection, fmt.Errorf("failed to read package: %v", err)
+	}
+	return ReadCollection(tmp.Name())
+}
+
+// Reads .apkg or collection file.
+func Read(path string) (Collection, error) {
+	if strings.HasSuffix(path, ".apkg") {
+		return ReadAPKG(path)
+	}
+	return ReadCollection(path)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadAPKG(t *testing.T) {
+	// Should be able to read exported decks.
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := WriteAPKG(f, testDeck()); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	f.Close()
+
+	collection, err := Read(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(collection.Notes) != 2 || len(collection.Reviews) != 0 {
+		t.Fatal("expected two notes and no reviews:", collection)
+	}
+
+	note := collection.Notes[0]
+	if note.Model != "polycloze" || note.FieldNames[0] != "Word" || note.FieldNames[1] != "Sentence" {
+		t.Fatal("unexpected model:", note)
+	}
+	if note.Fields["Word"] != "hola" || note.Fields["Sentence"] != "¡Hola!" {
+		t.Fatal("unexpected fields:", note.Fields)
+	}
+	if len(note.Tags) != 1 || note.Tags[0] != "polycloze" {
+		t.Fatal("unexpected tags:", note.Tags)
+	}
+}
+
+func TestReadCollectionReviews(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), collectionName)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	now := time.Date(2022, 10, 10, 8, 0, 0, 0, time.UTC)
+	if err := testDeck().writeCollection(db, now); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Card IDs are the same as note IDs in written collections.
+	id := now.UnixMilli() + 1
+	query := `
+		INSERT INTO revlog (id, cid, usn, ease, ivl, lastIvl, factor, time, type) VALUES
+		(?, ?, -1, 3, 1, 0, 2500, 5000, 1),
+		(?, ?, -1, 1, 0, 1, 2500, 5000, 1)
+	`
+	later := now.Add(24 * time.Hour).UnixMilli()
+	if _, err := db.Exec(query, later, id, now.UnixMilli(), id); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	db.Close()
+
+	collection, err := ReadCollection(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	reviews := collection.Reviews
+	if len(reviews) != 2 {
+		t.Fatal("expected two reviews:", reviews)
+	}
+	if !reviews[0].Time.Equal(now) || reviews[0].Correct() || reviews[0].NoteID != id {
+		t.Fatal("expected oldest review first:", reviews[0])
+	}
+	if !reviews[1].Correct() || reviews[1].Type != ReviewReview {
+		t.Fatal("unexpected review:", reviews[1])
+	}
+	if collection.SchedulerVersion != 1 {
+		t.Fatal("expected v1 scheduler if the config doesn't say otherwise:", collection.SchedulerVersion)
+	}
+}
+
+func TestReadCollectionSchedulerVersion(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), collectionName)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := testDeck().writeCollection(db, time.Now()); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := db.Exec(`UPDATE col SET conf = '{"schedVer": 2}'`); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	db.Close()
+
+	collection, err := ReadCollection(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if collection.SchedulerVersion != 2 {
+		t.Fatal("expected scheduler version from col.conf:", collection.SchedulerVersion)
+	}
+}
+
+func TestReadCompressedAPKG(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	zw := zip.NewWriter(f)
+	if _, err := zw.Create(compressedCollectionName); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	zw.Close()
+	f.Close()
+
+	if _, err := ReadAPKG(path); !errors.Is(err, ErrUnsupportedPackage) {
+		t.Fatal("expected ErrUnsupportedPackage:", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package anki
+
+// Schema of Anki 2.1 legacy collections (version 11).
+// Newer versions of Anki upgrade these collections on import.
+const schema = `
+CREATE TABLE col (
+	id integer primary key,
+	crt integer not null,
+	mod integer not null,
+	scm integer not null,
+	ver integer not null,
+	dty integer not null,
+	usn integer not null,
+	ls integer not null,
+	conf text not null,
+	models text not null,
+	decks text not null,
+	dconf text not null,
+	tags text not null
+);
+CREATE TABLE notes (
+	id integer primary key,
+	guid text not null,
+	mid integer not null,
+	mod integer not null,
+	usn integer not null,
+	tags text not null,
+	flds text not null,
+	sfld integer not null,
+	csum integer not null,
+	flags integer not null,
+	data text not null
+);
+CREATE TABLE cards (
+	id integer primary key,
+	nid integer not null,
+	did integer not null,
+	ord integer not null,
+	mod integer not null,
+	usn integer not null,
+	type integer not null,
+	queue integer not null,
+	due integer not null,
+	ivl integer not null,
+	factor integer not null,
+	reps integer not null,
+	lapses integer not null,
+	left integer not null,
+	odue integer not null,
+	odid integer not null,
+	flags integer not null,
+	data text not null
+);
+CREATE TABLE revlog (
+	id integer primary key,
+	cid integer not null,
+	usn integer not null,
+	ease integer not null,
+	ivl integer not null,
+	lastIvl integer not null,
+	factor integer not null,
+	time integer not null,
+	type integer not null
+);
+CREATE TABLE graves (
+	usn integer not null,
+	oid integer not null,
+	type integer not null
+);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+// Collection config.
+const collectionConf = `{
+	"activeDecks": [1],
+	"curDeck": 1,
+	"newSpread": 0,
+	"collapseTime": 1200,
+	"timeLim": 0,
+	"estTimes": true,
+	"dueCounts": true,
+	"curModel": null,
+	"nextPos": 1,
+	"sortType": "noteFld",
+	"sortBackwards": false,
+	"addToCur": true
+}`
+
+// Default deck options.
+const deckConf = `{
+	"1": {
+		"id": 1,
+		"name": "Default",
+		"mod": 0,
+		"usn": 0,
+		"maxTaken": 60,
+		"autoplay": true,
+		"timer": 0,
+		"replayq": true,
+		"dyn": false,
+		"new": {
+			"bury": true,
+			"delays": [1, 10],
+			"initialFactor": 2500,
+			"ints": [1, 4, 7],
+			"order": 1,
+			"perDay": 20,
+			"separate": true
+		},
+		"lapse": {
+			"delays": [10],
+			"leechAction": 0,
+			"leechFails": 8,
+			"minInt": 1,
+			"mult": 0
+		},
+		"rev": {
+			"bury": true,
+			"ease4": 1.3,
+			"fuzz": 0.05,
+			"ivlFct": 1,
+			"maxIvl": 36500,
+			"minSpace": 1,
+			"perDay": 100
+		}
+	}
+}`
@@ -0,0 +1,164 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Imports review history from Anki.
+package anki_import
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lggruspe/polycloze/activity"
+	"github.com/lggruspe/polycloze/anki"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/logger"
+	"github.com/lggruspe/polycloze/replay"
+	rs "github.com/lggruspe/polycloze/review_scheduler"
+	"github.com/lggruspe/polycloze/text"
+)
+
+type Mapping struct {
+	NoteID int64
+	Field  string // Plain text of note field
+	Word   string // Word in the course
+}
+
+type Plan struct {
+	Mappings []Mapping
+
+	// Plain text of note fields that don't match any word in the course.
+	Unmapped []string
+
+	// Words that already have reviews.
+	// Their history in Anki gets ignored, so that imports don't undo newer
+	// reviews.
+	Skipped []string
+
+	// Reviews of mapped words, oldest first.
+	Events []logger.LogEvent
+}
+
+// Returns word in course that matches note field, or an empty string.
+func findWord[T database.Querier](q T, field string) (string, error) {
+	var word string
+	query := `SELECT word FROM word WHERE word = ?`
+	err := q.QueryRow(query, text.Casefold(strings.TrimSpace(field))).Scan(&word)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return word, err
+}
+
+func hasReview[T database.Querier](q T, word string) (bool, error) {
+	var n int
+	err := q.QueryRow(`SELECT count(*) FROM review WHERE item = ?`, word).Scan(&n)
+	return n > 0, err
+}
+
+// Returns plain text of field that contains the word.
+// If field is empty, uses the first field of the note.
+func noteField(note anki.StoredNote, field string) (string, bool) {
+	if field == "" {
+		if len(note.FieldNames) == 0 {
+			return "", false
+		}
+		field = note.FieldNames[0]
+	}
+	value, ok := note.Fields[field]
+	return anki.StripHTML(value), ok
+}
+
+// Converts Anki ease into grade.
+// Cards in learning only have again (1), good (2) and easy (3) buttons in the
+// v1 scheduler. Otherwise, there's also hard, so ease goes from again (1) to
+// easy (4).
+func grade(review anki.Review, schedulerVersion int) rs.Grade {
+	ease := review.Ease
+	learning := review.Type == anki.ReviewLearn || review.Type == anki.ReviewRelearn
+	if schedulerVersion < 2 && learning && ease > 1 {
+		// Skip hard.
+		ease++
+	}
+	if ease > 4 {
+		return rs.Easy
+	}
+	return rs.Grade(ease - 1)
+}
+
+// Maps notes in the collection to words in the course, and converts the
+// reviews of mapped notes into log events.
+// field: name of the note field that contains the word (first field if empty)
+// q should be a connection to a review DB with the course attached.
+func MakePlan[T database.Querier](q T, collection anki.Collection, field string) (Plan, error) {
+	var plan Plan
+
+	words := make(map[int64]string)
+	skipped := make(map[string]bool)
+	for _, note := range collection.Notes {
+		value, ok := noteField(note, field)
+		if !ok {
+			continue
+		}
+
+		word, err := findWord(q, value)
+		if err != nil {
+			return plan, fmt.Errorf("failed to make import plan: %v", err)
+		}
+		if word == "" {
+			plan.Unmapped = append(plan.Unmapped, value)
+			continue
+		}
+
+		reviewed, err := hasReview(q, word)
+		if err != nil {
+			return plan, fmt.Errorf("failed to make import plan: %v", err)
+		}
+		if reviewed {
+			if !skipped[word] {
+				skipped[word] = true
+				plan.Skipped = append(plan.Skipped, word)
+			}
+			continue
+		}
+		words[note.ID] = word
+		plan.Mappings = append(plan.Mappings, Mapping{NoteID: note.ID, Field: value, Word: word})
+	}
+
+	for _, review := range collection.Reviews {
+		word, ok := words[review.NoteID]
+		if !ok || review.Type == anki.ReviewManual || review.Ease == 0 {
+			continue
+		}
+		plan.Events = append(plan.Events, logger.LogEvent{
+			Correct:   review.Correct(),
+			Timestamp: review.Time,
+			Word:      word,
+			Grade:     grade(review, collection.SchedulerVersion).String(),
+		})
+	}
+
+	// Reviews should already be sorted, but replaying them out of order would
+	// give wrong intervals.
+	sort.SliceStable(plan.Events, func(i, j int) bool {
+		return plan.Events[i].Timestamp.Before(plan.Events[j].Timestamp)
+	})
+	return plan, nil
+}
+
+// Replays reviews in the plan.
+// Either all reviews get imported or none of them do.
+// Imported reviews aren't counted as today's activity.
+func Apply(c *database.Connection, plan Plan) error {
+	err := database.InTransaction(c, func(tx *sql.Tx) error {
+		return activity.Preserve(tx, func() error {
+			return replay.Replay(tx, plan.Events)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import reviews: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package anki_import
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lggruspe/polycloze/anki"
+	"github.com/lggruspe/polycloze/database"
+	rs "github.com/lggruspe/polycloze/review_scheduler"
+	"github.com/lggruspe/polycloze/utils"
+	ws "github.com/lggruspe/polycloze/word_scheduler"
+)
+
+func exec(t *testing.T, db *sql.DB, queries ...string) {
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+}
+
+func note(id int64, front string) anki.StoredNote {
+	return anki.StoredNote{
+		ID:         id,
+		Model:      "Basic",
+		FieldNames: []string{"Front", "Back"},
+		Fields:     map[string]string{"Front": front, "Back": ""},
+	}
+}
+
+func testCollection(start time.Time) anki.Collection {
+	day := 24 * time.Hour
+	return anki.Collection{
+		Notes: []anki.StoredNote{
+			note(1, "<b>Hola</b>&nbsp;"),
+			note(2, "perro"),
+			note(3, "casa"),
+		},
+		Reviews: []anki.Review{
+			{Time: start, NoteID: 1, Ease: 1, Type: anki.ReviewLearn},
+			{Time: start.Add(time.Minute), NoteID: 1, Ease: 3, Type: anki.ReviewLearn},
+			{Time: start.Add(2 * day), NoteID: 1, Ease: 0, Type: anki.ReviewManual},
+			{Time: start.Add(3 * day), NoteID: 1, Ease: 3, Type: anki.ReviewReview},
+			{Time: start.Add(3 * day), NoteID: 3, Ease: 3, Type: anki.ReviewReview},
+		},
+	}
+}
+
+func TestMakePlan(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0), ('casa', 0)`)
+	if err := ws.UpdateWord(db, "casa", rs.Good); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	plan, err := MakePlan(db, testCollection(start), "")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if len(plan.Mappings) != 1 || plan.Mappings[0].Word != "hola" || plan.Mappings[0].NoteID != 1 {
+		t.Fatal("expected Hola to be mapped to hola:", plan.Mappings)
+	}
+	if len(plan.Unmapped) != 1 || plan.Unmapped[0] != "perro" {
+		t.Fatal("expected perro to be unmapped:", plan.Unmapped)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0] != "casa" {
+		t.Fatal("expected casa to be skipped:", plan.Skipped)
+	}
+
+	// Manual reschedules aren't reviews.
+	if len(plan.Events) != 3 {
+		t.Fatal("expected three events:", plan.Events)
+	}
+	if plan.Events[0].Correct || !plan.Events[1].Correct || !plan.Events[2].Timestamp.Equal(start.Add(72*time.Hour)) {
+		t.Fatal("unexpected events:", plan.Events)
+	}
+}
+
+func TestMakePlanGrades(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0)`)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	collection := testCollection(start)
+	collection.Reviews = nil
+	for ease := 1; ease <= 4; ease++ {
+		collection.Reviews = append(collection.Reviews, anki.Review{
+			Time:   start.Add(time.Duration(ease) * time.Hour),
+			NoteID: 1,
+			Ease:   ease,
+			Type:   anki.ReviewReview,
+		})
+	}
+
+	plan, err := MakePlan(db, collection, "")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Hard and easy answers shouldn't be flattened into good.
+	grades := []string{"again", "hard", "good", "easy"}
+	if len(plan.Events) != len(grades) {
+		t.Fatal("expected one event per review:", plan.Events)
+	}
+	for i, event := range plan.Events {
+		if event.Grade != grades[i] || event.Correct != (i > 0) {
+			t.Fatal("expected ease to be converted into grade:", event, grades[i])
+		}
+	}
+}
+
+func TestMakePlanLearningGrades(t *testing.T) {
+	// Cards in learning have no hard button in the v1 scheduler.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0)`)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	collection := testCollection(start)
+	collection.Reviews = []anki.Review{
+		{Time: start, NoteID: 1, Ease: 1, Type: anki.ReviewLearn},
+		{Time: start.Add(time.Minute), NoteID: 1, Ease: 2, Type: anki.ReviewLearn},
+		{Time: start.Add(2 * time.Minute), NoteID: 1, Ease: 3, Type: anki.ReviewRelearn},
+	}
+
+	cases := []struct {
+		version int
+		grades  []string
+	}{
+		{1, []string{"again", "good", "easy"}},
+		{2, []string{"again", "hard", "good"}},
+	}
+	for _, c := range cases {
+		collection.SchedulerVersion = c.version
+		plan, err := MakePlan(db, collection, "")
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if len(plan.Events) != len(c.grades) {
+			t.Fatal("expected one event per review:", plan.Events)
+		}
+		for i, event := range plan.Events {
+			if event.Grade != c.grades[i] {
+				t.Fatal("unexpected grade:", c.version, event, c.grades[i])
+			}
+		}
+	}
+}
+
+func TestMakePlanField(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0)`)
+
+	collection := anki.Collection{
+		Notes: []anki.StoredNote{{
+			ID:         1,
+			FieldNames: []string{"English", "Spanish"},
+			Fields:     map[string]string{"English": "hello", "Spanish": "hola"},
+		}},
+	}
+	plan, err := MakePlan(db, collection, "Spanish")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(plan.Mappings) != 1 || plan.Mappings[0].Word != "hola" {
+		t.Fatal("expected Spanish field to be used:", plan)
+	}
+
+	plan, err = MakePlan(db, collection, "Nope")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(plan.Mappings) != 0 || len(plan.Unmapped) != 0 {
+		t.Fatal("expected notes without the field to be ignored:", plan)
+	}
+}
+
+func TestApplyAtomic(t *testing.T) {
+	// Failed imports shouldn't leave words partly replayed, or change today's
+	// activity.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0)`)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	plan, err := MakePlan(db, testCollection(start), "")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	plan.Events = append(plan.Events, plan.Events[0])
+	plan.Events[len(plan.Events)-1].Grade = "invalid"
+
+	con, err := database.NewConnection(db, context.Background())
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer con.Close()
+	if err := Apply(con, plan); err == nil {
+		t.Fatal("expected err to be non-nil")
+	}
+
+	var reviews, history int
+	query := `SELECT (SELECT count(*) FROM review), (SELECT count(*) FROM review_history)`
+	if err := con.QueryRow(query).Scan(&reviews, &history); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if reviews != 0 || history != 0 {
+		t.Fatal("expected failed import to be rolled back:", reviews, history)
+	}
+}
+
+func TestApplyActivityUnchanged(t *testing.T) {
+	// Imported reviews aren't today's activity.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0)`)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	plan, err := MakePlan(db, testCollection(start), "")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	con, err := database.NewConnection(db, context.Background())
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer con.Close()
+	if err := Apply(con, plan); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var total int
+	query := `SELECT coalesce(sum(forgotten + unimproved + crammed + learned + strengthened), 0) FROM activity`
+	if err := con.QueryRow(query).Scan(&total); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if total != 0 {
+		t.Fatal("expected imported reviews to not count as activity:", total)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// Imported words should keep the times of their Anki reviews.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('hola', 0)`)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	plan, err := MakePlan(db, testCollection(start), "")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	con, err := database.NewConnection(db, context.Background())
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer con.Close()
+	if err := Apply(con, plan); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var reviewed int64
+	var interval int
+	query := `SELECT reviewed, interval FROM review WHERE item = 'hola'`
+	if err := con.QueryRow(query).Scan(&reviewed, &interval); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if reviewed != start.Add(72*time.Hour).Unix() {
+		t.Fatal("expected last review time from Anki:", time.Unix(reviewed, 0))
+	}
+	if interval <= 0 {
+		t.Fatal("expected positive interval after correct review:", interval)
+	}
+}
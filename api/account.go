@@ -0,0 +1,222 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Self-service data export and account deletion.
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Adds file to zip archive.
+func addFile(zw *zip.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Adds consistent copy of review DB to zip archive.
+// Copying the file directly could catch the DB in the middle of a write.
+func addReviewDB(zw *zip.Writer, name, path string) error {
+	tmp, err := os.MkdirTemp("", "polycloze-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	db, err := database.Open(fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	snapshot := filepath.Join(tmp, "snapshot.db")
+	if _, err := db.Exec(`VACUUM INTO ?`, snapshot); err != nil {
+		return err
+	}
+	return addFile(zw, name, snapshot)
+}
+
+// Writes zip archive of user's data: account metadata, review DBs and logs.
+func writeExport(w io.Writer, db *sql.DB, userID int) error {
+	account, err := auth.ExportAccount(db, userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("account.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(account); err != nil {
+		return err
+	}
+
+	base := basedir.User(userID)
+	reviews, err := filepath.Glob(filepath.Join(base, "reviews", "*.db"))
+	if err != nil {
+		return err
+	}
+	for _, path := range reviews {
+		if err := addReviewDB(zw, "reviews/"+filepath.Base(path), path); err != nil {
+			return fmt.Errorf("failed to export review database (%v): %v", path, err)
+		}
+	}
+
+	logs, err := filepath.Glob(filepath.Join(base, "logs", "*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range logs {
+		if err := addFile(zw, "logs/"+filepath.Base(path), path); err != nil {
+			return fmt.Errorf("failed to export log (%v): %v", path, err)
+		}
+	}
+	return zw.Close()
+}
+
+// Sends zip archive of the user's data.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "accountMessage")
+	if !ok {
+		return
+	}
+	userID := s.Data["userID"].(int)
+
+	// Build the archive first, so errors can still be reported.
+	tmp, err := os.CreateTemp("", "polycloze-export-*.zip")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeExport(tmp, auth.GetDB(r), userID); err != nil {
+		log.Println(fmt.Errorf("data export failed: %v", err))
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("polycloze-%v-%v.zip", s.Data["username"], time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if _, err := io.Copy(w, tmp); err != nil {
+		log.Println(err)
+	}
+}
+
+// Users without passwords (see auth.HasPassword) who want to delete their
+// account have to have signed in within this much time.
+const recentSignIn = 10 * time.Minute
+
+// Deletes user's account and data.
+// Requires the user's password. Users without passwords have to type their
+// username, and have to have signed in recently.
+func handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "accountMessage")
+	if !ok {
+		return
+	}
+
+	db := auth.GetDB(r)
+	data := s.Data
+	username := s.Data["username"].(string)
+	attempt, message, ok := reserveAttempt(r, username)
+	if !ok {
+		data["accountMessage"] = message
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderSettings(w, r, s, data)
+		return
+	}
+	defer attempt.release()
+
+	id := s.Data["userID"].(int)
+	hasPassword, err := auth.HasPassword(db, id)
+	if err != nil {
+		log.Println(err)
+		data["accountMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+
+	switch {
+	case hasPassword:
+		if _, err := auth.Authenticate(db, username, r.FormValue("password")); err != nil {
+			attempt.fail()
+			audit(r, auth.EventSignInFailed, id, username, "account deletion")
+			data["accountMessage"] = "Incorrect password."
+			renderSettings(w, r, s, data)
+			return
+		}
+	case r.FormValue("username") != username:
+		data["accountMessage"] = "Type your username to confirm."
+		renderSettings(w, r, s, data)
+		return
+	case time.Since(s.Created()) > recentSignIn:
+		data["accountMessage"] = "Sign in again to delete your account."
+		renderSettings(w, r, s, data)
+		return
+	}
+
+	if err := auth.DeleteUser(db, id); err != nil {
+		log.Println(err)
+		data["accountMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+	audit(r, auth.EventUserDeleted, id, username, "self-service")
+	if err := sessions.EndUserSessions(sessionStore(r), id); err != nil {
+		log.Println(err)
+	}
+	if err := sessions.EndSession(sessionStore(r), w, r); err != nil {
+		log.Println(err)
+	}
+	if err := deleteUserDirectory(id); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
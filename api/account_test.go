@@ -0,0 +1,119 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+)
+
+func TestWriteExport(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeExport(&buf, db, 1); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	f, err := zr.Open("account.json")
+	if err != nil {
+		t.Fatal("expected account.json in archive:", err)
+	}
+	defer f.Close()
+
+	var account auth.Account
+	if err := json.NewDecoder(f).Decode(&account); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if account.ID != 1 || account.Username != "foo" {
+		t.Fatal("unexpected account:", account)
+	}
+}
+
+func TestDeleteAccountWrongPassword(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/settings/delete", handleDeleteAccount)
+
+	cookie := signedInCookie(t, db, 1, "foo")
+	v := url.Values{}
+	v.Set("password", "wrong")
+	w := postForm(r, "/settings/delete", cookie, v)
+	if w.Code == http.StatusSeeOther {
+		t.Fatal("expected account deletion to fail")
+	}
+	if _, err := auth.GetUser(db, 1); err != nil {
+		t.Fatal("expected user to still exist:", err)
+	}
+	if !isSessionSignedIn(t, db, cookie) {
+		t.Fatal("expected session to still be signed in")
+	}
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	// Users who signed up with an external identity have to type their
+	// username, and have to have signed in recently.
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	id, username, err := auth.RegisterIdentity(db, "foo", "https://example.com", "1234")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/settings/delete", handleDeleteAccount)
+
+	cookie := signedInCookie(t, db, id, username)
+	v := url.Values{}
+	v.Set("username", "bar")
+	w := postForm(r, "/settings/delete", cookie, v)
+	if w.Code == http.StatusSeeOther || !strings.Contains(w.Body.String(), "Type your username") {
+		t.Fatal("expected account deletion to fail:", w.Code)
+	}
+
+	// Make session older than recentSignIn.
+	query := `UPDATE user_session SET created = created - ?`
+	if _, err := db.Exec(query, int64(2*recentSignIn/time.Second)); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	v.Set("username", username)
+	w = postForm(r, "/settings/delete", cookie, v)
+	if w.Code == http.StatusSeeOther || !strings.Contains(w.Body.String(), "Sign in again") {
+		t.Fatal("expected account deletion to fail:", w.Code)
+	}
+	if _, err := auth.GetUser(db, id); err != nil {
+		t.Fatal("expected user to still exist:", err)
+	}
+}
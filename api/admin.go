@@ -0,0 +1,318 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Admin console for managing users.
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+type contextValueKey int
+
+const (
+	keyAdminSession contextValueKey = iota
+)
+
+// Only lets signed-in admins through.
+// Everyone else gets a 404, so the admin area isn't advertised.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db := auth.GetDB(r)
+		s, err := sessions.ResumeSession(sessionStore(r), w, r)
+		if err != nil || !isSignedIn(s) {
+			http.NotFound(w, r)
+			return
+		}
+
+		user, err := auth.GetUser(db, s.Data["userID"].(int))
+		if err != nil || !user.IsAdmin() || user.Disabled {
+			http.NotFound(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), keyAdminSession, s)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Gets admin's session from request context.
+// Assumes requireAdmin is used.
+func getAdminSession(r *http.Request) *sessions.Session {
+	return r.Context().Value(keyAdminSession).(*sessions.Session)
+}
+
+// Student's usage of a course.
+type CourseUsage struct {
+	L1       string
+	L2       string
+	Items    int       // Number of reviewed words
+	Learned  int       // Number of words that haven't been forgotten
+	Reviewed time.Time // Zero if the student hasn't reviewed anything yet
+	Size     int64     // Review DB size in bytes
+}
+
+// Computes usage stats of review DB.
+func courseUsage(path string) (CourseUsage, error) {
+	var usage CourseUsage
+
+	name := strings.TrimSuffix(filepath.Base(path), ".db")
+	l1, l2, found := strings.Cut(name, "-")
+	if !found {
+		return usage, fmt.Errorf("unexpected review database name: %v", path)
+	}
+	usage.L1 = l1
+	usage.L2 = l2
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return usage, err
+	}
+	usage.Size = info.Size()
+
+	db, err := database.Open(fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return usage, err
+	}
+	defer db.Close()
+
+	var reviewed sql.NullInt64
+	query := `SELECT count(*), coalesce(sum(interval > 0), 0), max(reviewed) FROM review`
+	if err := db.QueryRow(query).Scan(&usage.Items, &usage.Learned, &reviewed); err != nil {
+		return usage, err
+	}
+	if reviewed.Valid {
+		usage.Reviewed = time.Unix(reviewed.Int64, 0)
+	}
+	return usage, nil
+}
+
+// Lists usage stats of each course the user has studied.
+func userCourseUsage(userID int) ([]CourseUsage, error) {
+	matches, err := filepath.Glob(filepath.Join(basedir.User(userID), "reviews", "*.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]CourseUsage, 0, len(matches))
+	for _, match := range matches {
+		u, err := courseUsage(match)
+		if err != nil {
+			log.Println(fmt.Errorf("could not compute course usage (%v): %v", match, err))
+			continue
+		}
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// Gets user ID from URL.
+func userIDParam(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "id"))
+}
+
+// Lists users.
+func handleAdmin(w http.ResponseWriter, r *http.Request) {
+	s := getAdminSession(r)
+	users, err := auth.ListUsers(auth.GetDB(r))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+
+	data := s.Data
+	data["users"] = users
+	data["message"] = r.URL.Query().Get("message")
+	renderTemplate(w, "admin.html", data)
+}
+
+// Shows user's info and course usage.
+func handleAdminUser(w http.ResponseWriter, r *http.Request) {
+	s := getAdminSession(r)
+	id, err := userIDParam(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, err := auth.GetUser(auth.GetDB(r), id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	usage, err := userCourseUsage(id)
+	if err != nil {
+		log.Println(err)
+	}
+
+	data := s.Data
+	data["user"] = user
+	data["usage"] = usage
+	data["message"] = r.URL.Query().Get("message")
+	data["csrfToken"] = sessions.CSRFToken(s.ID)
+	renderTemplate(w, "admin_user.html", data)
+}
+
+// Checks CSRF token of admin form and parses target user ID.
+// Admins can't use these forms on their own account, so they can't lock
+// themselves out.
+func adminTarget(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s := getAdminSession(r)
+	id, err := userIDParam(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return 0, false
+	}
+	if !sessions.CheckCSRFToken(s.ID, r.FormValue("csrf-token")) {
+		http.Error(w, "Forbidden.", http.StatusForbidden)
+		return 0, false
+	}
+	if id == s.Data["userID"].(int) {
+		redirectToAdminUser(w, r, id, "You can't do that to your own account.")
+		return 0, false
+	}
+	return id, true
+}
+
+// Records admin action in the audit log.
+// The entry belongs to the target user, and the detail names the admin.
+func auditAdminAction(r *http.Request, event auth.Event, userID int) {
+	s := getAdminSession(r)
+	detail := fmt.Sprintf("by admin %v", s.Data["username"])
+
+	var username string
+	if user, err := auth.GetUser(auth.GetDB(r), userID); err == nil {
+		username = user.Username
+	}
+	audit(r, event, userID, username, detail)
+}
+
+// Redirects to admin page with a message.
+func redirectWithMessage(w http.ResponseWriter, r *http.Request, path, message string) {
+	target := path + "?message=" + url.QueryEscape(message)
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func redirectToAdminUser(w http.ResponseWriter, r *http.Request, id int, message string) {
+	redirectWithMessage(w, r, fmt.Sprintf("/admin/users/%v", id), message)
+}
+
+// Sets new password for user and ends the user's sessions.
+func handleAdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	db := auth.GetDB(r)
+	password := r.FormValue("password")
+	if password == "" {
+		redirectToAdminUser(w, r, id, "Enter a new password.")
+		return
+	}
+	if err := auth.ChangePassword(db, id, password); err != nil {
+		redirectToAdminUser(w, r, id, passwordMessage(err))
+		return
+	}
+	auditAdminAction(r, auth.EventPasswordChange, id)
+	if err := sessions.EndUserSessions(sessionStore(r), id); err != nil {
+		log.Println(err)
+	}
+	auditAdminAction(r, auth.EventSessionRevoked, id)
+	redirectToAdminUser(w, r, id, "Password reset.")
+}
+
+// Disables or re-enables user.
+func handleAdminDisable(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	disabled := r.FormValue("disabled") == "true"
+	if err := auth.SetDisabled(auth.GetDB(r), id, disabled); err != nil {
+		log.Println(err)
+		redirectToAdminUser(w, r, id, "Could not update user.")
+		return
+	}
+	if disabled {
+		// SetDisabled only ends sessions stored in the users DB.
+		if err := sessions.EndUserSessions(sessionStore(r), id); err != nil {
+			log.Println(err)
+		}
+		auditAdminAction(r, auth.EventUserDisabled, id)
+		redirectToAdminUser(w, r, id, "User disabled.")
+	} else {
+		auditAdminAction(r, auth.EventUserEnabled, id)
+		redirectToAdminUser(w, r, id, "User enabled.")
+	}
+}
+
+// Deletes user's files.
+func deleteUserDirectory(userID int) error {
+	if basedir.StateDir == "" {
+		return errors.New("failed to delete user directory: state directory not set")
+	}
+	if err := os.RemoveAll(basedir.User(userID)); err != nil {
+		return fmt.Errorf("failed to delete user directory: %v", err)
+	}
+	return nil
+}
+
+// Deletes user and the user's files.
+func handleAdminDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	// Look up username before it's gone.
+	var username string
+	if user, err := auth.GetUser(auth.GetDB(r), id); err == nil {
+		username = user.Username
+	}
+	if err := auth.DeleteUser(auth.GetDB(r), id); err != nil {
+		log.Println(err)
+		redirectToAdminUser(w, r, id, "Could not delete user.")
+		return
+	}
+	audit(r, auth.EventUserDeleted, id, username, fmt.Sprintf("by admin %v", getAdminSession(r).Data["username"]))
+	if err := sessions.EndUserSessions(sessionStore(r), id); err != nil {
+		log.Println(err)
+	}
+	if err := deleteUserDirectory(id); err != nil {
+		log.Println(err)
+		redirectWithMessage(w, r, "/admin/", "User deleted, but their files couldn't be removed.")
+		return
+	}
+	redirectWithMessage(w, r, "/admin/", "User deleted.")
+}
+
+// Routes for admin console.
+func adminRouter(r chi.Router) {
+	r.Use(requireAdmin)
+	r.Get("/", handleAdmin)
+	r.Get("/audit", handleAdminAudit)
+	r.Get("/users/{id}", handleAdminUser)
+	r.Post("/users/{id}/password", handleAdminResetPassword)
+	r.Post("/users/{id}/disable", handleAdminDisable)
+	r.Post("/users/{id}/delete", handleAdminDelete)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Creates signed-in session for user.
+// Returns session cookie.
+func signedInCookie(t *testing.T, db *sql.DB, userID int, username string) *http.Cookie {
+	store := sessions.NewSQLiteStore(db)
+	w := httptest.NewRecorder()
+	s, err := sessions.StartSession(store, w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	s.Data["userID"] = userID
+	s.Data["username"] = username
+	if err := sessions.SaveData(store, w, s); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	// The last cookie is the most recent one.
+	cookies := w.Result().Cookies()
+	return cookies[len(cookies)-1]
+}
+
+func TestRequireAdmin(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	for _, username := range []string{"admin", "student"} {
+		if err := auth.Register(db, username, "password"); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	if err := auth.SetRole(db, "admin", auth.RoleAdmin); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route("/admin", adminRouter)
+
+	cases := []struct {
+		cookie *http.Cookie
+		code   int
+	}{
+		{nil, http.StatusNotFound},
+		{signedInCookie(t, db, 2, "student"), http.StatusNotFound},
+		{signedInCookie(t, db, 1, "admin"), http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		if c.cookie != nil {
+			req.AddCookie(c.cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.code {
+			t.Fatal("unexpected status code:", c.cookie, w.Code)
+		}
+	}
+}
+
+func TestAdminCantDisableSelf(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "admin", "password"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := auth.SetRole(db, "admin", auth.RoleAdmin); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route("/admin", adminRouter)
+
+	cookie := signedInCookie(t, db, 1, "admin")
+	v := url.Values{}
+	v.Set("disabled", "true")
+	v.Set("csrf-token", sessions.CSRFToken(cookie.Value))
+
+	req := httptest.NewRequest("POST", "/admin/users/1/disable", strings.NewReader(v.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	user, err := auth.GetUser(db, 1)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if user.Disabled {
+		t.Fatal("expected admin to not be able to disable own account")
+	}
+}
+
+func TestSignInIsAudited(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/signin", handleSignIn)
+
+	v := url.Values{}
+	v.Set("username", "foo")
+	v.Set("password", "wrong password")
+	w := postForm(r, "/signin", anonymousCookie(t, db), v)
+	if w.Code != http.StatusOK {
+		t.Fatal("unexpected status code:", w.Code)
+	}
+
+	entries, err := auth.QueryAudit(db, auth.AuditFilter{UserID: 1})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(entries) != 1 || entries[0].Event != auth.EventSignInFailed {
+		t.Fatal("expected failed sign-in to be audited:", entries)
+	}
+	if strings.Contains(entries[0].Detail, "wrong password") {
+		t.Fatal("password should not be in audit log:", entries[0])
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "admin", "password"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := auth.SetRole(db, "admin", auth.RoleAdmin); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	entry := auth.AuditEntry{Event: auth.EventSignInFailed, Username: "mallory", IP: "192.0.2.1"}
+	if err := auth.RecordAudit(db, entry); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route("/admin", adminRouter)
+
+	req := httptest.NewRequest("GET", "/admin/audit?event=sign-in-failed", nil)
+	req.AddCookie(signedInCookie(t, db, 1, "admin"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal("unexpected status code:", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "192.0.2.1") {
+		t.Fatal("expected audit log entry in page:", body)
+	}
+}
@@ -4,6 +4,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -20,18 +22,24 @@ import (
 	"github.com/lggruspe/polycloze/database"
 	"github.com/lggruspe/polycloze/flashcards"
 	"github.com/lggruspe/polycloze/logger"
+	"github.com/lggruspe/polycloze/review_scheduler"
 	"github.com/lggruspe/polycloze/sessions"
 	"github.com/lggruspe/polycloze/text"
 	"github.com/lggruspe/polycloze/word_scheduler"
 )
 
-func getN(r *http.Request) int {
-	n := 10
-	q := r.URL.Query()
-	if i, err := strconv.Atoi(q.Get("n")); err == nil && i > 0 {
-		n = i
+// Max number of flashcards per request.
+const maxFlashcards = 100
+
+// Gets number of flashcards to generate from URL query.
+// Returns false if it's not an integer between 1 and maxFlashcards.
+func getN(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("n")
+	if v == "" {
+		return 10, true
 	}
-	return n
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n > 0 && n <= maxFlashcards
 }
 
 // Returns predicate to pass to item generator.
@@ -46,68 +54,99 @@ func excludeWords(r *http.Request) func(string) bool {
 	}
 }
 
-func generateFlashcards(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func generateFlashcards(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	n, ok := getN(r)
+	if !ok {
+		sendInvalid(w, fmt.Sprintf("n should be an integer from 1 to %v.", maxFlashcards))
+		return
+	}
+
 	l1 := chi.URLParam(r, "l1")
 	l2 := chi.URLParam(r, "l2")
-	hook := database.AttachCourse(basedir.Course(l1, l2))
-	items := flashcards.Get(db, getN(r), excludeWords(r), hook)
-	sendJSON(w, map[string][]flashcards.Item{
-		"items": items,
-	})
+	logOrphans(r, db, s.Data["userID"].(int), l1, l2)
+
+	items := flashcards.Get(db, n, excludeWords(r), attachCourse(r))
+	sendJSON(w, FlashcardsResponse{Items: items})
 }
 
-// frequencyClass is the student's estimated level (see word_scheduler.Placement).
-func success(frequencyClass int) []byte {
-	return []byte(fmt.Sprintf("{\"success\": true, \"frequencyClass\": %v}", frequencyClass))
+// Logs review items that don't match any word in the course anymore after a
+// course update.
+func logOrphans(r *http.Request, db *sql.DB, userID int, l1, l2 string) {
+	orphans, err := checkCourseVersion(r.Context(), db, acquiredCourse(r))
+	if err != nil {
+		log.Println(fmt.Errorf("could not check course version (%v-%v): %v", l1, l2, err))
+	}
+	if len(orphans) > 0 {
+		sample := orphans
+		if len(sample) > 10 {
+			sample = sample[:10]
+		}
+		log.Printf("user %v has %v orphaned review items after %v-%v course update, e.g. %v (see orphaned_item table, or run cmd/remap)\n", userID, len(orphans), l1, l2, sample)
+	}
 }
 
 func handleReviewUpdate(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "expected json body in POST request", http.StatusBadRequest)
+	if !hasJSONBody(r) {
+		sendError(w, http.StatusUnsupportedMediaType, errUnsupportedMediaType, "Expected JSON request body.")
 		return
 	}
 
 	// Check csrf token in HTTP headers.
-	if !sessions.CheckCSRFToken(s.ID, r.Header.Get("X-CSRF-Token")) {
-		http.Error(w, "Forbidden.", http.StatusForbidden)
+	if !checkAPICSRFToken(r, s) {
+		sendError(w, http.StatusForbidden, errForbidden, "Invalid CSRF token.")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Could not read request.", http.StatusInternalServerError)
+		sendInternalError(w)
 		return
 	}
 
 	var reviews Reviews
 	if err := json.Unmarshal(body, &reviews); err != nil {
-		http.Error(w, "could not parse json", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, errBadRequest, "Could not parse JSON.")
 		return
 	}
+	for _, review := range reviews.Reviews {
+		if review.Word == "" {
+			sendInvalid(w, "Reviews should have a word.")
+			return
+		}
+		if _, err := review.grade(); err != nil {
+			sendInvalid(w, "grade should be again, hard, good or easy.")
+			return
+		}
+		if review.Latency < 0 || review.Hints < 0 || review.Digraphs < 0 {
+			sendInvalid(w, "latency, hints and digraphs can't be negative.")
+			return
+		}
+	}
 
 	l1 := chi.URLParam(r, "l1")
 	l2 := chi.URLParam(r, "l2")
-	hook := database.AttachCourse(basedir.Course(l1, l2))
-	con, err := database.NewConnection(db, r.Context(), hook)
+	logOrphans(r, db, s.Data["userID"].(int), l1, l2)
+
+	con, err := database.NewConnection(db, r.Context(), attachCourse(r))
 	if err != nil {
-		log.Fatal("could not connect to database:", err)
+		log.Println("could not connect to database:", err)
+		sendInternalError(w)
+		return
 	}
 	defer con.Close()
 
 	userID := s.Data["userID"].(int)
 	var frequencyClass int
 	for _, review := range reviews.Reviews {
-		err := word_scheduler.UpdateWord(con, review.Word, review.Correct)
+		err := word_scheduler.UpdateWordWith(con, review.Word, review.answer(), time.Now().UTC())
 		if err != nil {
 			log.Printf("failed to update word: '%v'\n\t%v\n", review.Word, err.Error())
 		}
 		frequencyClass = word_scheduler.Placement(con)
-		_ = logger.LogReview(basedir.Log(userID, l1, l2), review.Correct, review.Word)
+		_ = logger.LogReview(basedir.Log(userID, l1, l2), logEvent(review, l1, l2))
 	}
 
-	if _, err := w.Write(success(frequencyClass)); err != nil {
-		log.Println(err)
-	}
+	sendJSON(w, ReviewResponse{Success: true, FrequencyClass: frequencyClass})
 }
 
 // Middleware
@@ -119,41 +158,8 @@ func cors(next http.Handler) http.Handler {
 	})
 }
 
-func handleFlashcards(w http.ResponseWriter, r *http.Request) {
-	db := auth.GetDB(r)
-	s, err := sessions.ResumeSession(db, w, r)
-	if err != nil || !isSignedIn(s) {
-		http.NotFound(w, r)
-		return
-	}
-
-	l1 := chi.URLParam(r, "l1")
-	l2 := chi.URLParam(r, "l2")
-	if !courseExists(l1, l2) {
-		http.NotFound(w, r)
-		return
-	}
-
-	userID := s.Data["userID"].(int)
-	db, err = database.New(basedir.Review(userID, l1, l2))
-	if err != nil {
-		log.Println(fmt.Errorf("could not open review database (%v-%v): %v", l1, l2, err))
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	switch r.Method {
-	case "POST":
-		handleReviewUpdate(db, w, r, s)
-	case "GET":
-		generateFlashcards(db, w, r)
-	}
-}
-
 func handleHome(w http.ResponseWriter, r *http.Request) {
-	db := auth.GetDB(r)
-	s, err := sessions.StartOrResumeSession(db, w, r)
+	s, err := sessions.StartOrResumeSession(sessionStore(r), w, r)
 
 	if err != nil || !isSignedIn(s) {
 		http.Redirect(w, r, "/about", http.StatusTemporaryRedirect)
@@ -163,46 +169,87 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleStudy(w http.ResponseWriter, r *http.Request) {
-	db := auth.GetDB(r)
-	s, err := sessions.ResumeSession(db, w, r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
 	if err != nil || !isSignedIn(s) {
 		http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
 		return
 	}
-	s.Data["csrfToken"] = sessions.CSRFToken(s.ID)
+	s.Data["csrfToken"] = sessions.SetCSRFCookie(w, s.ID)
 	renderTemplate(w, "study.html", s.Data)
 }
 
 func handleVocabularyPage(w http.ResponseWriter, r *http.Request) {
-	db := auth.GetDB(r)
-	s, err := sessions.ResumeSession(db, w, r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
 	if err != nil || !isSignedIn(s) {
 		http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
 		return
 	}
-	s.Data["csrfToken"] = sessions.CSRFToken(s.ID)
+	s.Data["csrfToken"] = sessions.SetCSRFCookie(w, s.ID)
 	renderTemplate(w, "vocab.html", s.Data)
 }
 
 // db: user DB for authentication
 func Router(config Config, db *sql.DB) (chi.Router, error) {
+	sessions.ClientIPHeader = config.ClientIPHeader
+	if config.SessionTimeouts != nil {
+		if err := sessions.SetTimeouts(*config.SessionTimeouts); err != nil {
+			return nil, err
+		}
+	}
+	if config.CSRFKey != nil {
+		if err := sessions.SetCSRFKey(config.CSRFKey); err != nil {
+			return nil, err
+		}
+	}
+	review_scheduler.SetSlowAnswerThreshold(config.SlowAnswer)
+	if config.BreachedPasswords != "" {
+		breached, err := auth.LoadBreachedPasswords(config.BreachedPasswords)
+		if err != nil {
+			return nil, err
+		}
+		auth.SetBreachedPasswords(breached)
+	}
+	if err := setupOIDC(context.Background(), config.OIDC); err != nil {
+		return nil, err
+	}
+
 	r := chi.NewRouter()
 	if config.AllowCORS {
 		r.Use(cors)
 	}
 	r.Use(middleware.Logger)
+	auth.RejectRequest = rejectRequest
 	r.Use(auth.Middleware(db))
 
+	store := config.SessionStore
+	if store == nil {
+		store = sessions.NewSQLiteStore(db)
+	}
+	r.Use(sessions.Middleware(store))
+
 	r.HandleFunc("/", handleHome)
 	r.HandleFunc("/study", handleStudy)
 	r.HandleFunc("/vocab", handleVocabularyPage)
 	r.HandleFunc("/about", showPage("about.html"))
 
 	r.HandleFunc("/settings", handleSettings)
+	r.HandleFunc("/settings/tokens", handleCreateToken)
+	r.HandleFunc("/settings/tokens/revoke", handleRevokeToken)
+	r.HandleFunc("/settings/2fa/setup", handleSetupTwoFactor)
+	r.HandleFunc("/settings/2fa/confirm", handleConfirmTwoFactor)
+	r.HandleFunc("/settings/2fa/disable", handleDisableTwoFactor)
+	r.HandleFunc("/settings/sessions/revoke", handleRevokeSession)
+	r.HandleFunc("/settings/sessions/revoke-others", handleRevokeOtherSessions)
+	r.HandleFunc("/settings/export", handleExport)
+	r.HandleFunc("/settings/delete", handleDeleteAccount)
 
 	r.HandleFunc("/register", handleRegister)
 	r.HandleFunc("/signin", handleSignIn)
+	r.HandleFunc("/signin/verify", handleSignInVerify)
 	r.HandleFunc("/signout", handleSignOut)
+	r.HandleFunc("/oidc/login", handleOIDCLogin)
+	r.HandleFunc("/oidc/callback", handleOIDCCallback)
+	r.Route("/admin", adminRouter)
 
 	r.Handle("/dist/*", http.StripPrefix("/dist/", serveDist()))
 	r.Handle("/public/*", http.StripPrefix("/public/", servePublic()))
@@ -212,13 +259,12 @@ func Router(config Config, db *sql.DB) (chi.Router, error) {
 	// serviceworker has to be at the root.
 	r.Handle("/serviceworker.js*", http.StripPrefix("/", serveDist()))
 
-	r.HandleFunc("/{l1}/{l2}", handleFlashcards)
-
-	r.HandleFunc("/{l1}/{l2}/activity", handleActivity)
-	r.HandleFunc("/{l1}/{l2}/vocab", handleVocabulary)
-	r.HandleFunc("/api/sentences", handleSentences)
-
-	r.HandleFunc("/api/languages", serveLanguagesJSON())
-	r.HandleFunc("/api/courses", serveCoursesJSON())
+	openAPI, err := handleOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+	r.Get("/api/openapi.json", openAPI)
+	r.Route(apiPrefix, v1Router)
+	legacyAPIRouter(r)
 	return r, nil
 }
@@ -0,0 +1,97 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Security audit log.
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Number of audit log entries per page in the admin console.
+const auditPageSize = 100
+
+// Records security event in the audit log.
+// userID: 0 if unknown, e.g. failed sign-in with a wrong username
+// Errors get logged, so they don't break the action being audited.
+func audit(r *http.Request, event auth.Event, userID int, username, detail string) {
+	err := auth.RecordAudit(auth.GetDB(r), auth.AuditEntry{
+		Event:     event,
+		UserID:    userID,
+		Username:  username,
+		IP:        sessions.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Parses date in YYYY-MM-DD format.
+// Returns the zero time if the date is empty or invalid.
+func parseDate(value string) time.Time {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Shows audit log entries that match the query parameters.
+//
+// Query parameters (all optional):
+// - user: user ID
+// - event: event type, e.g. "sign-in-failed"
+// - since: YYYY-MM-DD (inclusive)
+// - until: YYYY-MM-DD (inclusive)
+// - before: audit log entry ID, for pagination
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	s := getAdminSession(r)
+	q := r.URL.Query()
+
+	filter := auth.AuditFilter{
+		Event: auth.Event(q.Get("event")),
+		Since: parseDate(q.Get("since")),
+		Until: parseDate(q.Get("until")),
+		Limit: auditPageSize,
+	}
+	if !filter.Until.IsZero() {
+		filter.Until = filter.Until.AddDate(0, 0, 1)
+	}
+	if userID, err := strconv.Atoi(q.Get("user")); err == nil {
+		filter.UserID = userID
+	}
+	if before, err := strconv.Atoi(q.Get("before")); err == nil {
+		filter.Before = before
+	}
+
+	entries, err := auth.QueryAudit(auth.GetDB(r), filter)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+
+	data := s.Data
+	data["entries"] = entries
+	data["events"] = auth.Events
+	data["query"] = map[string]string{
+		"user":  q.Get("user"),
+		"event": q.Get("event"),
+		"since": q.Get("since"),
+		"until": q.Get("until"),
+	}
+	if len(entries) == auditPageSize {
+		next := q
+		next.Set("before", strconv.Itoa(entries[len(entries)-1].ID))
+		data["next"] = "/admin/audit?" + next.Encode()
+	}
+	renderTemplate(w, "admin_audit.html", data)
+}
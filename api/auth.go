@@ -5,7 +5,9 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path"
@@ -46,12 +48,61 @@ func isSignedIn(s *sessions.Session) bool {
 	return hasUserID(s.Data) && hasUsername(s.Data)
 }
 
+// Resumes session for API endpoints.
+// Requests authenticated with an API token get a stand-in session with the
+// token owner's data, so API clients don't need cookies.
+func resumeAPISession(w http.ResponseWriter, r *http.Request) (*sessions.Session, error) {
+	if token, ok := auth.GetToken(r); ok {
+		s := sessions.Session{
+			Data: map[string]any{
+				"userID":   token.UserID,
+				"username": token.Username,
+			},
+		}
+		return &s, nil
+	}
+	return sessions.ResumeSession(sessionStore(r), w, r)
+}
+
+// Gets session store from request context.
+// Defaults to storing sessions in the users DB.
+func sessionStore(r *http.Request) sessions.Store {
+	if store, ok := sessions.GetStore(r); ok {
+		return store
+	}
+	return sessions.NewSQLiteStore(auth.GetDB(r))
+}
+
+// Checks double-submitted CSRF token of API request.
+// Requests authenticated with API tokens are exempt, because browsers don't
+// send the Authorization header on their own.
+func checkAPICSRFToken(r *http.Request, s *sessions.Session) bool {
+	if _, ok := auth.GetToken(r); ok {
+		return true
+	}
+	return sessions.CheckCSRFHeader(r, s.ID)
+}
+
+// Explains why password was rejected by the password policy.
+func passwordMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrPasswordTooShort):
+		return fmt.Sprintf("Password is too short. Use at least %v characters.", auth.MinPasswordLength)
+	case errors.Is(err, auth.ErrPasswordTooLong):
+		return fmt.Sprintf("Password is too long. Use at most %v bytes.", auth.MaxPasswordLength)
+	case errors.Is(err, auth.ErrPasswordBreached):
+		return "This password is too common or has appeared in a data breach. Try another one."
+	default:
+		return "Something went wrong. Please try again."
+	}
+}
+
 // HandlerFunc for user registrations.
 func handleRegister(w http.ResponseWriter, r *http.Request) {
 	// Redirect to home page if already signed in.
 	data := make(map[string]any)
 	db := auth.GetDB(r)
-	s, err := sessions.StartOrResumeSession(db, w, r)
+	s, err := sessions.StartOrResumeSession(sessionStore(r), w, r)
 	if err != nil {
 		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
 		return
@@ -69,7 +120,20 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 			data["message"] = "Something went wrong. Please try again."
 			goto fail
 		}
+		// The attempt never gets released, so that every attempt counts,
+		// not just failures, and clients can't create accounts (and hash
+		// passwords) without limit.
+		if _, message, ok := reserveAttempt(r, ""); !ok {
+			data["message"] = message
+			w.WriteHeader(http.StatusTooManyRequests)
+			goto fail
+		}
+		if err := auth.CheckPassword(password); err != nil {
+			data["message"] = passwordMessage(err)
+			goto fail
+		}
 		if auth.Register(db, username, password) == nil {
+			audit(r, auth.EventRegister, 0, username, "password")
 			http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
 			return
 		}
@@ -85,7 +149,7 @@ fail:
 func handleSignIn(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]any)
 	db := auth.GetDB(r)
-	s, err := sessions.StartOrResumeSession(db, w, r)
+	s, err := sessions.StartOrResumeSession(sessionStore(r), w, r)
 	if err != nil {
 		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
 		return
@@ -97,29 +161,66 @@ func handleSignIn(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
+		remember := r.FormValue("remember") == "true"
 		csrfToken := r.FormValue("csrf-token")
 
 		if !sessions.CheckCSRFToken(s.ID, csrfToken) {
 			data["message"] = "Authentication failed."
 			goto fail
 		}
+		attempt, message, ok := reserveAttempt(r, username)
+		if !ok {
+			data["message"] = message
+			w.WriteHeader(http.StatusTooManyRequests)
+			goto fail
+		}
+		defer attempt.release()
+
 		userID, err := auth.Authenticate(db, username, password)
 		if err != nil {
+			attempt.fail()
+			audit(r, auth.EventSignInFailed, 0, username, "password")
 			data["message"] = "Incorrect username or password."
 			goto fail
 		}
 
+		hasTOTP, err := auth.HasTOTP(db, userID)
+		if err != nil {
+			log.Println(err)
+			data["message"] = "Authentication failed."
+			goto fail
+		}
+		if hasTOTP {
+			// Don't mark the session as signed in until the second step.
+			// Failed attempts only get reset after the second step, so
+			// that re-entering the password doesn't give more guesses.
+			requestTwoFactorCode(w, s, userID, username, "password", remember)
+			return
+		}
+		resetLimit(r, username)
+
+		if sessions.RotateSession(sessionStore(r), w, s) != nil {
+			data["message"] = "Authentication failed."
+			goto fail
+		}
 		s.Data["userID"] = userID
 		s.Data["username"] = username
-		if sessions.SaveData(db, s) != nil {
+		if sessions.SaveData(sessionStore(r), w, s) != nil {
 			data["message"] = "Authentication failed."
 			goto fail
 		}
+		if remember {
+			if err := sessions.Remember(sessionStore(r), w, s); err != nil {
+				log.Println(err)
+			}
+		}
+		audit(r, auth.EventSignIn, userID, username, "password")
 		goto success
 	}
 
 fail:
 	data["csrfToken"] = sessions.CSRFToken(s.ID)
+	data["sso"] = oidcProvider != nil
 	renderTemplate(w, "signin.html", data)
 	return
 
@@ -138,16 +239,16 @@ func handleSignOut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := auth.GetDB(r)
-	s, err := sessions.ResumeSession(db, w, r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
 	if err != nil || !isSignedIn(s) {
 		goto done
 	}
 
-	if err := sessions.EndSession(db, w, r); err != nil {
+	if err := sessions.EndSession(sessionStore(r), w, r); err != nil {
 		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
 		return
 	}
+	audit(r, auth.EventSessionRevoked, s.Data["userID"].(int), s.Data["username"].(string), "signed out")
 
 done:
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
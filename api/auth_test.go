@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/PuerkitoBio/goquery"
@@ -52,7 +53,7 @@ func TestRegisterNoCSRFToken(t *testing.T) {
 
 	v := url.Values{}
 	v.Set("username", "foo")
-	v.Set("password", "bar")
+	v.Set("password", "correct horse")
 	resp, err := tc.PostForm(resolve(ts, "/register"), v)
 	if err != nil {
 		t.Fatal("expected err to be nil:", err)
@@ -69,3 +70,63 @@ func TestRegisterNoCSRFToken(t *testing.T) {
 		t.Fatal("expected form button text to be 'Register':", text)
 	}
 }
+
+func TestRegisterShortPassword(t *testing.T) {
+	t.Parallel()
+
+	db := testDB()
+	defer db.Close()
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/register", handleRegister)
+
+	cookie := anonymousCookie(t, db)
+	v := url.Values{}
+	v.Set("username", "foo")
+	v.Set("password", "bar")
+	w := postForm(r, "/register", cookie, v)
+
+	doc, err := goquery.NewDocumentFromReader(w.Body)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	message := doc.Find(".incorrect").Text()
+	if !strings.Contains(message, "too short") {
+		t.Fatal("expected password too short message:", message)
+	}
+	if _, err := auth.GetUser(db, 1); err == nil {
+		t.Fatal("expected user to not be registered")
+	}
+}
+
+func TestRegisterCountsSuccessfulAttempts(t *testing.T) {
+	// Successful registrations should count against the client's limit too.
+	t.Parallel()
+
+	db := testDB()
+	defer db.Close()
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/register", handleRegister)
+
+	cookie := anonymousCookie(t, db)
+	v := url.Values{}
+	v.Set("username", "foo")
+	v.Set("password", "correct horse battery staple")
+	postForm(r, "/register", cookie, v)
+
+	if _, err := auth.GetUser(db, 1); err != nil {
+		t.Fatal("expected user to be registered:", err)
+	}
+
+	var failures int
+	query := `SELECT failures FROM login_attempt WHERE key LIKE 'ip:%'`
+	if err := db.QueryRow(query).Scan(&failures); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if failures != 1 {
+		t.Fatal("expected registration to be counted:", failures)
+	}
+}
@@ -3,7 +3,39 @@
 
 package api
 
+import (
+	"time"
+
+	"github.com/lggruspe/polycloze/oidc"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
 type Config struct {
 	AllowCORS bool
 	Port      int
+
+	// Header with client IP address set by reverse proxy, if any.
+	// Used for rate limiting password attempts, the audit log and the list of
+	// sessions in the settings page.
+	ClientIPHeader string
+
+	// File with common or breached passwords to reject, if any.
+	// See auth.LoadBreachedPasswords for the format.
+	BreachedPasswords string
+
+	// Where sessions get stored. Uses the users DB if nil.
+	SessionStore sessions.Store
+
+	// Session lifetimes. Uses sessions.DefaultTimeouts if nil.
+	SessionTimeouts *sessions.Timeouts
+
+	// Secret key for signing CSRF tokens. Uses a random key if nil.
+	CSRFKey []byte
+
+	// Correct answers slower than this don't increase review intervals.
+	// Zero disables latency-aware grading.
+	SlowAnswer time.Duration
+
+	// OIDC sign-in is disabled if nil.
+	OIDC *oidc.Config
 }
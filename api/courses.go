@@ -4,14 +4,71 @@
 package api
 
 import (
-	"os"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
 
-	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/course_version"
+	"github.com/lggruspe/polycloze/database"
 )
 
-// Checks if course exists.
-func courseExists(l1, l2 string) bool {
-	path := basedir.Course(l1, l2)
-	_, err := os.Stat(path)
-	return !os.IsNotExist(err)
+type acquiredCourseKey struct{}
+
+// Returns request with course acquired by withCourse.
+func withAcquiredCourse(r *http.Request, c *installedCourse) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), acquiredCourseKey{}, c))
+}
+
+// Returns course acquired by withCourse.
+// The course stays the same for the whole request, even if it gets replaced
+// in the meantime.
+func acquiredCourse(r *http.Request) *installedCourse {
+	return r.Context().Value(acquiredCourseKey{}).(*installedCourse)
+}
+
+// Returns hook that attaches course acquired by withCourse.
+func attachCourse(r *http.Request) database.ConnectionHook {
+	return database.AttachCourse(acquiredCourse(r).link)
+}
+
+// Records the current course version in the user's review DB.
+// If the course changed since the review DB was last used, returns review
+// items that no longer match any word in the course, and records them in the
+// review DB.
+// The version only gets recorded after the orphaned items are, so that they
+// get checked again if anything fails.
+// c: course acquired for the request
+func checkCourseVersion(ctx context.Context, db *sql.DB, c *installedCourse) ([]string, error) {
+	version := c.Metadata.Version()
+	previous, err := course_version.LastVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if previous == version {
+		return nil, nil
+	}
+	if previous == "" {
+		_, err := course_version.RecordVersion(db, version)
+		return nil, err
+	}
+
+	hook := database.AttachCourse(c.link)
+	con, err := database.NewConnection(db, ctx, hook)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to database: %v", err)
+	}
+	defer con.Close()
+
+	orphans, err := course_version.OrphanedItems(con)
+	if err != nil {
+		return nil, err
+	}
+	if err := course_version.RecordOrphans(con, version, orphans); err != nil {
+		return nil, err
+	}
+	if _, err := course_version.RecordVersion(con, version); err != nil {
+		return nil, err
+	}
+	return orphans, nil
 }
@@ -0,0 +1,64 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// ETag support for in-memory documents.
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Response body with precomputed strong ETag.
+type document struct {
+	body []byte
+	etag string
+}
+
+func newDocument(body []byte) document {
+	sum := sha256.Sum256(body)
+	return document{
+		body: body,
+		etag: `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+}
+
+// Checks if etag matches any entity tag in If-None-Match header.
+// Uses weak comparison, as required for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends JSON document.
+// Replies with 304 Not Modified if the client already has the current version.
+// Clients have to revalidate every time, because the document can change
+// while the server is running.
+func sendJSONDocument(w http.ResponseWriter, r *http.Request, doc document) {
+	w.Header().Set("ETag", doc.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, doc.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(doc.body); err != nil {
+		log.Println("failed to send JSON:", err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Vocabulary export.
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/anki"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Reviewed word with course data.
+type exportedWord struct {
+	Word
+	Interval       time.Duration
+	FrequencyClass int // Negative if the word is no longer in the course.
+	Sentence       string
+	Translation    string
+}
+
+// Lists all reviewed words, sorted by word.
+// Words get the first example sentence in the course, so that exporting twice
+// gives the same result.
+//
+// NOTE Expects the course database to be attached.
+func exportVocabulary[T database.Querier](q T) ([]exportedWord, error) {
+	query := `
+		WITH vocabulary AS (
+			SELECT item, learned, reviewed, due, interval,
+				(SELECT count(*) FROM interval AS i WHERE i.interval < review.interval) AS strength
+			FROM review
+		)
+		SELECT item, learned, reviewed, due, interval, strength,
+			coalesce(word.frequency_class, -1),
+			coalesce(sentence.text, ''),
+			coalesce((
+				SELECT translation.text FROM translates
+				JOIN translation ON (translation.tatoeba_id = translates.target)
+				WHERE translates.source = sentence.tatoeba_id
+				ORDER BY translation.id
+				LIMIT 1
+			), '')
+		FROM vocabulary
+		LEFT JOIN word ON (word.word = vocabulary.item)
+		LEFT JOIN sentence ON (sentence.id = (
+			SELECT min(sentence) FROM contains WHERE contains.word = word.id
+		))
+		ORDER BY item
+	`
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("vocabulary export failed: %v", err)
+	}
+	defer rows.Close()
+
+	words := make([]exportedWord, 0)
+	for rows.Next() {
+		var word exportedWord
+		var learned, reviewed, due int64
+		var interval int
+		err := rows.Scan(
+			&word.Word.Word,
+			&learned,
+			&reviewed,
+			&due,
+			&interval,
+			&word.Strength,
+			&word.FrequencyClass,
+			&word.Sentence,
+			&word.Translation,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("vocabulary export failed: %v", err)
+		}
+		word.Learned = time.Unix(learned, 0)
+		word.Reviewed = time.Unix(reviewed, 0)
+		word.Due = time.Unix(due, 0)
+		word.Interval = time.Duration(interval) * time.Hour
+		words = append(words, word)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("vocabulary export failed: %v", err)
+	}
+	return words, nil
+}
+
+var exportHeader = []string{
+	"word",
+	"learned",
+	"reviewed",
+	"due",
+	"strength",
+	"frequency_class",
+	"sentence",
+	"translation",
+}
+
+// Writes words as CSV.
+// comma: field delimiter (',' or '\t')
+func writeVocabularyCSV(w io.Writer, words []exportedWord, comma rune) error {
+	formatTime := func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(exportHeader); err != nil {
+		return err
+	}
+	for _, word := range words {
+		frequencyClass := ""
+		if word.FrequencyClass >= 0 {
+			frequencyClass = strconv.Itoa(word.FrequencyClass)
+		}
+		record := []string{
+			word.Word.Word,
+			formatTime(word.Learned),
+			formatTime(word.Reviewed),
+			formatTime(word.Due),
+			strconv.Itoa(word.Strength),
+			frequencyClass,
+			word.Sentence,
+			word.Translation,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Note type of exported Anki decks.
+var exportModel = anki.Model{
+	Name:   "polycloze",
+	Fields: []string{"Word", "Sentence", "Translation"},
+	Front:  `<div class="word">{{Word}}</div><div class="sentence">{{Sentence}}</div>`,
+	Back:   `{{FrontSide}}<hr id=answer><div class="translation">{{Translation}}</div>`,
+	CSS: `.card { font-family: sans-serif; font-size: 20px; text-align: center; }
+.word { font-size: 32px; margin-bottom: 0.5em; }
+.translation { color: gray; }`,
+}
+
+// Returns name of exported Anki deck.
+func exportDeckName(l1, l2 string) string {
+	for _, course := range registry.Courses() {
+		if course.L1.Code == l1 && course.L2.Code == l2 {
+			return fmt.Sprintf("polycloze::%v (%v)", course.L2.Name, course.L1.Name)
+		}
+	}
+	return fmt.Sprintf("polycloze::%v-%v", l1, l2)
+}
+
+// Creates Anki deck of words.
+// Cards keep the words' due dates and intervals.
+func vocabularyDeck(name string, words []exportedWord) anki.Deck {
+	deck := anki.Deck{
+		Name:        name,
+		Description: "Exported from polycloze.",
+		Model:       exportModel,
+		Notes:       make([]anki.Note, 0, len(words)),
+	}
+	for _, word := range words {
+		deck.Notes = append(deck.Notes, anki.Note{
+			Fields: []string{
+				html.EscapeString(word.Word.Word),
+				html.EscapeString(word.Sentence),
+				html.EscapeString(word.Translation),
+			},
+			Tags: []string{"polycloze"},
+			Card: anki.Card{
+				Due:      word.Due,
+				Interval: word.Interval,
+			},
+		})
+	}
+	return deck
+}
+
+// Export formats and their content types.
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"tsv":  "text/tab-separated-values; charset=utf-8",
+	"apkg": "application/zip",
+}
+
+// Sends all reviewed words as a file download.
+func handleVocabularyExport(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		sendInvalid(w, "format should be csv, tsv or apkg.")
+		return
+	}
+
+	l1 := chi.URLParam(r, "l1")
+	l2 := chi.URLParam(r, "l2")
+	con, err := database.NewConnection(db, r.Context(), attachCourse(r))
+	if err != nil {
+		log.Println(fmt.Errorf("could not connect to database: %v", err))
+		sendInternalError(w)
+		return
+	}
+	defer con.Close()
+
+	words, err := exportVocabulary(con)
+	if err != nil {
+		log.Println(err)
+		sendInternalError(w)
+		return
+	}
+
+	// Write to a buffer first, so that errors can still be sent as JSON.
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		err = writeVocabularyCSV(&buf, words, ',')
+	case "tsv":
+		err = writeVocabularyCSV(&buf, words, '\t')
+	case "apkg":
+		err = anki.WriteAPKG(&buf, vocabularyDeck(exportDeckName(l1, l2), words))
+	}
+	if err != nil {
+		log.Println(fmt.Errorf("vocabulary export failed: %v", err))
+		sendInternalError(w)
+		return
+	}
+
+	filename := fmt.Sprintf("polycloze-%v-%v.%v", l1, l2, format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf.Bytes())
+}
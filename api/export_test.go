@@ -0,0 +1,115 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/review_scheduler"
+	"github.com/lggruspe/polycloze/utils"
+	"github.com/lggruspe/polycloze/word_scheduler"
+)
+
+func TestExportVocabulary(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	query := `
+		INSERT INTO word (id, word, frequency_class) VALUES (1, 'hola', 2), (2, 'mundo', 3);
+		INSERT INTO sentence (id, tatoeba_id, text, tokens, frequency_class) VALUES
+			(1, 10, 'Hola, mundo.', '[]', 3),
+			(2, 20, '¡Hola!', '[]', 2);
+		INSERT INTO contains (sentence, word) VALUES (2, 1), (1, 1), (1, 2);
+		INSERT INTO translation (id, tatoeba_id, text) VALUES (1, 100, 'Hello, world.');
+		INSERT INTO translates (source, target) VALUES (10, 100);
+	`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	for _, word := range []string{"mundo", "hola", "adiós"} {
+		if err := word_scheduler.UpdateWord(db, word, review_scheduler.Good); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	words, err := exportVocabulary(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(words) != 3 {
+		t.Fatal("expected all reviewed words:", words)
+	}
+
+	// Sorted by word, and not in the course.
+	if words[0].Word.Word != "adiós" || words[0].FrequencyClass >= 0 || words[0].Sentence != "" {
+		t.Fatal("expected word without course data:", words[0])
+	}
+	// First sentence in the course, not the first one inserted into
+	// `contains`.
+	if words[1].Word.Word != "hola" || words[1].FrequencyClass != 2 || words[1].Sentence != "Hola, mundo." || words[1].Translation != "Hello, world." {
+		t.Fatal("unexpected course data:", words[1])
+	}
+	if words[2].Word.Word != "mundo" || words[2].Sentence != "Hola, mundo." {
+		t.Fatal("unexpected course data:", words[2])
+	}
+	if words[1].Interval <= 0 || words[1].Due.Before(words[1].Reviewed) {
+		t.Fatal("expected interval and due date:", words[1])
+	}
+
+	var buf bytes.Buffer
+	if err := writeVocabularyCSV(&buf, words, '\t'); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	r := csv.NewReader(&buf)
+	r.Comma = '\t'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(records) != 4 || records[0][0] != "word" || len(records[0]) != len(exportHeader) {
+		t.Fatal("expected header and one row per word:", records)
+	}
+	if records[1][5] != "" || records[2][5] != "2" || records[2][7] != "Hello, world." {
+		t.Fatal("unexpected rows:", records)
+	}
+}
+
+func TestVocabularyDeckEscapesHTML(t *testing.T) {
+	t.Parallel()
+
+	var word exportedWord
+	word.Word.Word = "a<b>"
+	deck := vocabularyDeck("polycloze::test", []exportedWord{word})
+	if len(deck.Notes) != 1 || deck.Notes[0].Fields[0] != "a&lt;b&gt;" {
+		t.Fatal("expected fields to be escaped:", deck.Notes)
+	}
+}
+
+func TestVocabularyExportErrors(t *testing.T) {
+	// Errors should be JSON even if the client asked for a file.
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route(apiPrefix, v1Router)
+
+	req := httptest.NewRequest("GET", "/api/v1/courses/eng/spa/vocab/export?format=csv", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if e := decodeError(t, w); w.Code != http.StatusUnauthorized || e.Code != errUnauthorized {
+		t.Fatal("expected JSON error:", w.Code, e)
+	}
+}
@@ -10,6 +10,8 @@ import {
     ItemsSchema,
     Language,
     LanguagesSchema,
+    Lemma,
+    LemmasSchema,
     RandomSentence,
     RandomSentencesSchema,
     ReviewSchema,
@@ -25,7 +27,7 @@ type FetchVocabularyOptions = {
     // Search params
     limit?: number;  // Max number of items to fetch
     after?: string;  // Last item to exclude from query
-    sortBy?: "word" | "reviewed" | "due" | "strength";
+    sortBy?: "word" | "learned" | "reviewed" | "due" | "strength";
 };
 
 function defaultFetchVocabularyOptions(): FetchVocabularyOptions {
@@ -40,7 +42,7 @@ function defaultFetchVocabularyOptions(): FetchVocabularyOptions {
 
 export async function fetchVocabulary(options: FetchVocabularyOptions = {}): Promise<Word[]> {
     const { l1, l2, limit, after, sortBy } = {...defaultFetchVocabularyOptions(), ...options};
-    const url = resolve(`/${l1}/${l2}/vocab`);
+    const url = resolve(`/api/v1/courses/${l1}/${l2}/vocab`);
     setParams(url, { after, limit, sortBy });
 
     const json = await fetchJson<VocabularySchema>(url, {
@@ -49,6 +51,45 @@ export async function fetchVocabulary(options: FetchVocabularyOptions = {}): Pro
     return json.words || [];
 }
 
+export type ExportFormat = "csv" | "tsv" | "apkg";
+
+// Returns URL for downloading all reviewed words.
+export function vocabularyExportURL(format: ExportFormat): URL {
+    const l1 = getL1().code;
+    const l2 = getL2().code;
+    const url = resolve(`/api/v1/courses/${l1}/${l2}/vocab/export`);
+    setParams(url, { format });
+    return url;
+}
+
+type FetchLemmasOptions = {
+    // Path params
+    l1?: string;    // L1 code
+    l2?: string;    // L2 code
+
+    // Search params
+    limit?: number;  // Max number of lemmas to fetch
+    after?: string;  // Last lemma to exclude from query
+};
+
+// Fetches reviewed words grouped by lemma.
+export async function fetchLemmas(options: FetchLemmasOptions = {}): Promise<Lemma[]> {
+    const { l1, l2, limit, after } = {
+        l1: getL1().code,
+        l2: getL2().code,
+        limit: 50,
+        after: "",
+        ...options,
+    };
+    const url = resolve(`/api/v1/courses/${l1}/${l2}/vocab`);
+    setParams(url, { after, limit, groupBy: "lemma" });
+
+    const json = await fetchJson<LemmasSchema>(url, {
+        mode: "cors" as RequestMode,
+    });
+    return json.lemmas || [];
+}
+
 type FetchActivityHistoryOptions = {
     // Path params
     l1?: string;
@@ -65,15 +106,14 @@ function defaultFetchActivityHistoryOptions(): FetchActivityHistoryOptions {
 // Fetches student's activity history over the past year.
 export async function fetchActivityHistory(options: FetchActivityHistoryOptions = {}): Promise<ActivityHistory> {
     const {l1, l2} = {...defaultFetchActivityHistoryOptions(), ...options};
-    const url = resolve(`/${l1}/${l2}/activity`);
+    const url = resolve(`/api/v1/courses/${l1}/${l2}/activity`);
     return await fetchJson<ActivityHistory>(url, {
         mode: "cors" as RequestMode,
     });
 }
 
 export async function fetchCourses(): Promise<Course[]> {
-    const url = resolve("/api/courses");
-    setParams(url, { t: "20221114" });
+    const url = resolve("/api/v1/courses");
     const json = await fetchJson<CoursesSchema>(url, {
         mode: "cors" as RequestMode,
     });
@@ -82,8 +122,7 @@ export async function fetchCourses(): Promise<Course[]> {
 
 // Fetches list of supported languages (L1).
 export async function fetchLanguages(): Promise<Language[]> {
-    const url = resolve("/api/languages");
-    setParams(url, { t: "20221114" });
+    const url = resolve("/api/v1/languages");
     const json = await fetchJson<LanguagesSchema>(url, {
         mode: "cors" as RequestMode,
     });
@@ -111,7 +150,7 @@ function defaultFetchItemsOptions(): FetchItemsOptions {
 
 export async function fetchItems(options: FetchItemsOptions = {}): Promise<Item[]> {
     const { l1, l2, n, x } = {...defaultFetchItemsOptions(), ...options};
-    const url = resolve(`/${l1}/${l2}`);
+    const url = resolve(`/api/v1/courses/${l1}/${l2}/flashcards`);
     setParams(url, { n, x });
 
     const json = await fetchJson<ItemsSchema>(url, {
@@ -140,7 +179,7 @@ export async function fetchSentences(options: FetchSentencesOptions = {}): Promi
         throw new Error("l1 and l2 required");
     }
 
-    const url = resolve("/api/sentences");
+    const url = resolve("/api/v1/sentences");
     setParams(url, {l1, l2, limit});
 
     const json = await fetchJson<RandomSentencesSchema>(url, {
@@ -169,14 +208,32 @@ function setParams(url: URL, params: Params) {
     }
 }
 
-export function submitReview(word: string, correct: boolean): Promise<ReviewSchema> {
+export type Grade = "again" | "hard" | "good" | "easy";
+
+export type Review = {
+    word: string;
+    correct: boolean;
+    grade?: Grade;  // Overrides `correct`
+
+    // Optional, recorded in the review history.
+    latency?: number;   // Time to answer in milliseconds
+    hints?: number;     // Number of hints (e.g. typo warnings)
+    digraphs?: number;  // Number of digraphs typed
+
+    // Optional, only gets logged.
+    sentenceID?: number;
+    answer?: string;        // What the student typed
+    clientTime?: string;    // ISO 8601
+};
+
+export function submitReview(review: Review): Promise<ReviewSchema> {
     const l1 = getL1().code;
     const l2 = getL2().code;
 
-    const url = resolve(`/${l1}/${l2}`);
+    const url = resolve(`/api/v1/courses/${l1}/${l2}/reviews`);
     const data = {
         reviews: [
-            { word, correct },
+            { clientTime: new Date().toISOString(), ...review },
         ],
     };
     return submitJson<ReviewSchema>(url, data);
@@ -112,6 +112,11 @@ export function evaluateInput(input: HTMLInputElement, part: PartWithAnswers): S
     return "incorrect";
 }
 
+// Returns number of digraphs typed into blank.
+export function countDigraphs(input: HTMLInputElement): number {
+    return Number(input.dataset.digraphs || 0);
+}
+
 // Checks if text is capitalized.
 function isCapitalized(text: string): boolean {
     text = text.trimStart();
@@ -131,7 +136,12 @@ export function createBlank(part: PartWithAnswers): [HTMLInputElement, () => voi
     input.classList.add("blank");
 
     input.addEventListener("input", () => {
-        input.value = substituteDigraphs(input.value);
+        const value = substituteDigraphs(input.value);
+        if (value !== input.value) {
+            // Count digraphs the student typed.
+            input.dataset.digraphs = String(countDigraphs(input) + 1);
+            input.value = value;
+        }
     });
     return [input, () => resizeInput(input, text)];
 }
@@ -7,6 +7,19 @@ export function csrf(): string {
     return (meta as HTMLMetaElement).content;
 }
 
+// Returns csrf token from double-submit cookie, or from header meta if there's
+// no cookie.
+// The cookie always has the latest token, even if the page is old.
+export function csrfCookie(): string {
+    for (const entry of document.cookie.split(";")) {
+        const [name, value] = entry.trim().split("=");
+        if (name === "csrf-token" && value) {
+            return decodeURIComponent(value);
+        }
+    }
+    return csrf();
+}
+
 export function createCSRFTokenInput(): HTMLInputElement {
     const input = document.createElement("input");
     input.type = "hidden";
@@ -1,6 +1,6 @@
 // Contains functions for getting data from the server and from localStorage.
 
-import { csrf } from "./csrf";
+import { csrfCookie } from "./csrf";
 
 const src = findServer();
 
@@ -19,7 +19,7 @@ export function submitJson<T>(url: string | URL, data: unknown): Promise<T> {
         headers: {
             Accept: "application/json",
             "Content-Type": "application/json",
-            "X-CSRF-Token": csrf(),
+            "X-CSRF-Token": csrfCookie(),
         },
         method: "POST",
         mode: "cors" as RequestMode,
@@ -21,9 +21,24 @@ export type LanguagesSchema = {
   languages: Language[];
 };
 
+export type CourseStats = {
+    words: number;
+    sentences: number;
+    frequencyClasses: number[];    // # of words in each frequency class
+};
+
+export type CourseMetadata = {
+    builderVersion?: string;
+    datasetDate?: string;    // YYYY-MM-DD
+    contentHash: string;     // course version
+    license?: string;
+};
+
 export type Course = {
     l1: Language;
     l2: Language;
+    stats: CourseStats;
+    metadata: CourseMetadata;
 };
 
 export type CoursesSchema = {
@@ -41,6 +56,19 @@ export type Word = {
 // from /<l1>/<l2>/vocab
 export type VocabularySchema = {
   words: Word[];
+  total: number;
+  nextCursor?: string;
+};
+
+export type Lemma = {
+  lemma: string;
+  pos?: string;     // part of speech
+  forms: Word[];
+};
+
+// from /<l1>/<l2>/vocab?groupBy=lemma
+export type LemmasSchema = {
+  lemmas: Lemma[];
 };
 
 export type Activity = {
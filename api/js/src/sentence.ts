@@ -2,6 +2,7 @@ import "./sentence.css";
 import { submitReview } from "./api";
 import {
     compare,
+    countDigraphs,
     createBlank,
     evaluateInput,
     hasAnswers,
@@ -63,6 +64,15 @@ export function createSentence(sentence: Sentence, done: () => void, enable: (ok
     const [link, render] = createSentenceLink(sentence);
     div.prepend(link);
 
+    // Time to answer starts when the student starts answering.
+    let start = performance.now();
+    div.addEventListener("focusin", () => {
+        start = performance.now();
+    }, { once: true });
+
+    // Number of times each blank was marked "almost" or "incorrect".
+    const hints = inputs.map(() => 0);
+
     const check = () => {
         // Make sure everything has been filled.
         if (inputs.some(input => input.value === "")) {
@@ -71,7 +81,9 @@ export function createSentence(sentence: Sentence, done: () => void, enable: (ok
 
         // Time to check.
         for (const [i, input] of inputs.entries()) {
-            evaluateInput(input, blankParts[i]);
+            if (evaluateInput(input, blankParts[i]) !== "correct") {
+                hints[i]++;
+            }
         }
 
         // Check if everything is correct.
@@ -83,21 +95,31 @@ export function createSentence(sentence: Sentence, done: () => void, enable: (ok
         render();
 
         // Upload results.
+        const latency = Math.round(performance.now() - start);
         for (const [i, input] of inputs.entries()) {
             const answer = input.value;
 
             const correct = !input.classList.contains("incorrect");
-            const save = edit();
-            submitReview(answer, correct).then(result => {
-                // Normalize word.
-                let word = answer;
-                for (const answer of blankParts[i].answers) {
-                    if (compare(input.value, answer.text) === 0) {
-                        word = answer.normalized;
-                        break;
-                    }
+
+            // Normalize word.
+            let word = answer;
+            for (const answer of blankParts[i].answers) {
+                if (compare(input.value, answer.text) === 0) {
+                    word = answer.normalized;
+                    break;
                 }
+            }
 
+            const save = edit();
+            submitReview({
+                word,
+                correct,
+                latency,
+                hints: hints[i],
+                digraphs: countDigraphs(input),
+                answer,
+                sentenceID: sentence.id,
+            }).then(result => {
                 announceResult(word, correct);
                 save();
                 clearBuffer(result.frequencyClass);
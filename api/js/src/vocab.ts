@@ -1,5 +1,5 @@
 import "./vocab.css";
-import { fetchVocabulary } from "./api";
+import { ExportFormat, fetchVocabulary, vocabularyExportURL } from "./api";
 import { createButton } from "./button";
 import { createDateTime } from "./datetime";
 import { getL2 } from "./language";
@@ -63,6 +63,15 @@ function createVocabularyListBody(tts?: TTS): [HTMLDivElement, (words: Word[]) =
     return [createScrollingTable(table), update];
 }
 
+function createExportLink(content: string, format: ExportFormat): HTMLAnchorElement {
+    const a = document.createElement("a");
+    a.textContent = content;
+    a.href = vocabularyExportURL(format).href;
+    a.download = "";
+    a.style.margin = "1em 0";
+    return a;
+}
+
 function createParagraph(content: string): HTMLParagraphElement {
     const p = document.createElement("p");
     p.textContent = content;
@@ -83,6 +92,10 @@ export async function createVocabularyList(tts?: TTS): Promise<HTMLDivElement> {
 
     const button = p.appendChild(createButton("Load more", loadMore));
     button.style.margin = "1em 0";
+    p.append(
+        createExportLink("Download CSV", "csv"),
+        createExportLink("Download Anki deck", "apkg"),
+    );
 
     div.appendChild(p);
 
@@ -5,10 +5,11 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
+	"mime"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 )
 
 // Sends JSON response.
@@ -17,32 +18,102 @@ func sendJSON(w http.ResponseWriter, data any) {
 	bytes, err := json.Marshal(data)
 	if err != nil {
 		log.Println("failed to encode to JSON:", err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		sendInternalError(w)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if _, err := w.Write(bytes); err != nil {
 		log.Println("failed to send JSON:", err)
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
 	}
 }
 
-// Writes JSON to file.
-func writeJSON(name string, data any) error {
-	bytes, err := json.Marshal(data)
+// Error in JSON API responses.
+type APIError struct {
+	// Machine-readable error code, e.g. "not_found".
+	Code string `json:"code"`
+
+	// Human-readable explanation.
+	Message string `json:"message"`
+}
+
+// Error codes of JSON API errors.
+const (
+	errBadRequest           = "bad_request"
+	errUnauthorized         = "unauthorized"
+	errForbidden            = "forbidden"
+	errNotFound             = "not_found"
+	errMethodNotAllowed     = "method_not_allowed"
+	errNotAcceptable        = "not_acceptable"
+	errUnsupportedMediaType = "unsupported_media_type"
+	errInvalidParameter     = "invalid_parameter"
+	errInternal             = "internal_error"
+)
+
+// Sends JSON error envelope, e.g.
+// {"error": {"code": "not_found", "message": "Course not found."}}
+// The caller shouldn't write to w afterwards.
+func sendError(w http.ResponseWriter, status int, code, message string) {
+	bytes, err := json.Marshal(ErrorResponse{
+		Error: APIError{Code: code, Message: message},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to encode to JSON: %v", err)
+		log.Println("failed to encode to JSON:", err)
+		http.Error(w, message, status)
+		return
 	}
 
-	f, err := os.Create(name)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if _, err := w.Write(bytes); err != nil {
+		log.Println("failed to send JSON:", err)
 	}
-	defer f.Close()
+}
+
+// Sends 500 Internal Server Error.
+func sendInternalError(w http.ResponseWriter) {
+	sendError(w, http.StatusInternalServerError, errInternal, "Something went wrong.")
+}
+
+// Sends 401 Unauthorized.
+func sendUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	sendError(w, http.StatusUnauthorized, errUnauthorized, "Sign in or use an API token.")
+}
 
-	if _, err := f.Write(bytes); err != nil {
-		return fmt.Errorf("failed to write JSON: %v", err)
+// Sends 422 Unprocessable Entity for invalid query parameter or request body.
+func sendInvalid(w http.ResponseWriter, message string) {
+	sendError(w, http.StatusUnprocessableEntity, errInvalidParameter, message)
+}
+
+// Checks if client accepts JSON responses.
+// Clients that don't send an Accept header accept anything.
+func acceptsJSON(r *http.Request) bool {
+	header := r.Header.Values("Accept")
+	if len(header) == 0 {
+		return true
+	}
+	for _, value := range header {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q <= 0 {
+				continue
+			}
+			switch mediaType {
+			case "application/json", "application/*", "*/*":
+				return true
+			}
+		}
 	}
-	return nil
+	return false
+}
+
+// Checks if request body is JSON.
+func hasJSONBody(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
 }
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Rate limiting of password checks.
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Password attempt reserved with reserveAttempt.
+type passwordAttempt struct {
+	r        *http.Request
+	keys     []string
+	reserved bool
+	failed   bool
+}
+
+// Reserves password attempt from the client (and for the username, if
+// non-empty), unless attempts are blocked.
+// The attempt counts as a failure until it gets released, so that concurrent
+// attempts can't all get past the limit.
+// Returns a message for the user if attempts are blocked.
+// Fails open if the reservation itself fails, so that users can still sign in.
+func reserveAttempt(r *http.Request, username string) (*passwordAttempt, string, bool) {
+	a := passwordAttempt{r: r, keys: auth.LimitKeys(sessions.ClientIP(r), username)}
+	wait, err := auth.ReserveAttempt(auth.GetDB(r), a.keys)
+	if err != nil {
+		log.Println(err)
+		return &a, "", true
+	}
+	if wait > 0 {
+		return &a, retryMessage(wait), false
+	}
+	a.reserved = true
+	return &a, "", true
+}
+
+// Keeps the attempt counted as a failure.
+func (a *passwordAttempt) fail() {
+	a.failed = true
+}
+
+// Undoes the reservation, unless the attempt failed.
+func (a *passwordAttempt) release() {
+	if !a.reserved || a.failed {
+		return
+	}
+	a.reserved = false
+	if err := auth.ReleaseAttempt(auth.GetDB(a.r), a.keys); err != nil {
+		log.Println(err)
+	}
+}
+
+// Clears failed attempts for username after a successful password check.
+func resetLimit(r *http.Request, username string) {
+	for _, key := range auth.LimitKeys("", username) {
+		if err := auth.ResetLimit(auth.GetDB(r), key); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func retryMessage(wait time.Duration) string {
+	if wait < time.Minute {
+		seconds := int(math.Ceil(wait.Seconds()))
+		return fmt.Sprintf("Too many attempts. Try again in %v second(s).", seconds)
+	}
+	minutes := int(math.Ceil(wait.Minutes()))
+	return fmt.Sprintf("Too many attempts. Try again in %v minute(s).", minutes)
+}
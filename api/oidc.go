@@ -0,0 +1,262 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// OpenID Connect sign-in handlers.
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/oidc"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Name of cookie that binds a pending sign-in to the browser that started it.
+const oidcCookieName = "oidc-state"
+
+// How long users have to finish signing in at the provider.
+const oidcLoginTimeout = 10 * time.Minute
+
+// Nil if OIDC sign-in isn't configured.
+var oidcProvider *oidc.Provider
+
+// Sign-in that was started but not yet completed.
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	userID   int // Signed-in user who wants to link an identity, or -1.
+	expires  time.Time
+}
+
+// Pending sign-ins, keyed by state.
+type pendingLogins struct {
+	mu     sync.Mutex
+	logins map[string]pendingLogin
+}
+
+var oidcLogins = pendingLogins{logins: make(map[string]pendingLogin)}
+
+func (p *pendingLogins) add(state string, login pendingLogin) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Forget expired sign-ins.
+	now := time.Now()
+	for key, value := range p.logins {
+		if now.After(value.expires) {
+			delete(p.logins, key)
+		}
+	}
+	p.logins[state] = login
+}
+
+// Removes and returns pending sign-in.
+// Each state can only be used once.
+func (p *pendingLogins) take(state string) (pendingLogin, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	login, ok := p.logins[state]
+	delete(p.logins, state)
+	if !ok || time.Now().After(login.expires) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+// Sets up OIDC sign-in.
+func setupOIDC(ctx context.Context, config *oidc.Config) error {
+	if config == nil {
+		oidcProvider = nil
+		return nil
+	}
+	provider, err := oidc.Discover(ctx, *config)
+	if err != nil {
+		return err
+	}
+	oidcProvider = provider
+	return nil
+}
+
+// Redirects user to the provider's sign-in page.
+// If the user is already signed in, the external identity gets linked to the
+// user's account.
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	login := pendingLogin{
+		userID:  -1,
+		expires: time.Now().Add(oidcLoginTimeout),
+	}
+	if s, err := sessions.ResumeSession(sessionStore(r), w, r); err == nil && isSignedIn(s) {
+		login.userID = s.Data["userID"].(int)
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	if login.nonce, err = oidc.RandomString(); err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	if login.verifier, err = oidc.RandomString(); err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	oidcLogins.add(state, login)
+
+	// The provider redirects back with a cross-site top-level navigation, so
+	// the cookie can't be SameSite=Strict.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    state,
+		Path:     "/oidc",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	http.Redirect(w, r, oidcProvider.AuthCodeURL(state, login.nonce, login.verifier), http.StatusFound)
+}
+
+// Picks username for new user from ID token claims.
+func preferredUsername(claims oidc.Claims) string {
+	if claims.PreferredUsername != "" {
+		return claims.PreferredUsername
+	}
+	if claims.Email != "" && claims.EmailVerified {
+		name, _, _ := strings.Cut(claims.Email, "@")
+		return name
+	}
+	return claims.Subject
+}
+
+// Completes sign-in after the provider redirects back.
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Delete state cookie whether the sign-in succeeds or not.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    "",
+		Path:     "/oidc",
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Secure:   true,
+	})
+
+	q := r.URL.Query()
+	state := q.Get("state")
+	c, err := r.Cookie(oidcCookieName)
+	if err != nil || state == "" || c.Value != state {
+		http.Error(w, "Sign-in failed. Please try again.", http.StatusBadRequest)
+		return
+	}
+	login, ok := oidcLogins.take(state)
+	if !ok {
+		http.Error(w, "Sign-in expired. Please try again.", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		log.Printf("OIDC sign-in failed: %v: %v\n", e, q.Get("error_description"))
+		http.Error(w, "Sign-in failed. Please try again.", http.StatusUnauthorized)
+		return
+	}
+
+	raw, err := oidcProvider.Exchange(r.Context(), q.Get("code"), login.verifier)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Sign-in failed. Please try again.", http.StatusUnauthorized)
+		return
+	}
+	claims, err := oidcProvider.Verify(r.Context(), raw, login.nonce)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Sign-in failed. Please try again.", http.StatusUnauthorized)
+		return
+	}
+
+	db := auth.GetDB(r)
+	issuer := oidcProvider.Issuer()
+	userID, username, err := auth.FindIdentity(db, issuer, claims.Subject)
+	switch {
+	case errors.Is(err, auth.ErrDisabled):
+		http.Error(w, "This account has been disabled.", http.StatusForbidden)
+		return
+	case err == nil && login.userID >= 0 && login.userID != userID:
+		http.Error(w, "This account is already linked to another user.", http.StatusConflict)
+		return
+	case err == nil:
+		// Sign in as linked user.
+	case login.userID >= 0:
+		userID = login.userID
+		if err := auth.LinkIdentity(db, userID, issuer, claims.Subject); err != nil {
+			http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+			return
+		}
+		if err := db.QueryRow(`SELECT username FROM user WHERE id = ?`, userID).Scan(&username); err != nil {
+			http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+			return
+		}
+	default:
+		userID, username, err = auth.RegisterIdentity(db, preferredUsername(claims), issuer, claims.Subject)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+			return
+		}
+		audit(r, auth.EventRegister, userID, username, "oidc")
+	}
+
+	hasTOTP, err := auth.HasTOTP(db, userID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+
+	s, err := sessions.StartSession(sessionStore(r), w, r)
+	if err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	if hasTOTP {
+		// The provider's MFA doesn't replace the user's own 2FA.
+		requestTwoFactorCode(w, s, userID, username, "oidc", false)
+		return
+	}
+	s.Data["userID"] = userID
+	s.Data["username"] = username
+	if err := sessions.SaveData(sessionStore(r), w, s); err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	audit(r, auth.EventSignIn, userID, username, "oidc")
+	if err := initUserDirectory(userID); err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+
+	// The session cookie is SameSite=Strict, so browsers won't send it if we
+	// redirect right away, because the navigation started at the provider.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write([]byte(`<!DOCTYPE html><meta http-equiv="refresh" content="0; url=/">`)); err != nil {
+		log.Println(err)
+	}
+}
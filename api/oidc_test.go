@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/oidc"
+	"github.com/lggruspe/polycloze/oidc/oidctest"
+)
+
+// Goes through OIDC sign-in against mock issuer.
+// Returns the callback response.
+func oidcSignIn(t *testing.T, r http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatal("expected redirect to issuer:", w.Code)
+	}
+	cookies := w.Result().Cookies()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	resp.Body.Close()
+
+	req := httptest.NewRequest("GET", resp.Header.Get("Location"), nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	// NOTE Not parallel, because it sets the global OIDC provider.
+	issuer := oidctest.NewIssuer("polycloze")
+	defer issuer.Close()
+	issuer.SetSubject("1234", map[string]any{"preferred_username": "foo"})
+
+	err := setupOIDC(context.TODO(), &oidc.Config{
+		Issuer:      issuer.URL(),
+		ClientID:    "polycloze",
+		RedirectURL: "http://localhost/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer setupOIDC(context.TODO(), nil)
+
+	db := testDB()
+	defer db.Close()
+
+	// "foo" is taken, so the new user should get another username.
+	if err := auth.Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/oidc/login", handleOIDCLogin)
+	r.HandleFunc("/oidc/callback", handleOIDCCallback)
+
+	w := oidcSignIn(t, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("expected sign-in to succeed:", w.Code, w.Body.String())
+	}
+
+	id, username, err := auth.FindIdentity(db, issuer.URL(), "1234")
+	if err != nil {
+		t.Fatal("expected identity to be linked:", err)
+	}
+	if id == 1 || username != "foo-2" {
+		t.Fatal("expected new user to be registered:", id, username)
+	}
+
+	// Callbacks without the state cookie should fail.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/oidc/callback?state=foo&code=bar", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatal("expected callback without state cookie to fail:", w.Code)
+	}
+
+	// Signing in again should use the same user.
+	if w := oidcSignIn(t, r); w.Code != http.StatusOK {
+		t.Fatal("expected sign-in to succeed:", w.Code)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM user`).Scan(&count); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if count != 2 {
+		t.Fatal("expected no new user to be registered:", count)
+	}
+
+	// Users with 2FA should still be asked for their code.
+	enableTOTP(t, db, id)
+	w = oidcSignIn(t, r)
+	if !strings.Contains(w.Body.String(), `action="/signin/verify"`) {
+		t.Fatal("expected to be asked for 2FA code:", w.Body.String())
+	}
+	cookie := responseSessionCookie(w)
+	if cookie == nil || isSessionSignedIn(t, db, cookie) {
+		t.Fatal("expected session to not be signed in before 2FA check")
+	}
+}
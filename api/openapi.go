@@ -0,0 +1,401 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// OpenAPI document of the JSON API.
+// Schemas are generated from the Go types that handlers send and receive, so
+// the document can't fall behind the handlers.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSON object in the OpenAPI document.
+type object = map[string]any
+
+// Generates JSON schemas from Go types.
+// Named structs become components that get referenced with $ref.
+type schemaGenerator struct {
+	components object
+}
+
+// Component name of named type, e.g. "flashcards.Item".
+func componentName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) object {
+	if t == timeType {
+		return object{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.schema(t.Elem())
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return object{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			// Reserve name first in case the type is recursive.
+			g.components[name] = nil
+			g.components[name] = g.structSchema(t)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	default:
+		panic(fmt.Errorf("can't generate schema for type: %v", t))
+	}
+}
+
+// Generates schema of struct from its fields and their JSON tags.
+// Fields without omitempty are required.
+func (g *schemaGenerator) structSchema(t reflect.Type) object {
+	properties := make(object)
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	schema := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Returns reference to schema of the value's type.
+func (g *schemaGenerator) ref(value any) object {
+	return g.schema(reflect.TypeOf(value))
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+// Describes response with JSON body.
+func (g *schemaGenerator) response(description string, body any) object {
+	return object{
+		"description": description,
+		"content":     jsonContent(g.ref(body)),
+	}
+}
+
+func queryParameter(name, description string, required bool, schema object) object {
+	return object{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"required":    required,
+		"schema":      schema,
+	}
+}
+
+func pathParameter(name, description string) object {
+	return object{
+		"name":        name,
+		"in":          "path",
+		"description": description,
+		"required":    true,
+		"schema":      object{"type": "string"},
+	}
+}
+
+// Error responses by status code.
+var errorDescriptions = map[int]string{
+	http.StatusBadRequest:           "Request body isn't valid JSON.",
+	http.StatusUnauthorized:         "Not signed in, or invalid API token.",
+	http.StatusForbidden:            "Invalid CSRF token, or the API token's scope doesn't allow the request.",
+	http.StatusNotFound:             "Course not found.",
+	http.StatusNotAcceptable:        "Client doesn't accept JSON.",
+	http.StatusUnsupportedMediaType: "Request body isn't application/json.",
+	http.StatusUnprocessableEntity:  "Invalid query parameter or field.",
+}
+
+// Describes operation that responds with a JSON body.
+// errors: status codes of possible error responses
+func (g *schemaGenerator) operation(summary string, parameters []object, body any, errors ...int) object {
+	return download(summary, parameters, g.response("OK", body), append(errors, http.StatusNotAcceptable)...)
+}
+
+// Describes operation that responds with a file.
+// Errors are still JSON, but the operation doesn't check the Accept header.
+func download(summary string, parameters []object, ok object, errors ...int) object {
+	responses := object{"200": ok}
+	for _, status := range errors {
+		responses[fmt.Sprint(status)] = object{"$ref": fmt.Sprintf("#/components/responses/Error%v", status)}
+	}
+	op := object{
+		"summary":   summary,
+		"responses": responses,
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	return op
+}
+
+// Marks operation as not needing authentication.
+func unauthenticated(op object) object {
+	op["security"] = []object{}
+	return op
+}
+
+// Generates the OpenAPI document.
+// Paths are relative to apiPrefix.
+func openAPIDocument() object {
+	g := schemaGenerator{components: make(object)}
+
+	courseParameters := []object{
+		pathParameter("l1", "ISO 639-3 code of the course's base language"),
+		pathParameter("l2", "ISO 639-3 code of the course's target language"),
+	}
+	withCourseParameters := func(parameters ...object) []object {
+		return append(append([]object(nil), courseParameters...), parameters...)
+	}
+	languageParameter := func(name, description string) object {
+		return queryParameter(name, description, true, object{"type": "string"})
+	}
+	integer := object{"type": "integer"}
+	str := object{"type": "string"}
+	timestamp := object{
+		"type":        "string",
+		"description": "Date (YYYY-MM-DD) or RFC 3339 timestamp",
+	}
+
+	postReviews := g.operation(
+		"Uploads reviews",
+		courseParameters,
+		ReviewResponse{},
+		http.StatusBadRequest,
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusNotFound,
+		http.StatusUnsupportedMediaType,
+		http.StatusUnprocessableEntity,
+	)
+	postReviews["requestBody"] = object{
+		"required": true,
+		"content":  jsonContent(g.ref(Reviews{})),
+	}
+	postReviews["parameters"] = withCourseParameters(object{
+		"name":        "X-CSRF-Token",
+		"in":          "header",
+		"description": "Required with session cookies. Has to match the csrf-token cookie.",
+		"required":    false,
+		"schema":      object{"type": "string"},
+	})
+
+	vocab := g.operation(
+		"Lists reviewed words",
+		withCourseParameters(
+			queryParameter("limit", "Max number of results (1-100)", false, integer),
+			queryParameter("cursor", "nextCursor of the previous page", false, str),
+			queryParameter("after", "Only include results after this word or lemma (deprecated, use cursor)", false, str),
+			queryParameter("sortBy", "Sort key", false, object{
+				"type": "string",
+				"enum": []string{"word", "learned", "reviewed", "due", "strength"},
+			}),
+			queryParameter("order", "Sort order", false, object{
+				"type": "string",
+				"enum": []string{"asc", "desc"},
+			}),
+			queryParameter("dueAfter", "Only include words due at or after this date or time", false, timestamp),
+			queryParameter("dueBefore", "Only include words due before this date or time", false, timestamp),
+			queryParameter("learnedAfter", "Only include words learned at or after this date or time", false, timestamp),
+			queryParameter("learnedBefore", "Only include words learned before this date or time", false, timestamp),
+			queryParameter("minStrength", "Min strength (inclusive)", false, integer),
+			queryParameter("maxStrength", "Max strength (inclusive)", false, integer),
+			queryParameter("prefix", "Only include words that start with this prefix", false, str),
+			queryParameter("groupBy", "Group words by lemma (only limit and after are allowed)", false, object{
+				"type": "string",
+				"enum": []string{"lemma"},
+			}),
+		),
+		VocabularyResponse{},
+		http.StatusUnauthorized,
+		http.StatusNotFound,
+		http.StatusUnprocessableEntity,
+	)
+	vocab["responses"].(object)["200"] = object{
+		"description": "OK. Words are grouped into lemmas if groupBy is lemma.",
+		"content": jsonContent(object{
+			"oneOf": []object{g.ref(VocabularyResponse{}), g.ref(LemmasResponse{})},
+		}),
+	}
+
+	export := download(
+		"Exports reviewed words",
+		withCourseParameters(
+			queryParameter("format", "File format (default: csv)", false, object{
+				"type": "string",
+				"enum": []string{"csv", "tsv", "apkg"},
+			}),
+		),
+		object{
+			"description": "All reviewed words, with their frequency class and an example sentence. apkg files are Anki decks.",
+			"content": object{
+				"text/csv":                  object{"schema": object{"type": "string"}},
+				"text/tab-separated-values": object{"schema": object{"type": "string"}},
+				"application/zip":           object{"schema": object{"type": "string", "format": "binary"}},
+			},
+		},
+		http.StatusUnauthorized,
+		http.StatusNotFound,
+		http.StatusUnprocessableEntity,
+	)
+
+	paths := object{
+		"/languages": object{
+			"get": unauthenticated(g.operation("Lists L1 languages of installed courses", nil, LanguagesResponse{})),
+		},
+		"/courses": object{
+			"get": unauthenticated(g.operation("Lists installed courses", nil, CoursesResponse{})),
+		},
+		"/sentences": object{
+			"get": unauthenticated(g.operation(
+				"Gets random sentences from course",
+				[]object{
+					languageParameter("l1", "ISO 639-3 code of the course's base language"),
+					languageParameter("l2", "ISO 639-3 code of the course's target language"),
+					queryParameter("limit", "Number of sentences (1-1000)", false, integer),
+				},
+				SentencesResponse{},
+				http.StatusNotFound,
+				http.StatusUnprocessableEntity,
+			)),
+		},
+		"/courses/{l1}/{l2}/flashcards": object{
+			"get": g.operation(
+				"Gets flashcards to study",
+				withCourseParameters(
+					queryParameter("n", "Number of flashcards (1-100)", false, integer),
+					queryParameter("x", "Words to exclude", false, object{
+						"type":  "array",
+						"items": object{"type": "string"},
+					}),
+				),
+				FlashcardsResponse{},
+				http.StatusUnauthorized,
+				http.StatusNotFound,
+				http.StatusUnprocessableEntity,
+			),
+		},
+		"/courses/{l1}/{l2}/reviews": object{
+			"post": postReviews,
+		},
+		"/courses/{l1}/{l2}/vocab": object{
+			"get": vocab,
+		},
+		"/courses/{l1}/{l2}/vocab/export": object{
+			"get": export,
+		},
+		"/courses/{l1}/{l2}/activity": object{
+			"get": g.operation(
+				"Gets review activity",
+				courseParameters,
+				ActivityResponse{},
+				http.StatusUnauthorized,
+				http.StatusNotFound,
+			),
+		},
+	}
+
+	errorResponses := make(object)
+	errorSchema := g.ref(ErrorResponse{})
+	for status, description := range errorDescriptions {
+		errorResponses[fmt.Sprintf("Error%v", status)] = object{
+			"description": description,
+			"content":     jsonContent(errorSchema),
+		}
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "polycloze",
+			"version": "1",
+		},
+		"servers": []object{{"url": apiPrefix}},
+		"paths":   paths,
+		"components": object{
+			"schemas":   g.components,
+			"responses": errorResponses,
+			"securitySchemes": object{
+				"token": object{"type": "http", "scheme": "bearer"},
+				"session": object{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "id",
+				},
+			},
+		},
+		"security": []object{{"token": []string{}}, {"session": []string{}}},
+	}
+}
+
+// Encodes OpenAPI document.
+func encodeOpenAPIDocument() ([]byte, error) {
+	body, err := json.MarshalIndent(openAPIDocument(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %v", err)
+	}
+	return append(body, '\n'), nil
+}
+
+// Serves OpenAPI document.
+func handleOpenAPI() (http.HandlerFunc, error) {
+	body, err := encodeOpenAPIDocument()
+	if err != nil {
+		return nil, err
+	}
+	doc := newDocument(body)
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONDocument(w, r, doc)
+	}, nil
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/review_scheduler"
+	"github.com/lggruspe/polycloze/word_scheduler"
+)
+
+var update = flag.Bool("update", false, "update docs/openapi.json")
+
+// Published copy of the OpenAPI document.
+const openAPIPath = "../docs/openapi.json"
+
+func TestOpenAPIDocumentUpToDate(t *testing.T) {
+	// Fails if the JSON types of handlers changed, but the published document
+	// wasn't updated.
+	// Run `go test ./api -run TestOpenAPIDocumentUpToDate -update` after
+	// reviewing the changes.
+	body, err := encodeOpenAPIDocument()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if *update {
+		if err := os.WriteFile(openAPIPath, body, 0o644); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	published, err := os.ReadFile(openAPIPath)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !bytes.Equal(body, published) {
+		t.Fatal("OpenAPI document is out of date; rerun the test with -update")
+	}
+}
+
+func TestOpenAPIComponents(t *testing.T) {
+	t.Parallel()
+
+	schemas := openAPIDocument()["components"].(object)["schemas"].(object)
+	for _, name := range []string{"flashcards.Item", "api.Word", "activity.Activity", "api.Reviews"} {
+		if _, ok := schemas[name]; !ok {
+			t.Fatal("expected schema in document:", name)
+		}
+	}
+
+	word := schemas["api.Word"].(object)
+	due := word["properties"].(object)["due"].(object)
+	if due["type"] != "string" || due["format"] != "date-time" {
+		t.Fatal("expected time to be a date-time string:", due)
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	// Every API route should be documented, and vice versa.
+	t.Parallel()
+
+	r := chi.NewRouter()
+	v1Router(r)
+
+	routes := make(map[string]bool)
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method != "HEAD" {
+			routes[method+" "+strings.TrimSuffix(route, "/")] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, operations := range openAPIDocument()["paths"].(object) {
+		for method := range operations.(object) {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for route := range routes {
+		if !documented[route] {
+			t.Fatal("expected route to be documented:", route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			t.Fatal("expected documented route to exist:", route)
+		}
+	}
+}
+
+// Checks if decoded JSON value matches schema.
+// Only supports the subset of OpenAPI that openAPIDocument generates.
+func validate(doc object, value any, schema object) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		return validate(doc, value, doc["components"].(object)["schemas"].(object)[name].(object))
+	}
+	if value == nil && schema["nullable"] == true {
+		return nil
+	}
+
+	switch schema["type"] {
+	case nil:
+		if schemas, ok := schema["oneOf"].([]object); ok {
+			return validateOneOf(doc, value, schemas)
+		}
+	case "object":
+		v, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected object: %v", value)
+		}
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("missing property: %v", name)
+			}
+		}
+		properties, _ := schema["properties"].(object)
+		for name, property := range v {
+			s, ok := properties[name].(object)
+			if !ok {
+				return fmt.Errorf("undocumented property: %v", name)
+			}
+			if err := validate(doc, property, s); err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+		}
+	case "array":
+		v, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("expected array: %v", value)
+		}
+		for _, item := range v {
+			if err := validate(doc, item, schema["items"].(object)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected string: %v", value)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("expected number: %v", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected boolean: %v", value)
+		}
+	}
+	return nil
+}
+
+// Checks if decoded JSON value matches exactly one of the schemas.
+func validateOneOf(doc object, value any, schemas []object) error {
+	var errs []string
+	for _, schema := range schemas {
+		if err := validate(doc, value, schema); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if matches := len(schemas) - len(errs); matches != 1 {
+		return fmt.Errorf("expected value to match exactly one schema, matched %v: %v", matches, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validates JSON response against the schema of its type.
+func validateResponse(t *testing.T, doc object, body []byte, schema object) {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := validate(doc, value, schema); err != nil {
+		t.Fatal("expected response to match schema:", err, string(body))
+	}
+}
+
+// Points basedir and the course registry to a temporary directory with an
+// eng-spa course.
+// Tests that call this can't run in parallel.
+func useTestCourse(t *testing.T) {
+	dataDir, stateDir, oldRegistry := basedir.DataDir, basedir.StateDir, registry
+	t.Cleanup(func() {
+		basedir.DataDir, basedir.StateDir, registry = dataDir, stateDir, oldRegistry
+	})
+	basedir.DataDir = t.TempDir()
+	basedir.StateDir = t.TempDir()
+
+	path := basedir.Course("eng", "spa")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	createTestCourse(t, path, "eng", "spa")
+
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer db.Close()
+	query := `
+		INSERT INTO word (id, word, frequency_class) VALUES (1, 'hola', 2), (2, 'mundo', 3), (3, 'adiós', 2);
+		INSERT INTO sentence (id, tatoeba_id, text, tokens, frequency_class) VALUES
+			(1, 10, 'Hola, mundo.', '["Hola", ", ", "mundo", "."]', 3),
+			(2, 20, 'Adiós, mundo.', '["Adiós", ", ", "mundo", "."]', 3);
+		INSERT INTO contains (sentence, word) VALUES (1, 1), (1, 2), (2, 3), (2, 2);
+		INSERT INTO translation (id, tatoeba_id, text) VALUES (1, 100, 'Hello, world.'), (2, 200, 'Goodbye, world.');
+		INSERT INTO translates (source, target) VALUES (10, 100), (20, 200);
+	`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	registry = NewCourseRegistry(filepath.Dir(path))
+	if _, err := registry.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+}
+
+// Returns 200 response schema of operation in the OpenAPI document.
+func responseSchema(doc object, path, method string) object {
+	operation := doc["paths"].(object)[path].(object)[method].(object)
+	response := operation["responses"].(object)["200"].(object)
+	return response["content"].(object)["application/json"].(object)["schema"].(object)
+}
+
+func TestOpenAPIResponsesMatchSchema(t *testing.T) {
+	// Not parallel, because it replaces the course registry.
+	useTestCourse(t)
+	doc := openAPIDocument()
+	g := schemaGenerator{components: make(object)}
+
+	db := testDB()
+	defer db.Close()
+	if err := auth.Register(db, "student", "password"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	userID, err := auth.Authenticate(db, "student", "password")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	cookie := signedInCookie(t, db, userID, "student")
+
+	// Review some words, so that /vocab and /activity aren't empty.
+	// adiós is left for /flashcards.
+	path := basedir.Review(userID, "eng", "spa")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	reviews, err := database.New(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer reviews.Close()
+	hook := database.AttachCourse(basedir.Course("eng", "spa"))
+	con, err := database.NewConnection(reviews, context.Background(), hook)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	for _, word := range []string{"hola", "mundo"} {
+		if err := word_scheduler.UpdateWord(con, word, review_scheduler.Good); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	con.Close()
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route(apiPrefix, v1Router)
+
+	// Error envelope from a handler.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/courses/eng/spa/vocab", nil))
+	validateResponse(t, doc, w.Body.Bytes(), g.ref(ErrorResponse{}))
+
+	// Successful responses.
+	requests := []struct {
+		route string
+		url   string
+	}{
+		{"/courses", "/api/v1/courses"},
+		{"/languages", "/api/v1/languages"},
+		{"/courses/{l1}/{l2}/flashcards", "/api/v1/courses/eng/spa/flashcards?n=2"},
+		{"/courses/{l1}/{l2}/vocab", "/api/v1/courses/eng/spa/vocab"},
+		{"/courses/{l1}/{l2}/vocab", "/api/v1/courses/eng/spa/vocab?groupBy=lemma"},
+		{"/courses/{l1}/{l2}/activity", "/api/v1/courses/eng/spa/activity"},
+	}
+	for _, request := range requests {
+		req := httptest.NewRequest("GET", request.url, nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatal("expected status 200:", request.url, w.Code, w.Body.String())
+		}
+		validateResponse(t, doc, w.Body.Bytes(), responseSchema(doc, request.route, "get"))
+	}
+}
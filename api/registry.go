@@ -0,0 +1,437 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Registry of installed courses.
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lggruspe/polycloze/course_version"
+	"github.com/lggruspe/polycloze/database"
+)
+
+var errCourseNotFound = errors.New("course not found")
+
+// Tables that every course database should have.
+var courseTables = []string{
+	"language",
+	"word",
+	"sentence",
+	"contains",
+	"translation",
+	"translates",
+}
+
+// Course database that passed validation.
+type installedCourse struct {
+	Course
+	path    string
+	modTime time.Time
+	size    int64
+
+	// Hard link to the course file that gets attached to review DBs, so that
+	// in-flight requests keep using the same file after the course gets
+	// replaced.
+	// Same as path if the link couldn't be created.
+	link string
+
+	// Read-only handle to the course database.
+	// Gets closed after the course is retired and released by all users.
+	db *sql.DB
+
+	mu      sync.Mutex
+	refs    int
+	retired bool
+}
+
+// Returns false if the course has already been retired.
+func (c *installedCourse) acquire() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.retired {
+		return false
+	}
+	c.refs++
+	return true
+}
+
+func (c *installedCourse) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs--
+	if c.retired && c.refs <= 0 {
+		c.close()
+	}
+}
+
+// Marks course as replaced or removed.
+// The DB handle stays open until in-flight requests release the course.
+func (c *installedCourse) retire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retired = true
+	if c.refs <= 0 {
+		c.close()
+	}
+}
+
+// NOTE Caller should hold the lock.
+func (c *installedCourse) close() {
+	if err := c.db.Close(); err != nil {
+		log.Printf("failed to close course database (%v): %v\n", c.path, err)
+	}
+	if c.link != c.path {
+		if err := os.Remove(c.link); err != nil {
+			log.Printf("failed to remove course link (%v): %v\n", c.link, err)
+		}
+	}
+}
+
+// Directory in the course directory for links to installed course files.
+const courseLinkDir = ".installed"
+
+// For naming course links.
+var courseLinkCount atomic.Int64
+
+// Creates hard link to course file, so that it can still be opened after a new
+// file gets renamed over it.
+// Returns path if the link couldn't be created (e.g. if the course directory
+// is read-only).
+func linkCourse(path string) string {
+	dir := filepath.Join(filepath.Dir(path), courseLinkDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("could not link course database (%v): %v\n", path, err)
+		return path
+	}
+
+	// Names are unique per process, so that servers that share the course
+	// directory don't remove each other's links.
+	name := fmt.Sprintf("%v-%v-%v", os.Getpid(), courseLinkCount.Add(1), filepath.Base(path))
+	link := filepath.Join(dir, name)
+	if err := os.Link(path, link); err != nil {
+		log.Printf("could not link course database (%v): %v\n", path, err)
+		return path
+	}
+	return link
+}
+
+// Snapshot of installed courses.
+// Snapshots are never modified after they get published.
+type courseSnapshot struct {
+	courses map[string]*installedCourse // key: "{l1}-{l2}"
+
+	// Responses for /api/courses and /api/languages.
+	coursesJSON   document
+	languagesJSON document
+}
+
+// Creates snapshot and precomputes its JSON documents.
+func newCourseSnapshot(courses map[string]*installedCourse) (*courseSnapshot, error) {
+	snapshot := courseSnapshot{courses: courses}
+
+	body, err := json.Marshal(CoursesResponse{
+		Courses: snapshot.list(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode courses: %v", err)
+	}
+	snapshot.coursesJSON = newDocument(body)
+
+	body, err = json.Marshal(LanguagesResponse{
+		Languages: findL1Languages(snapshot.list()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode languages: %v", err)
+	}
+	snapshot.languagesJSON = newDocument(body)
+	return &snapshot, nil
+}
+
+// Returns list of courses in snapshot, sorted by L1 and L2 codes.
+func (s *courseSnapshot) list() []Course {
+	courses := make([]Course, 0, len(s.courses))
+	for _, c := range s.courses {
+		courses = append(courses, c.Course)
+	}
+	sort.Slice(courses, func(i, j int) bool {
+		if courses[i].L1.Code != courses[j].L1.Code {
+			return courses[i].L1.Code < courses[j].L1.Code
+		}
+		return courses[i].L2.Code < courses[j].L2.Code
+	})
+	return courses
+}
+
+func courseKey(l1, l2 string) string {
+	return fmt.Sprintf("%s-%s", l1, l2)
+}
+
+// Keeps track of course databases in a directory.
+// Scans swap the list of courses atomically, so readers never see a
+// partially updated list.
+type CourseRegistry struct {
+	dir      string
+	snapshot atomic.Pointer[courseSnapshot]
+	mu       sync.Mutex // Serializes scans
+}
+
+func NewCourseRegistry(dir string) *CourseRegistry {
+	r := CourseRegistry{dir: dir}
+	snapshot, err := newCourseSnapshot(make(map[string]*installedCourse))
+	if err != nil {
+		panic(err)
+	}
+	r.snapshot.Store(snapshot)
+	return &r
+}
+
+// Checks that the course database has the expected tables and that the
+// languages match the file name.
+func validateCourse(db *sql.DB, path string) (Course, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table'`)
+	if err != nil {
+		return Course{}, fmt.Errorf("invalid course database (%v): %v", path, err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return Course{}, fmt.Errorf("invalid course database (%v): %v", path, err)
+		}
+		tables[name] = true
+	}
+	for _, table := range courseTables {
+		if !tables[table] {
+			return Course{}, fmt.Errorf("invalid course database (%v): missing table: %v", path, table)
+		}
+	}
+
+	course, err := getCourseInfo(db, path)
+	if err != nil {
+		return course, err
+	}
+
+	expected := courseKey(course.L1.Code, course.L2.Code) + ".db"
+	if name := filepath.Base(path); name != expected {
+		return course, fmt.Errorf("invalid course database (%v): expected file name to be %v", path, expected)
+	}
+	return course, nil
+}
+
+// Opens and validates course database.
+// The returned course's modification time and size are those of the opened
+// file, which might be newer than info if the file was replaced in the
+// meantime.
+func openCourse(path string, info os.FileInfo) (*installedCourse, error) {
+	// Open the link instead of the path, so that the course handle and review
+	// DB connections use the same file.
+	link := linkCourse(path)
+	if link != path {
+		if linked, err := os.Stat(link); err == nil {
+			info = linked
+		}
+	}
+
+	c, err := openLinkedCourse(path, link, info)
+	if err != nil && link != path {
+		os.Remove(link)
+	}
+	return c, err
+}
+
+func openLinkedCourse(path, link string, info os.FileInfo) (*installedCourse, error) {
+	db, err := database.Open(fmt.Sprintf("file:%s?mode=ro", link))
+	if err != nil {
+		return nil, fmt.Errorf("could not open course database (%v): %v", path, err)
+	}
+
+	course, err := validateCourse(db, path)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	course.Stats, err = computeCourseStats(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("invalid course database (%v): %v", path, err)
+	}
+
+	course.Metadata, err = course_version.ReadMetadata(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("invalid course database (%v): %v", path, err)
+	}
+	return &installedCourse{
+		Course:  course,
+		path:    path,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		link:    link,
+		db:      db,
+	}, nil
+}
+
+// Rescans course directory.
+// New and modified files get validated before they're added.
+// Invalid files are logged and left out, unless they replace an installed
+// course, which stays installed.
+// Returns true if the list of courses changed.
+func (r *CourseRegistry) Scan() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(r.dir, "*.db"))
+	if err != nil {
+		return false, fmt.Errorf("failed to scan courses: %v", err)
+	}
+
+	old := r.snapshot.Load()
+	byPath := make(map[string]*installedCourse)
+	for _, c := range old.courses {
+		byPath[c.path] = c
+	}
+
+	changed := false
+	courses := make(map[string]*installedCourse)
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+
+		c, ok := byPath[match]
+		if !ok || !c.modTime.Equal(info.ModTime()) || c.size != info.Size() {
+			opened, err := openCourse(match, info)
+			if err != nil {
+				log.Println(err)
+				if !ok {
+					continue
+				}
+				// Keep serving the old file until the new one is
+				// valid (e.g. while it's still being copied).
+			} else {
+				c = opened
+				changed = true
+			}
+		}
+
+		key := courseKey(c.L1.Code, c.L2.Code)
+		courses[key] = c
+	}
+
+	for key, c := range old.courses {
+		if courses[key] != c {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	next, err := newCourseSnapshot(courses)
+	if err != nil {
+		// Close new handles that didn't make it into the registry.
+		for key, c := range courses {
+			if old.courses[key] != c {
+				c.retire()
+			}
+		}
+		return false, err
+	}
+	r.snapshot.Store(next)
+
+	// Retire courses that were replaced or removed.
+	for key, c := range old.courses {
+		if courses[key] != c {
+			c.retire()
+		}
+	}
+	return true, nil
+}
+
+// Rescans course directory every interval until ctx is done.
+func (r *CourseRegistry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Scan(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// Returns list of installed courses, sorted by L1 and L2 codes.
+func (r *CourseRegistry) Courses() []Course {
+	return r.snapshot.Load().list()
+}
+
+// Returns list of L1 languages of installed courses.
+func (r *CourseRegistry) Languages() []Language {
+	return findL1Languages(r.Courses())
+}
+
+// Checks if course is installed.
+func (r *CourseRegistry) Exists(l1, l2 string) bool {
+	_, ok := r.snapshot.Load().courses[courseKey(l1, l2)]
+	return ok
+}
+
+// Serves list of installed courses as JSON.
+func (r *CourseRegistry) ServeCourses(w http.ResponseWriter, req *http.Request) {
+	sendJSONDocument(w, req, r.snapshot.Load().coursesJSON)
+}
+
+// Serves list of L1 languages as JSON.
+func (r *CourseRegistry) ServeLanguages(w http.ResponseWriter, req *http.Request) {
+	sendJSONDocument(w, req, r.snapshot.Load().languagesJSON)
+}
+
+// Returns read-only handle to course database.
+// The caller must call release when it's done with the handle, and shouldn't
+// close the DB.
+// The handle remains valid even if the course gets replaced in the meantime.
+func (r *CourseRegistry) Acquire(l1, l2 string) (*sql.DB, func(), error) {
+	c, err := r.acquire(l1, l2)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.db, c.release, nil
+}
+
+// Same as Acquire, but returns the installed course.
+// The caller must call c.release when it's done with the course.
+func (r *CourseRegistry) acquire(l1, l2 string) (*installedCourse, error) {
+	for {
+		c, ok := r.snapshot.Load().courses[courseKey(l1, l2)]
+		if !ok {
+			return nil, errCourseNotFound
+		}
+		if c.acquire() {
+			return c, nil
+		}
+		// The course got retired after the snapshot was loaded, so try again
+		// with the new snapshot.
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lggruspe/polycloze/database"
+)
+
+// Creates course database for testing.
+func createTestCourse(t *testing.T, path, l1, l2 string) {
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer db.Close()
+
+	queries := []string{
+		`CREATE TABLE language (id TEXT PRIMARY KEY, code TEXT, name TEXT, bcp47 TEXT)`,
+		`CREATE TABLE word (id INTEGER PRIMARY KEY, word TEXT UNIQUE NOT NULL, frequency_class INTEGER NOT NULL)`,
+		`CREATE TABLE sentence (id INTEGER PRIMARY KEY, tatoeba_id INTEGER UNIQUE, text TEXT UNIQUE NOT NULL, tokens TEXT NOT NULL, frequency_class INTEGER NOT NULL)`,
+		`CREATE TABLE contains (sentence INTEGER NOT NULL, word INTEGER NOT NULL)`,
+		`CREATE TABLE translation (id INTEGER PRIMARY KEY, tatoeba_id INTEGER UNIQUE, text TEXT UNIQUE NOT NULL)`,
+		`CREATE TABLE translates (source INTEGER NOT NULL, target INTEGER NOT NULL)`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	query := `INSERT INTO language (id, code, name, bcp47) VALUES (?, ?, ?, ?)`
+	if _, err := db.Exec(query, "l1", l1, l1, l1); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := db.Exec(query, "l2", l2, l2, l2); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+}
+
+func TestCourseRegistryScan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	createTestCourse(t, filepath.Join(dir, "eng-spa.db"), "eng", "spa")
+
+	r := NewCourseRegistry(dir)
+	changed, err := r.Scan()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !changed {
+		t.Fatal("expected first scan to find courses")
+	}
+	if !r.Exists("eng", "spa") {
+		t.Fatal("expected eng-spa course to exist")
+	}
+
+	// Rescanning an unchanged directory shouldn't change anything.
+	changed, err = r.Scan()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if changed {
+		t.Fatal("expected second scan to not change anything")
+	}
+}
+
+func TestCourseRegistryInvalidCourse(t *testing.T) {
+	// Invalid course files should be left out.
+	t.Parallel()
+
+	dir := t.TempDir()
+	createTestCourse(t, filepath.Join(dir, "eng-spa.db"), "eng", "spa")
+
+	// File name doesn't match languages.
+	createTestCourse(t, filepath.Join(dir, "eng-fra.db"), "eng", "deu")
+
+	// Not a course database.
+	if err := os.WriteFile(filepath.Join(dir, "eng-tgl.db"), []byte("foo"), 0o644); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := NewCourseRegistry(dir)
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	courses := r.Courses()
+	if len(courses) != 1 || courses[0].L2.Code != "spa" {
+		t.Fatal("expected only eng-spa course to be installed:", courses)
+	}
+}
+
+func TestCourseRegistryInvalidReplacement(t *testing.T) {
+	// Courses should stay installed while their files are being replaced
+	// with files that aren't valid yet.
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eng-spa.db")
+	createTestCourse(t, path, "eng", "spa")
+
+	r := NewCourseRegistry(dir)
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.WriteFile(tmp, []byte("foo"), 0o644); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	changed, err := r.Scan()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if changed || !r.Exists("eng", "spa") {
+		t.Fatal("expected eng-spa course to stay installed")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	createTestCourse(t, path, "eng", "spa")
+	changed, err = r.Scan()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !changed || !r.Exists("eng", "spa") {
+		t.Fatal("expected scan to pick up valid replacement")
+	}
+}
+
+func TestCourseRegistryNewCourse(t *testing.T) {
+	// Courses added after the first scan should show up in the next scan.
+	t.Parallel()
+
+	dir := t.TempDir()
+	createTestCourse(t, filepath.Join(dir, "eng-spa.db"), "eng", "spa")
+
+	r := NewCourseRegistry(dir)
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if r.Exists("spa", "eng") {
+		t.Fatal("expected spa-eng course to not exist yet")
+	}
+
+	createTestCourse(t, filepath.Join(dir, "spa-eng.db"), "spa", "eng")
+	changed, err := r.Scan()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !changed || !r.Exists("spa", "eng") {
+		t.Fatal("expected spa-eng course to exist")
+	}
+
+	languages := r.Languages()
+	if len(languages) != 2 {
+		t.Fatal("expected two L1 languages:", languages)
+	}
+}
+
+func TestCourseRegistryAcquireReplaced(t *testing.T) {
+	// Handles acquired before a course gets replaced should stay usable until
+	// they're released.
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eng-spa.db")
+	createTestCourse(t, path, "eng", "spa")
+
+	r := NewCourseRegistry(dir)
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	db, release, err := r.Acquire("eng", "spa")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Replace course by renaming new file into place.
+	tmp := filepath.Join(dir, "tmp")
+	createTestCourse(t, tmp, "eng", "spa")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tmp, later, later); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	changed, err := r.Scan()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !changed {
+		t.Fatal("expected scan to detect replaced course")
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM language`).Scan(&count); err != nil {
+		t.Fatal("expected old handle to still be usable:", err)
+	}
+	release()
+
+	if err := db.Ping(); err == nil {
+		t.Fatal("expected old handle to be closed after release")
+	}
+}
+
+func TestCourseRegistryAcquireMissing(t *testing.T) {
+	t.Parallel()
+
+	r := NewCourseRegistry(t.TempDir())
+	if _, _, err := r.Acquire("eng", "spa"); err == nil {
+		t.Fatal("expected err to be non-nil for missing course")
+	}
+}
+
+func TestCourseRegistryStats(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eng-spa.db")
+	createTestCourse(t, path, "eng", "spa")
+
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	query := `INSERT INTO word (word, frequency_class) VALUES (?, ?)`
+	for i, class := range []int{0, 2, 2} {
+		if _, err := db.Exec(query, fmt.Sprintf("word%v", i), class); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	db.Close()
+
+	r := NewCourseRegistry(dir)
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	stats := r.Courses()[0].Stats
+	if stats.Words != 3 || stats.Sentences != 0 {
+		t.Fatal("expected 3 words and 0 sentences:", stats)
+	}
+	expected := []int{1, 0, 2}
+	if fmt.Sprint(stats.FrequencyClasses) != fmt.Sprint(expected) {
+		t.Fatal("unexpected frequency class histogram:", stats.FrequencyClasses)
+	}
+}
+
+func TestCourseRegistryETag(t *testing.T) {
+	// Responses should have an ETag, and clients with the current version
+	// should get a 304.
+	t.Parallel()
+
+	dir := t.TempDir()
+	createTestCourse(t, filepath.Join(dir, "eng-spa.db"), "eng", "spa")
+
+	r := NewCourseRegistry(dir)
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeCourses(w, httptest.NewRequest("GET", "/api/courses", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatal("expected 200 response with ETag:", w.Code, etag)
+	}
+	if strings.HasPrefix(etag, "W/") {
+		t.Fatal("expected strong ETag:", etag)
+	}
+
+	req := httptest.NewRequest("GET", "/api/courses", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeCourses(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() > 0 {
+		t.Fatal("expected 304 response without body:", w.Code)
+	}
+
+	// ETag should change after a new course gets installed.
+	createTestCourse(t, filepath.Join(dir, "spa-eng.db"), "spa", "eng")
+	if _, err := r.Scan(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeCourses(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatal("expected 200 response with new ETag:", w.Code)
+	}
+}
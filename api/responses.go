@@ -0,0 +1,62 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Response bodies of the JSON API.
+// The OpenAPI document is generated from these types (see openapi.go).
+package api
+
+import (
+	"github.com/lggruspe/polycloze/activity"
+	"github.com/lggruspe/polycloze/flashcards"
+	"github.com/lggruspe/polycloze/sentences"
+)
+
+type LanguagesResponse struct {
+	Languages []Language `json:"languages"`
+}
+
+type CoursesResponse struct {
+	Courses []Course `json:"courses"`
+}
+
+type SentencesResponse struct {
+	Sentences []sentences.Sentence `json:"sentences"`
+}
+
+type FlashcardsResponse struct {
+	Items []flashcards.Item `json:"items"`
+}
+
+type ReviewResponse struct {
+	Success bool `json:"success"`
+
+	// Student's estimated level (see word_scheduler.Placement).
+	FrequencyClass int `json:"frequencyClass"`
+}
+
+type VocabularyResponse struct {
+	Words []Word `json:"words"`
+
+	// Number of words that match the filters, in all pages.
+	Total int `json:"total"`
+
+	// Pass as `cursor` to get the next page. Empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type LemmasResponse struct {
+	Lemmas []Lemma `json:"lemmas"`
+}
+
+type ActivityResponse struct {
+	// Sum of activities too old to be in the history.
+	Aggregates activity.Activity `json:"aggregates"`
+
+	// activities[i]: activity i days ago.
+	Activities []activity.Activity `json:"activities"`
+}
+
+// Error envelope.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
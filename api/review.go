@@ -3,11 +3,77 @@
 
 package api
 
+import (
+	"time"
+
+	"github.com/lggruspe/polycloze/logger"
+	"github.com/lggruspe/polycloze/review_scheduler"
+)
+
+// Type of review items.
+// All flashcards are cloze items for now.
+const clozeItem = "cloze"
+
 type Review struct {
-	Word    string `json:"word"`
-	Correct bool   `json:"correct"`
+	Word string `json:"word"`
+
+	// "again", "hard", "good" or "easy".
+	// Reviews without a grade are graded as good if correct, and again
+	// otherwise.
+	Grade   string `json:"grade,omitempty"`
+	Correct bool   `json:"correct,omitempty"`
+
+	// Optional, recorded in the review history.
+	Latency  int `json:"latency,omitempty"`  // Time to answer in milliseconds
+	Hints    int `json:"hints,omitempty"`    // Number of hints (e.g. typo warnings)
+	Digraphs int `json:"digraphs,omitempty"` // Number of digraphs typed
+
+	// Optional, only gets logged.
+	SentenceID      int        `json:"sentenceID,omitempty"`
+	Answer          string     `json:"answer,omitempty"` // What the student typed
+	ClientTimestamp *time.Time `json:"clientTime,omitempty"`
+}
+
+func (r Review) grade() (review_scheduler.Grade, error) {
+	if r.Grade == "" {
+		return review_scheduler.GradeOf(r.Correct), nil
+	}
+	return review_scheduler.ParseGrade(r.Grade)
+}
+
+// Assumes the grade is valid (see handleReviewUpdate).
+func (r Review) answer() review_scheduler.Answer {
+	grade, _ := r.grade()
+	return review_scheduler.Answer{
+		Grade:    grade,
+		Latency:  time.Duration(r.Latency) * time.Millisecond,
+		Hints:    r.Hints,
+		Digraphs: r.Digraphs,
+	}
 }
 
 type Reviews struct {
 	Reviews []Review `json:"reviews"`
 }
+
+// Converts review into log event.
+func logEvent(review Review, l1, l2 string) logger.LogEvent {
+	answer := review.answer()
+	event := logger.LogEvent{
+		Correct:    answer.Correct(),
+		Timestamp:  time.Now().UTC(),
+		Word:       review.Word,
+		Course:     l1 + "-" + l2,
+		SentenceID: review.SentenceID,
+		ItemType:   clozeItem,
+		Answer:     review.Answer,
+		Grade:      review.Grade,
+		Latency:    time.Duration(review.Latency) * time.Millisecond,
+		Hints:      review.Hints,
+		Digraphs:   review.Digraphs,
+	}
+	if review.ClientTimestamp != nil {
+		event.ClientTimestamp = *review.ClientTimestamp
+	}
+	return event
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lggruspe/polycloze/review_scheduler"
+)
+
+func TestReviewGrade(t *testing.T) {
+	// Reviews from old clients only have `correct`.
+	t.Parallel()
+
+	cases := []struct {
+		body  string
+		grade review_scheduler.Grade
+	}{
+		{`{"word": "hola", "correct": true}`, review_scheduler.Good},
+		{`{"word": "hola", "correct": false}`, review_scheduler.Again},
+		{`{"word": "hola", "grade": "easy"}`, review_scheduler.Easy},
+		{`{"word": "hola", "correct": true, "grade": "hard"}`, review_scheduler.Hard},
+	}
+	for _, c := range cases {
+		var review Review
+		if err := json.Unmarshal([]byte(c.body), &review); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		grade, err := review.grade()
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if grade != c.grade {
+			t.Fatal("unexpected grade:", c.body, grade)
+		}
+		if event := logEvent(review, "eng", "spa"); event.Correct != grade.Correct() {
+			t.Fatal("expected logged outcome to match grade:", c.body, event)
+		}
+	}
+
+	review := Review{Word: "hola", Grade: "correct"}
+	if _, err := review.grade(); err == nil {
+		t.Fatal("expected error for invalid grade")
+	}
+}
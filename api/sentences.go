@@ -8,8 +8,6 @@ import (
 	"net/url"
 	"strconv"
 
-	"github.com/lggruspe/polycloze/basedir"
-	"github.com/lggruspe/polycloze/database"
 	"github.com/lggruspe/polycloze/sentences"
 )
 
@@ -37,25 +35,23 @@ func handleSentences(w http.ResponseWriter, r *http.Request) {
 	l1 := q.Get("l1")
 	l2 := q.Get("l2")
 	if l1 == "" || l2 == "" {
-		http.Error(w, "invalid course languages", http.StatusBadRequest)
+		sendInvalid(w, "l1 and l2 are required.")
 		return
 	}
 
-	db, err := database.Open(basedir.Course(l1, l2))
+	db, release, err := registry.Acquire(l1, l2)
 	if err != nil {
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		sendError(w, http.StatusNotFound, errNotFound, "Course not found.")
 		return
 	}
-	defer db.Close()
+	defer release()
 
 	limit := getSentencesLimit(q)
 	result, err := sentences.RandomSentences(db, limit)
 	if err != nil {
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		sendInternalError(w)
 		return
 	}
 
-	sendJSON(w, map[string][]sentences.Sentence{
-		"sentences": result,
-	})
+	sendJSON(w, SentencesResponse{Sentences: result})
 }
@@ -15,7 +15,7 @@ import (
 func handleSettings(w http.ResponseWriter, r *http.Request) {
 	var data map[string]any
 	db := auth.GetDB(r)
-	s, err := sessions.ResumeSession(db, w, r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
 	if err != nil || !isSignedIn(s) {
 		http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
 		return
@@ -33,25 +33,78 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 			goto fail
 		}
 
+		attempt, message, ok := reserveAttempt(r, username)
+		if !ok {
+			data["message"] = message
+			w.WriteHeader(http.StatusTooManyRequests)
+			goto fail
+		}
+		defer attempt.release()
+
 		id, err := auth.Authenticate(db, username, currentPassword)
 		if err != nil {
-			log.Println(err)
-			log.Println(username)
-			log.Println(currentPassword)
-			log.Println(newPassword)
+			attempt.fail()
+			audit(r, auth.EventSignInFailed, s.Data["userID"].(int), username, "password change")
 			data["message"] = "Incorrect password."
 			goto fail
 		}
 
+		resetLimit(r, username)
+
 		if err := auth.ChangePassword(db, id, newPassword); err != nil {
-			data["message"] = "Something went wrong. Please try again."
+			data["message"] = passwordMessage(err)
 			goto fail
 		}
 
-		data["message"] = "Password updated."
+		audit(r, auth.EventPasswordChange, id, username, "")
+
+		// Someone who knew the old password could still be signed in.
+		if err := sessions.EndOtherSessions(sessionStore(r), id, s.ID); err != nil {
+			log.Println(err)
+		} else {
+			audit(r, auth.EventSessionRevoked, id, username, "password change")
+		}
+		data["message"] = "Password updated. You've been signed out everywhere else."
 	}
 
 fail:
-	data["csrfToken"] = sessions.CSRFToken(s.ID)
-	renderTemplate(w, "settings.html", data)
+	renderSettings(w, r, s, data)
+}
+
+// Signs out one of the user's other sessions.
+func handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "sessionMessage")
+	if !ok {
+		return
+	}
+
+	data := s.Data
+	userID := s.Data["userID"].(int)
+	err := sessions.EndSessionByHandle(sessionStore(r), userID, r.FormValue("session"))
+	if err != nil {
+		data["sessionMessage"] = "Could not sign out session."
+		renderSettings(w, r, s, data)
+		return
+	}
+	audit(r, auth.EventSessionRevoked, userID, s.Data["username"].(string), "signed out from settings")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// Signs out all of the user's sessions except the current one.
+func handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "sessionMessage")
+	if !ok {
+		return
+	}
+
+	data := s.Data
+	userID := s.Data["userID"].(int)
+	if err := sessions.EndOtherSessions(sessionStore(r), userID, s.ID); err != nil {
+		log.Println(err)
+		data["sessionMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+	audit(r, auth.EventSessionRevoked, userID, s.Data["username"].(string), "signed out all other sessions")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
@@ -0,0 +1,49 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+func TestChangePasswordEndsOtherSessions(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/settings", handleSettings)
+
+	current := signedInCookie(t, db, 1, "foo")
+	other := signedInCookie(t, db, 1, "foo")
+
+	v := url.Values{}
+	v.Set("current-password", "correct horse")
+	v.Set("new-password", "battery staple")
+	postForm(r, "/settings", current, v)
+
+	if _, err := auth.Authenticate(db, "foo", "battery staple"); err != nil {
+		t.Fatal("expected password to be changed:", err)
+	}
+	if !isSessionSignedIn(t, db, current) {
+		t.Fatal("expected current session to still be signed in")
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(other)
+	if _, err := sessions.ResumeSession(sessions.NewSQLiteStore(db), httptest.NewRecorder(), req); err == nil {
+		t.Fatal("expected other session to be ended")
+	}
+}
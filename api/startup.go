@@ -4,12 +4,16 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/lggruspe/polycloze/basedir"
-	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/course_version"
 )
 
 type Language struct {
@@ -19,45 +23,35 @@ type Language struct {
 }
 
 type Course struct {
-	L1 Language `json:"l1"`
-	L2 Language `json:"l2"`
+	L1       Language                `json:"l1"`
+	L2       Language                `json:"l2"`
+	Stats    CourseStats             `json:"stats"`
+	Metadata course_version.Metadata `json:"metadata"`
 }
 
+// How often to look for changes in the courses directory.
+const courseScanInterval = time.Minute
+
+// Installed courses.
+var registry = NewCourseRegistry(filepath.Join(basedir.DataDir, "courses"))
+
 // Look for installed languages and courses.
+// Also starts watching the courses directory for changes.
 func Startup() {
-	courses := findCourses()
-	languages := findL1Languages(courses)
-	if len(languages) <= 0 {
-		log.Fatal("Couldn't find installed courses. Please visit https://github.com/lggruspe/polycloze/tree/main/python")
-	}
-
-	coursesJSON := filepath.Join(basedir.StateDir, "courses.json")
-	err := writeJSON(coursesJSON, map[string][]Course{
-		"courses": courses,
-	})
-	if err != nil {
-		log.Fatal("failed to write courses.json:", err)
+	if _, err := registry.Scan(); err != nil {
+		log.Fatal(err)
 	}
-
-	languagesJSON := filepath.Join(basedir.StateDir, "languages.json")
-	err = writeJSON(languagesJSON, map[string][]Language{
-		"languages": languages,
-	})
-	if err != nil {
-		log.Fatal("failed to write languages.json:", err)
+	if len(registry.Languages()) <= 0 {
+		log.Fatal("Couldn't find installed courses. Please visit https://github.com/lggruspe/polycloze/tree/main/python")
 	}
+	go registry.Watch(context.Background(), courseScanInterval)
 }
 
-// Input: path to course db file.
-func getCourseInfo(path string) (Course, error) {
+// Gets course info from course DB.
+// path is only used in error messages.
+func getCourseInfo(db *sql.DB, path string) (Course, error) {
 	var course Course
 
-	db, err := database.Open(path)
-	if err != nil {
-		return course, fmt.Errorf("could not open db to get course info: %v", err)
-	}
-	defer db.Close()
-
 	query := `select id, code, name, bcp47 from language`
 	rows, err := db.Query(query)
 	if err != nil {
@@ -84,24 +78,12 @@ func getCourseInfo(path string) (Course, error) {
 	}
 
 	if course.L1.Code == "" || course.L2.Code == "" {
-		return course, fmt.Errorf("invalid course database: %s\n", path)
+		return course, fmt.Errorf("invalid course database: %s", path)
 	}
 	return course, nil
 }
 
-// Look for installed courses in data directory.
-func findCourses() []Course {
-	var courses []Course
-	matches, _ := filepath.Glob(filepath.Join(basedir.DataDir, "courses", "*.db"))
-	for _, match := range matches {
-		course, err := getCourseInfo(match)
-		if err == nil {
-			courses = append(courses, course)
-		}
-	}
-	return courses
-}
-
+// Returns L1 languages of courses, sorted by code.
 func findL1Languages(courses []Course) []Language {
 	languages := make(map[Language]bool)
 	for _, course := range courses {
@@ -112,5 +94,8 @@ func findL1Languages(courses []Course) []Language {
 	for language := range languages {
 		result = append(result, language)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
 	return result
 }
@@ -8,7 +8,6 @@ import (
 	"embed"
 	"io/fs"
 	"net/http"
-	"path/filepath"
 
 	"github.com/lggruspe/polycloze/basedir"
 )
@@ -62,19 +61,3 @@ func cacheUntilBusted(next http.Handler) http.HandlerFunc {
 func serveShare() http.Handler {
 	return cacheUntilBusted(http.FileServer(http.Dir(basedir.DataDir)))
 }
-
-func serveLanguagesJSON() http.HandlerFunc {
-	name := filepath.Join(basedir.StateDir, "languages.json")
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, name)
-	}
-	return cacheUntilBusted(http.HandlerFunc(handler))
-}
-
-func serveCoursesJSON() http.HandlerFunc {
-	name := filepath.Join(basedir.StateDir, "courses.json")
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, name)
-	}
-	return cacheUntilBusted(http.HandlerFunc(handler))
-}
@@ -6,32 +6,79 @@ package api
 import (
 	"fmt"
 
-	"github.com/lggruspe/polycloze/basedir"
 	"github.com/lggruspe/polycloze/database"
 )
 
-// If upgrade is non-empty, upgrades the database.
-func queryInt(path, query string, upgrade ...bool) (int, error) {
+// Course statistics.
+type CourseStats struct {
+	Words     int `json:"words"`
+	Sentences int `json:"sentences"`
+
+	// Number of words in each frequency class.
+	// FrequencyClasses[i]: # of words with frequency class i.
+	FrequencyClasses []int `json:"frequencyClasses"`
+}
+
+func queryInt[T database.Querier](q T, query string) (int, error) {
 	var result int
+	err := q.QueryRow(query).Scan(&result)
+	return result, err
+}
+
+// Total count of words in course.
+func CountTotal[T database.Querier](q T) (int, error) {
+	return queryInt(q, `select count(*) from word`)
+}
+
+// Total count of sentences in course.
+func CountSentences[T database.Querier](q T) (int, error) {
+	return queryInt(q, `select count(*) from sentence`)
+}
 
-	db, err := database.Open(path)
+// Counts number of words in each frequency class.
+func FrequencyClassHistogram[T database.Querier](q T) ([]int, error) {
+	query := `
+		SELECT frequency_class, count(*) FROM word
+		WHERE frequency_class >= 0
+		GROUP BY frequency_class
+		ORDER BY frequency_class ASC
+	`
+	rows, err := q.Query(query)
 	if err != nil {
-		return 0, fmt.Errorf("could not open db (%v) for query (%v): %v", path, query, err)
+		return nil, err
 	}
-	defer db.Close()
+	defer rows.Close()
 
-	if len(upgrade) > 0 {
-		if err := database.Upgrade(db); err != nil {
-			return result, err
+	histogram := make([]int, 0)
+	for rows.Next() {
+		var class, count int
+		if err := rows.Scan(&class, &count); err != nil {
+			return nil, err
 		}
+		for len(histogram) <= class {
+			histogram = append(histogram, 0)
+		}
+		histogram[class] = count
 	}
-
-	row := db.QueryRow(query)
-	err = row.Scan(&result)
-	return result, err
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return histogram, nil
 }
 
-// Total count of words in course.
-func CountTotal(l1, l2 string) (int, error) {
-	return queryInt(basedir.Course(l1, l2), `select count(*) from word`)
+// Computes course statistics.
+func computeCourseStats[T database.Querier](q T) (CourseStats, error) {
+	var stats CourseStats
+	var err error
+
+	if stats.Words, err = CountTotal(q); err != nil {
+		return stats, fmt.Errorf("failed to count words: %v", err)
+	}
+	if stats.Sentences, err = CountSentences(q); err != nil {
+		return stats, fmt.Errorf("failed to count sentences: %v", err)
+	}
+	if stats.FrequencyClasses, err = FrequencyClassHistogram(q); err != nil {
+		return stats, fmt.Errorf("failed to count frequency classes: %v", err)
+	}
+	return stats, nil
 }
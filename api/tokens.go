@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Handlers for managing personal API tokens.
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Renders settings page with the user's API tokens, 2FA status and sessions.
+func renderSettings(w http.ResponseWriter, r *http.Request, s *sessions.Session, data map[string]any) {
+	db := auth.GetDB(r)
+	userID := s.Data["userID"].(int)
+	tokens, err := auth.ListTokens(db, userID)
+	if err != nil {
+		log.Println(err)
+	}
+	data["tokens"] = tokens
+
+	hasTOTP, err := auth.HasTOTP(db, userID)
+	if err != nil {
+		log.Println(err)
+	}
+	data["twoFactor"] = hasTOTP
+	if hasTOTP {
+		if left, err := auth.RecoveryCodesLeft(db, userID); err == nil {
+			data["recoveryCodesLeft"] = left
+		}
+	}
+
+	userSessions, err := sessions.ListUserSessions(sessionStore(r), userID, s.ID)
+	if err != nil && !errors.Is(err, sessions.ErrNotSupported) {
+		log.Println(err)
+	}
+	data["sessions"] = userSessions
+	data["sessionsListable"] = !errors.Is(err, sessions.ErrNotSupported)
+
+	hasPassword, err := auth.HasPassword(db, userID)
+	if err != nil {
+		log.Println(err)
+	}
+	data["hasPassword"] = hasPassword
+
+	data["sso"] = oidcProvider != nil
+	data["csrfToken"] = sessions.CSRFToken(s.ID)
+	renderTemplate(w, "settings.html", data)
+}
+
+// HandlerFunc for creating API tokens.
+// The new token only gets shown once.
+func handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	db := auth.GetDB(r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
+	if err != nil || !isSignedIn(s) {
+		http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
+		return
+	}
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	data := s.Data
+	if !sessions.CheckCSRFToken(s.ID, r.FormValue("csrf-token")) {
+		data["tokenMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+
+	userID := s.Data["userID"].(int)
+	scope := auth.Scope(r.FormValue("scope"))
+	token, err := auth.CreateToken(db, userID, r.FormValue("name"), scope)
+	if err != nil {
+		log.Println(err)
+		data["tokenMessage"] = "Could not create token. Enter a name and choose a scope."
+		renderSettings(w, r, s, data)
+		return
+	}
+	data["newToken"] = token
+	renderSettings(w, r, s, data)
+}
+
+// HandlerFunc for revoking API tokens.
+func handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	db := auth.GetDB(r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
+	if err != nil || !isSignedIn(s) {
+		http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
+		return
+	}
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	data := s.Data
+	if !sessions.CheckCSRFToken(s.ID, r.FormValue("csrf-token")) {
+		data["tokenMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+
+	userID := s.Data["userID"].(int)
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || auth.RevokeToken(db, userID, id) != nil {
+		data["tokenMessage"] = "Could not revoke token."
+		renderSettings(w, r, s, data)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
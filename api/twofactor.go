@@ -0,0 +1,310 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Two-factor authentication handlers.
+package api
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+	"github.com/lggruspe/polycloze/totp"
+)
+
+// How long users have to enter their 2FA code after entering their password.
+const twoFactorTimeout = 5 * time.Minute
+
+// Max number of wrong codes before the user has to enter their password
+// again.
+const twoFactorAttempts = 5
+
+// Sign-in that passed the password check, but not the 2FA check yet.
+type pendingTwoFactor struct {
+	userID   int
+	username string
+	method   string // First sign-in step, e.g. "password" or "oidc"
+	remember bool   // Whether the user asked to be remembered.
+	attempts int
+	expires  time.Time
+}
+
+// Pending 2FA checks, keyed by session ID.
+type pendingTwoFactors struct {
+	mu      sync.Mutex
+	pending map[string]pendingTwoFactor
+}
+
+var twoFactorLogins = pendingTwoFactors{pending: make(map[string]pendingTwoFactor)}
+
+func (p *pendingTwoFactors) add(sessionID string, pending pendingTwoFactor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Forget expired sign-ins.
+	now := time.Now()
+	for key, value := range p.pending {
+		if now.After(value.expires) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[sessionID] = pending
+}
+
+func (p *pendingTwoFactors) get(sessionID string) (pendingTwoFactor, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.pending[sessionID]
+	if !ok || time.Now().After(pending.expires) {
+		delete(p.pending, sessionID)
+		return pendingTwoFactor{}, false
+	}
+	return pending, true
+}
+
+// Counts failed attempt.
+// Returns false if the user ran out of attempts.
+func (p *pendingTwoFactors) fail(sessionID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.pending[sessionID]
+	if !ok {
+		return false
+	}
+	pending.attempts++
+	if pending.attempts >= twoFactorAttempts {
+		delete(p.pending, sessionID)
+		return false
+	}
+	p.pending[sessionID] = pending
+	return true
+}
+
+func (p *pendingTwoFactors) remove(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, sessionID)
+}
+
+// Asks user who passed the first sign-in step for their 2FA code.
+// method: first sign-in step (for the audit log)
+func requestTwoFactorCode(w http.ResponseWriter, s *sessions.Session, userID int, username, method string, remember bool) {
+	twoFactorLogins.add(s.ID, pendingTwoFactor{
+		userID:   userID,
+		username: username,
+		method:   method,
+		remember: remember,
+		expires:  time.Now().Add(twoFactorTimeout),
+	})
+	renderTemplate(w, "signin_2fa.html", map[string]any{
+		"csrfToken": sessions.CSRFToken(s.ID),
+	})
+}
+
+// HandlerFunc for second sign-in step.
+// Accepts TOTP codes and recovery codes.
+func handleSignInVerify(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]any)
+	db := auth.GetDB(r)
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
+	if err != nil {
+		http.Redirect(w, r, "/signin", http.StatusSeeOther)
+		return
+	}
+	if isSignedIn(s) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	pending, ok := twoFactorLogins.get(s.ID)
+	if !ok || r.Method != "POST" {
+		http.Redirect(w, r, "/signin", http.StatusSeeOther)
+		return
+	}
+
+	var attempt *passwordAttempt
+	var message string
+
+	if !sessions.CheckCSRFToken(s.ID, r.FormValue("csrf-token")) {
+		data["message"] = "Authentication failed."
+		goto fail
+	}
+	attempt, message, ok = reserveAttempt(r, pending.username)
+	if !ok {
+		data["message"] = message
+		w.WriteHeader(http.StatusTooManyRequests)
+		goto fail
+	}
+	defer attempt.release()
+
+	if err := auth.VerifyTOTP(db, pending.userID, r.FormValue("code")); err != nil {
+		attempt.fail()
+		audit(r, auth.EventSignInFailed, pending.userID, pending.username, "two-factor code")
+		if !twoFactorLogins.fail(s.ID) {
+			http.Redirect(w, r, "/signin", http.StatusSeeOther)
+			return
+		}
+		data["message"] = "Incorrect code."
+		goto fail
+	}
+	twoFactorLogins.remove(s.ID)
+	resetLimit(r, pending.username)
+
+	if sessions.RotateSession(sessionStore(r), w, s) != nil {
+		data["message"] = "Authentication failed."
+		goto fail
+	}
+	s.Data["userID"] = pending.userID
+	s.Data["username"] = pending.username
+	if sessions.SaveData(sessionStore(r), w, s) != nil {
+		data["message"] = "Authentication failed."
+		goto fail
+	}
+	audit(r, auth.EventSignIn, pending.userID, pending.username, pending.method+" and two-factor code")
+	if pending.remember {
+		if err := sessions.Remember(sessionStore(r), w, s); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := initUserDirectory(pending.userID); err != nil {
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return
+
+fail:
+	data["csrfToken"] = sessions.CSRFToken(s.ID)
+	renderTemplate(w, "signin_2fa.html", data)
+}
+
+// Checks CSRF token of settings form.
+// Returns the session if the user is signed in and the token is valid.
+// messageKey: template data key of the form's error message
+func resumeSettingsForm(w http.ResponseWriter, r *http.Request, messageKey string) (*sessions.Session, bool) {
+	s, err := sessions.ResumeSession(sessionStore(r), w, r)
+	if err != nil || !isSignedIn(s) {
+		http.Redirect(w, r, "/signin", http.StatusTemporaryRedirect)
+		return nil, false
+	}
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return nil, false
+	}
+	if !sessions.CheckCSRFToken(s.ID, r.FormValue("csrf-token")) {
+		s.Data[messageKey] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, s.Data)
+		return nil, false
+	}
+	return s, true
+}
+
+// Starts 2FA enrollment.
+// Shows the provisioning URI, which is also the QR code payload.
+func handleSetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "twoFactorMessage")
+	if !ok {
+		return
+	}
+
+	data := s.Data
+	userID := s.Data["userID"].(int)
+	secret, err := auth.SetupTOTP(auth.GetDB(r), userID)
+	if err != nil {
+		log.Println(err)
+		data["twoFactorMessage"] = "Could not set up two-factor authentication."
+		renderSettings(w, r, s, data)
+		return
+	}
+	data["totpSecret"] = secret
+	data["totpURI"] = totp.URI("polycloze", s.Data["username"].(string), secret)
+	renderSettings(w, r, s, data)
+}
+
+// Completes 2FA enrollment and shows recovery codes.
+func handleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "twoFactorMessage")
+	if !ok {
+		return
+	}
+
+	data := s.Data
+	userID := s.Data["userID"].(int)
+	codes, err := auth.ConfirmTOTP(auth.GetDB(r), userID, r.FormValue("code"))
+	if err != nil {
+		data["twoFactorMessage"] = "Incorrect code. Set up two-factor authentication again."
+		renderSettings(w, r, s, data)
+		return
+	}
+	data["recoveryCodes"] = codes
+	renderSettings(w, r, s, data)
+}
+
+// Turns off 2FA.
+// Requires the user's password, or for users without one, a two-factor code
+// and a recent sign-in.
+func handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	s, ok := resumeSettingsForm(w, r, "twoFactorMessage")
+	if !ok {
+		return
+	}
+
+	db := auth.GetDB(r)
+	data := s.Data
+	username := s.Data["username"].(string)
+	attempt, message, ok := reserveAttempt(r, username)
+	if !ok {
+		data["twoFactorMessage"] = message
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderSettings(w, r, s, data)
+		return
+	}
+	defer attempt.release()
+
+	id := s.Data["userID"].(int)
+	hasPassword, err := auth.HasPassword(db, id)
+	if err != nil {
+		log.Println(err)
+		data["twoFactorMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+
+	switch {
+	case hasPassword:
+		if _, err := auth.Authenticate(db, username, r.FormValue("password")); err != nil {
+			attempt.fail()
+			audit(r, auth.EventSignInFailed, id, username, "two-factor deactivation")
+			data["twoFactorMessage"] = "Incorrect password."
+			renderSettings(w, r, s, data)
+			return
+		}
+	case time.Since(s.Created()) > recentSignIn:
+		data["twoFactorMessage"] = "Sign in again to disable two-factor authentication."
+		renderSettings(w, r, s, data)
+		return
+	default:
+		if err := auth.VerifyTOTP(db, id, r.FormValue("code")); err != nil {
+			attempt.fail()
+			audit(r, auth.EventSignInFailed, id, username, "two-factor deactivation")
+			data["twoFactorMessage"] = "Incorrect code."
+			renderSettings(w, r, s, data)
+			return
+		}
+	}
+	resetLimit(r, username)
+
+	if err := auth.DisableTOTP(db, id); err != nil {
+		log.Println(err)
+		data["twoFactorMessage"] = "Something went wrong. Please try again."
+		renderSettings(w, r, s, data)
+		return
+	}
+	data["twoFactorMessage"] = "Two-factor authentication disabled."
+	renderSettings(w, r, s, data)
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/sessions"
+	"github.com/lggruspe/polycloze/totp"
+)
+
+// Creates session that's not signed in yet.
+// Returns session cookie.
+func anonymousCookie(t *testing.T, db *sql.DB) *http.Cookie {
+	w := httptest.NewRecorder()
+	if _, err := sessions.StartSession(sessions.NewSQLiteStore(db), w, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	cookies := w.Result().Cookies()
+	return cookies[len(cookies)-1]
+}
+
+func postForm(r http.Handler, path string, cookie *http.Cookie, v url.Values) *httptest.ResponseRecorder {
+	v.Set("csrf-token", sessions.CSRFToken(cookie.Value))
+	req := httptest.NewRequest("POST", path, strings.NewReader(v.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Gets the last session cookie set by the response, or nil.
+func responseSessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	var result *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "id" && c.MaxAge >= 0 {
+			result = c
+		}
+	}
+	return result
+}
+
+func isSessionSignedIn(t *testing.T, db *sql.DB, cookie *http.Cookie) bool {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	s, err := sessions.ResumeSession(sessions.NewSQLiteStore(db), httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return isSignedIn(s)
+}
+
+// Enables 2FA for user.
+// Returns the TOTP secret.
+func enableTOTP(t *testing.T, db *sql.DB, userID int) string {
+	secret, err := auth.SetupTOTP(db, userID)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	code, err := totp.Code(secret, time.Now().Add(-30*time.Second))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := auth.ConfirmTOTP(db, userID, code); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return secret
+}
+
+// Returns number of failed attempts recorded for username.
+func userFailures(t *testing.T, db *sql.DB, username string) int {
+	var failures int
+	query := `SELECT failures FROM login_attempt WHERE key = ?`
+	err := db.QueryRow(query, "user:"+username).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return failures
+}
+
+func TestSignInTwoFactor(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo2fa", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	secret := enableTOTP(t, db, 1)
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/signin", handleSignIn)
+	r.HandleFunc("/signin/verify", handleSignInVerify)
+
+	cookie := anonymousCookie(t, db)
+	v := url.Values{}
+	v.Set("username", "foo2fa")
+	v.Set("password", "correct horse")
+	w := postForm(r, "/signin", cookie, v)
+	if !strings.Contains(w.Body.String(), `action="/signin/verify"`) {
+		t.Fatal("expected to be asked for 2FA code:", w.Body.String())
+	}
+	if isSessionSignedIn(t, db, cookie) {
+		t.Fatal("expected session to not be signed in before 2FA check")
+	}
+
+	v = url.Values{}
+	v.Set("code", "000000")
+	postForm(r, "/signin/verify", cookie, v)
+	if isSessionSignedIn(t, db, cookie) {
+		t.Fatal("expected wrong code to be rejected")
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	v.Set("code", code)
+	w = postForm(r, "/signin/verify", cookie, v)
+	if w.Code != http.StatusSeeOther {
+		t.Fatal("expected redirect after sign-in:", w.Code, w.Body.String())
+	}
+	rotated := responseSessionCookie(w)
+	if rotated == nil || rotated.Value == cookie.Value {
+		t.Fatal("expected session to be rotated on sign-in:", w.Result().Cookies())
+	}
+	if !isSessionSignedIn(t, db, rotated) {
+		t.Fatal("expected session to be signed in after 2FA check")
+	}
+}
+
+func TestSignInTwoFactorKeepsFailures(t *testing.T) {
+	// Entering the password again shouldn't reset failed 2FA attempts.
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo2fa", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	secret := enableTOTP(t, db, 1)
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/signin", handleSignIn)
+	r.HandleFunc("/signin/verify", handleSignInVerify)
+
+	cookie := anonymousCookie(t, db)
+	password := url.Values{}
+	password.Set("username", "foo2fa")
+	password.Set("password", "correct horse")
+	wrong := url.Values{}
+	wrong.Set("code", "000000")
+
+	postForm(r, "/signin", cookie, password)
+	postForm(r, "/signin/verify", cookie, wrong)
+	postForm(r, "/signin", cookie, password)
+	if n := userFailures(t, db, "foo2fa"); n != 1 {
+		t.Fatal("expected failed 2FA attempt to still count:", n)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	right := url.Values{}
+	right.Set("code", code)
+	postForm(r, "/signin/verify", cookie, right)
+	if n := userFailures(t, db, "foo2fa"); n != 0 {
+		t.Fatal("expected failed attempts to be reset after sign-in:", n)
+	}
+}
+
+func TestDisableTwoFactorWithoutPassword(t *testing.T) {
+	// Users who signed up with an external identity confirm with a
+	// two-factor code instead, and have to have signed in recently.
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	id, username, err := auth.RegisterIdentity(db, "foo", "https://example.com", "1234")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	secret := enableTOTP(t, db, id)
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.HandleFunc("/settings/2fa/disable", handleDisableTwoFactor)
+
+	cookie := signedInCookie(t, db, id, username)
+	v := url.Values{}
+	v.Set("code", "000000")
+	w := postForm(r, "/settings/2fa/disable", cookie, v)
+	if !strings.Contains(w.Body.String(), "Incorrect code") {
+		t.Fatal("expected incorrect code to be rejected:", w.Code)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	v.Set("code", code)
+
+	// Make session older than recentSignIn.
+	query := `UPDATE user_session SET created = created - ?`
+	if _, err := db.Exec(query, int64(2*recentSignIn/time.Second)); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	w = postForm(r, "/settings/2fa/disable", cookie, v)
+	if !strings.Contains(w.Body.String(), "Sign in again") {
+		t.Fatal("expected old session to be rejected:", w.Code)
+	}
+	if enabled, err := auth.HasTOTP(db, id); err != nil || !enabled {
+		t.Fatal("expected 2FA to still be enabled:", enabled, err)
+	}
+
+	cookie = signedInCookie(t, db, id, username)
+	w = postForm(r, "/settings/2fa/disable", cookie, v)
+	if !strings.Contains(w.Body.String(), "Two-factor authentication disabled") {
+		t.Fatal("expected 2FA to be disabled:", w.Code)
+	}
+	if enabled, err := auth.HasTOTP(db, id); err != nil || enabled {
+		t.Fatal("expected 2FA to be disabled:", enabled, err)
+	}
+}
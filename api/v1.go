@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Versioned JSON API.
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Prefix of JSON API routes.
+const apiPrefix = "/api/v1"
+
+// Rejects requests from clients that don't accept JSON.
+func negotiateJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsJSON(r) {
+			sendError(w, http.StatusNotAcceptable, errNotAcceptable, "Responses are only available as application/json.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Sends errors for requests rejected by auth.Middleware.
+// API requests get JSON errors.
+func rejectRequest(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		http.Error(w, message, status)
+		return
+	}
+	code := errUnauthorized
+	if status == http.StatusForbidden {
+		code = errForbidden
+	}
+	sendError(w, status, code, message)
+}
+
+// Handles requests for a course.
+// s: session of the signed-in user
+// db: user's review DB for the course
+type courseHandlerFunc func(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session)
+
+// Checks that the user is signed in and that the course exists, then opens the
+// user's review DB for the handler.
+// The course stays acquired until the handler returns.
+func withCourse(handler courseHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, err := resumeAPISession(w, r)
+		if err != nil || !isSignedIn(s) {
+			sendUnauthorized(w)
+			return
+		}
+
+		l1 := chi.URLParam(r, "l1")
+		l2 := chi.URLParam(r, "l2")
+		c, err := registry.acquire(l1, l2)
+		if err != nil {
+			sendError(w, http.StatusNotFound, errNotFound, "Course not found.")
+			return
+		}
+		defer c.release()
+
+		userID := s.Data["userID"].(int)
+		db, err := database.New(basedir.Review(userID, l1, l2))
+		if err != nil {
+			log.Println(fmt.Errorf("could not open review database (%v-%v): %v", l1, l2, err))
+			sendInternalError(w)
+			return
+		}
+		defer db.Close()
+		handler(db, w, withAcquiredCourse(r, c), s)
+	}
+}
+
+// Serves flashcards (GET) and accepts reviews (POST) on the same route.
+// Only used by the unversioned alias.
+func handleFlashcards(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	switch r.Method {
+	case "POST":
+		handleReviewUpdate(db, w, r, s)
+	case "GET":
+		generateFlashcards(db, w, r, s)
+	default:
+		sendMethodNotAllowed(w, r)
+	}
+}
+
+func sendNotFound(w http.ResponseWriter, r *http.Request) {
+	sendError(w, http.StatusNotFound, errNotFound, "Not found.")
+}
+
+func sendMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	sendError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, fmt.Sprintf("Method %v is not allowed.", r.Method))
+}
+
+// Routes of JSON API, mounted at apiPrefix.
+func v1Router(r chi.Router) {
+	r.NotFound(sendNotFound)
+	r.MethodNotAllowed(sendMethodNotAllowed)
+
+	r.Group(func(r chi.Router) {
+		r.Use(negotiateJSON)
+		r.Get("/languages", registry.ServeLanguages)
+		r.Head("/languages", registry.ServeLanguages)
+		r.Get("/courses", registry.ServeCourses)
+		r.Head("/courses", registry.ServeCourses)
+		r.Get("/sentences", handleSentences)
+	})
+
+	r.Route("/courses/{l1}/{l2}", func(r chi.Router) {
+		// File downloads aren't JSON, but errors still are.
+		r.Get("/vocab/export", withCourse(handleVocabularyExport))
+
+		r.Group(func(r chi.Router) {
+			r.Use(negotiateJSON)
+			r.Get("/flashcards", withCourse(generateFlashcards))
+			r.Post("/reviews", withCourse(handleReviewUpdate))
+			r.Get("/vocab", withCourse(handleVocabulary))
+			r.Get("/activity", withCourse(handleActivity))
+		})
+	})
+}
+
+// Unversioned routes from before the JSON API was versioned.
+// They're aliases of the routes in v1Router.
+func legacyAPIRouter(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(negotiateJSON)
+		r.HandleFunc("/{l1}/{l2}", withCourse(handleFlashcards))
+		r.HandleFunc("/{l1}/{l2}/activity", withCourse(handleActivity))
+		r.HandleFunc("/{l1}/{l2}/vocab", withCourse(handleVocabulary))
+		r.HandleFunc("/api/sentences", handleSentences)
+
+		r.HandleFunc("/api/languages", registry.ServeLanguages)
+		r.HandleFunc("/api/courses", registry.ServeCourses)
+	})
+}
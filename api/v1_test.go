@@ -0,0 +1,236 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/lggruspe/polycloze/auth"
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/sessions"
+)
+
+// Decodes JSON error envelope in response.
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatal("expected JSON response:", contentType, w.Body.String())
+	}
+	var envelope ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	e := envelope.Error
+	if e.Code == "" || e.Message == "" {
+		t.Fatal("expected error envelope:", w.Body.String())
+	}
+	return e
+}
+
+func TestAPIErrors(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	if err := auth.Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	cookie := signedInCookie(t, db, 1, "foo")
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route(apiPrefix, v1Router)
+	legacyAPIRouter(r)
+
+	cases := []struct {
+		method   string
+		path     string
+		accept   string
+		signedIn bool
+		code     int
+		errCode  string
+	}{
+		{"GET", "/api/v1/courses/eng/spa/vocab", "", false, http.StatusUnauthorized, errUnauthorized},
+		{"GET", "/eng/spa/vocab", "", false, http.StatusUnauthorized, errUnauthorized},
+		{"GET", "/api/v1/courses/xxx/yyy/vocab", "", true, http.StatusNotFound, errNotFound},
+		{"GET", "/api/v1/courses/xxx/yyy/flashcards", "", true, http.StatusNotFound, errNotFound},
+		{"GET", "/api/v1/courses/xxx/yyy/activity", "text/html", true, http.StatusNotAcceptable, errNotAcceptable},
+		{"POST", "/api/v1/courses/xxx/yyy/vocab", "", true, http.StatusMethodNotAllowed, errMethodNotAllowed},
+		{"GET", "/api/v1/nothing", "", true, http.StatusNotFound, errNotFound},
+		{"GET", "/api/v1/sentences", "application/json", false, http.StatusUnprocessableEntity, errInvalidParameter},
+		{"GET", "/api/sentences?l1=xxx&l2=yyy", "", false, http.StatusNotFound, errNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		if c.signedIn {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != c.code {
+			t.Fatal("unexpected status code:", c.method, c.path, w.Code, w.Body.String())
+		}
+		if e := decodeError(t, w); e.Code != c.errCode {
+			t.Fatal("unexpected error code:", c.method, c.path, e)
+		}
+	}
+}
+
+func TestAPIUnauthorizedChallenge(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Route(apiPrefix, v1Router)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/courses/eng/spa/activity", nil))
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatal("expected WWW-Authenticate header in 401 response")
+	}
+}
+
+func TestRejectRequest(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	rejectRequest(w, httptest.NewRequest("GET", "/api/v1/courses", nil), http.StatusForbidden, "Forbidden.")
+	if e := decodeError(t, w); w.Code != http.StatusForbidden || e.Code != errForbidden {
+		t.Fatal("expected JSON error for API request:", w.Code, e)
+	}
+
+	w = httptest.NewRecorder()
+	rejectRequest(w, httptest.NewRequest("GET", "/eng/spa", nil), http.StatusUnauthorized, "Unauthorized.")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Content-Type") == "application/json" {
+		t.Fatal("expected plain-text error for unversioned route:", w.Code, w.Body.String())
+	}
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		accept string
+		ok     bool
+	}{
+		{"", true},
+		{"application/json", true},
+		{"text/html, application/json;q=0.9", true},
+		{"application/*", true},
+		{"*/*", true},
+		{"text/html", false},
+		{"application/json;q=0, text/html", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		if acceptsJSON(r) != c.ok {
+			t.Fatal("unexpected result:", c.accept, c.ok)
+		}
+	}
+}
+
+func TestCourseReplacedDuringRequest(t *testing.T) {
+	// Requests that started before a course got replaced should finish with
+	// the old course.
+	// Not parallel, because it replaces the course registry.
+	useTestCourse(t)
+
+	db := testDB()
+	defer db.Close()
+	if err := auth.Register(db, "student", "password"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	userID, err := auth.Authenticate(db, "student", "password")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(basedir.Review(userID, "eng", "spa")), 0o700); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Replacement course only has perro.
+	path := basedir.Course("eng", "spa")
+	tmp := filepath.Join(filepath.Dir(path), "tmp")
+	createTestCourse(t, tmp, "eng", "spa")
+	course, err := database.Open(tmp)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	query := `
+		INSERT INTO word (id, word, frequency_class) VALUES (1, 'perro', 2);
+		INSERT INTO sentence (id, tatoeba_id, text, tokens, frequency_class) VALUES
+			(1, 30, 'Perro.', '["Perro", "."]', 2);
+		INSERT INTO contains (sentence, word) VALUES (1, 1);
+		INSERT INTO translation (id, tatoeba_id, text) VALUES (1, 300, 'Dog.');
+		INSERT INTO translates (source, target) VALUES (30, 300);
+	`
+	if _, err := course.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	course.Close()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tmp, later, later); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Replace the course after the request acquires it, but before it
+	// generates flashcards.
+	replace := func(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if changed, err := registry.Scan(); err != nil || !changed {
+			t.Fatal("expected scan to detect replaced course:", changed, err)
+		}
+		generateFlashcards(db, w, r, s)
+	}
+	r := chi.NewRouter()
+	r.Use(auth.Middleware(db))
+	r.Get("/courses/{l1}/{l2}/flashcards", withCourse(replace))
+
+	req := httptest.NewRequest("GET", "/courses/eng/spa/flashcards?n=10", nil)
+	req.AddCookie(signedInCookie(t, db, userID, "student"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response FlashcardsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal("expected err to be nil:", err, w.Body.String())
+	}
+	if len(response.Items) == 0 {
+		t.Fatal("expected flashcards from the old course:", w.Body.String())
+	}
+	for _, item := range response.Items {
+		if item.Sentence.TatoebaID == 30 {
+			t.Fatal("expected flashcards from the old course:", item)
+		}
+	}
+
+	// The old course's link gets removed after the request releases it.
+	links, err := os.ReadDir(filepath.Join(filepath.Dir(path), courseLinkDir))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(links) != 1 {
+		t.Fatal("expected only the new course to be linked:", links)
+	}
+}
@@ -5,19 +5,21 @@ package api
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-
-	"github.com/lggruspe/polycloze/auth"
-	"github.com/lggruspe/polycloze/basedir"
 	"github.com/lggruspe/polycloze/database"
 	"github.com/lggruspe/polycloze/sessions"
+	"github.com/lggruspe/polycloze/text"
+	"github.com/lggruspe/polycloze/word_scheduler"
 )
 
 type Word struct {
@@ -28,50 +30,63 @@ type Word struct {
 	Strength int       `json:"strength"`
 }
 
-func handleVocabulary(w http.ResponseWriter, r *http.Request) {
-	db := auth.GetDB(r)
-	s, err := sessions.ResumeSession(db, w, r)
-	if err != nil || !isSignedIn(s) {
-		http.NotFound(w, r)
+// Forms of a word grouped by lemma and part of speech.
+type Lemma struct {
+	Lemma string `json:"lemma"`
+	POS   string `json:"pos,omitempty"`
+	Forms []Word `json:"forms"`
+}
+
+func handleVocabulary(db *sql.DB, w http.ResponseWriter, r *http.Request, s *sessions.Session) {
+	q := r.URL.Query()
+	limit, ok := getLimit(q)
+	if !ok {
+		sendInvalid(w, fmt.Sprintf("limit should be an integer from 1 to %v.", maxVocabularyLimit))
 		return
 	}
 
-	l1 := chi.URLParam(r, "l1")
-	l2 := chi.URLParam(r, "l2")
-	if !courseExists(l1, l2) {
-		http.NotFound(w, r)
+	switch q.Get("groupBy") {
+	case "":
+	case "lemma":
+		if err := checkLemmaQuery(q); err != nil {
+			sendInvalid(w, err.Error())
+			return
+		}
+		handleLemmas(db, w, r, limit)
+		return
+	default:
+		sendInvalid(w, "groupBy should be lemma.")
 		return
 	}
 
-	userID := s.Data["userID"].(int)
-	db, err = database.New(basedir.Review(userID, l1, l2))
+	query, err := parseVocabularyQuery(q, limit)
 	if err != nil {
-		log.Println(fmt.Errorf("could not open review database (%v-%v): %v", l1, l2, err))
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		sendInvalid(w, err.Error())
 		return
 	}
-	defer db.Close()
-
-	q := r.URL.Query()
-	results, err := searchVocabulary(db, getLimit(q), getAfter(q), getSortBy(q))
+	page, err := searchVocabulary(db, query)
 	if err != nil {
 		log.Println(fmt.Errorf("search error: %v", err))
-		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		sendInternalError(w)
 		return
 	}
-	sendJSON(w, map[string][]Word{
-		"words": results,
-	})
+	sendJSON(w, page)
 }
 
+// Max number of results per page.
+const maxVocabularyLimit = 100
+
 // Gets limit from URL query.
-// If the limit is not in the URL query or is invalid, returns the default (20).
-func getLimit(q url.Values) int {
+// If the limit is not in the URL query, returns the default (10).
+// Returns false if the limit is not an integer between 1 and
+// maxVocabularyLimit.
+func getLimit(q url.Values) (int, bool) {
 	v := q.Get("limit")
-	if limit, err := strconv.Atoi(v); err == nil {
-		return limit
+	if v == "" {
+		return 10, true
 	}
-	return 10
+	limit, err := strconv.Atoi(v)
+	return limit, err == nil && limit >= 1 && limit <= maxVocabularyLimit
 }
 
 // Gets 'after' from URL query.
@@ -79,39 +94,314 @@ func getAfter(q url.Values) string {
 	return q.Get("after")
 }
 
+// Columns to sort vocabulary by.
+var sortColumns = map[string]string{
+	"word":     "item",
+	"learned":  "learned",
+	"reviewed": "reviewed",
+	"due":      "due",
+	"strength": "strength",
+}
+
 // Checks if `sortBy` value is valid.
 func isValidSortBy(sortBy string) bool {
-	switch sortBy {
-	case "word":
-		fallthrough
+	_, ok := sortColumns[sortBy]
+	return ok
+}
+
+// Position in a vocabulary listing.
+// Contains the sort key of the last word in the previous page, and the word
+// itself to break ties.
+type vocabularyCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Key    int64  `json:"k,omitempty"` // Unused if sorted by word.
+	Word   string `json:"w"`
+}
+
+func (c vocabularyCursor) encode() string {
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func decodeVocabularyCursor(s string) (vocabularyCursor, error) {
+	var c vocabularyCursor
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor.")
+	}
+	if err := json.Unmarshal(bytes, &c); err != nil || !isValidSortBy(c.SortBy) {
+		return c, errors.New("invalid cursor.")
+	}
+	return c, nil
+}
+
+// Vocabulary search parameters.
+type vocabularyQuery struct {
+	Limit  int
+	SortBy string
+	Desc   bool
+	Cursor *vocabularyCursor // nil for the first page
+
+	// Filters (zero values don't filter).
+	// Ranges include the lower bound and exclude the upper bound, except for
+	// strength, which includes both.
+	DueAfter      time.Time
+	DueBefore     time.Time
+	LearnedAfter  time.Time
+	LearnedBefore time.Time
+	MinStrength   int
+	MaxStrength   *int
+	Prefix        string
+}
+
+// Parses date (YYYY-MM-DD) or RFC 3339 timestamp in URL query.
+// Returns the zero time if the parameter is missing.
+func parseTimeParameter(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%v should be a date (YYYY-MM-DD) or an RFC 3339 timestamp.", name)
+}
+
+// Parses non-negative integer in URL query.
+// Returns nil if the parameter is missing.
+func parseStrengthParameter(q url.Values, name string) (*int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%v should be a non-negative integer.", name)
+	}
+	return &n, nil
+}
+
+// Parses vocabulary search parameters from URL query.
+// Returns an error that can be shown to the client if the query is invalid.
+func parseVocabularyQuery(q url.Values, limit int) (vocabularyQuery, error) {
+	query := vocabularyQuery{
+		Limit:  limit,
+		SortBy: q.Get("sortBy"),
+		Prefix: text.Casefold(q.Get("prefix")),
+	}
+	if query.SortBy == "" {
+		query.SortBy = "word"
+	}
+	if !isValidSortBy(query.SortBy) {
+		return query, errors.New("sortBy should be one of word, learned, reviewed, due or strength.")
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, errors.New("order should be asc or desc.")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeVocabularyCursor(v)
+		if err != nil {
+			return query, err
+		}
+		if cursor.SortBy != query.SortBy || cursor.Desc != query.Desc {
+			return query, errors.New("cursor is for a different sortBy or order.")
+		}
+		query.Cursor = &cursor
+	} else if after := getAfter(q); after != "" {
+		// `after` is from before cursors, and only makes sense when sorting
+		// by word.
+		if query.SortBy != "word" || query.Desc {
+			return query, errors.New("after only works with sortBy=word in ascending order; use cursor instead.")
+		}
+		query.Cursor = &vocabularyCursor{SortBy: "word", Word: after}
+	}
+
+	var err error
+	if query.DueAfter, err = parseTimeParameter(q, "dueAfter"); err != nil {
+		return query, err
+	}
+	if query.DueBefore, err = parseTimeParameter(q, "dueBefore"); err != nil {
+		return query, err
+	}
+	if query.LearnedAfter, err = parseTimeParameter(q, "learnedAfter"); err != nil {
+		return query, err
+	}
+	if query.LearnedBefore, err = parseTimeParameter(q, "learnedBefore"); err != nil {
+		return query, err
+	}
+
+	minStrength, err := parseStrengthParameter(q, "minStrength")
+	if err != nil {
+		return query, err
+	}
+	if minStrength != nil {
+		query.MinStrength = *minStrength
+	}
+	if query.MaxStrength, err = parseStrengthParameter(q, "maxStrength"); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// Builds SQL condition for filters in query.
+// The condition applies to the `vocabulary` CTE in searchVocabulary.
+func (query vocabularyQuery) filters() (string, []any) {
+	conditions := []string{"1"}
+	var args []any
+
+	timeRange := func(column string, after, before time.Time) {
+		if !after.IsZero() {
+			conditions = append(conditions, column+" >= ?")
+			args = append(args, after.Unix())
+		}
+		if !before.IsZero() {
+			conditions = append(conditions, column+" < ?")
+			args = append(args, before.Unix())
+		}
+	}
+	timeRange("due", query.DueAfter, query.DueBefore)
+	timeRange("learned", query.LearnedAfter, query.LearnedBefore)
+
+	if query.MinStrength > 0 {
+		conditions = append(conditions, "strength >= ?")
+		args = append(args, query.MinStrength)
+	}
+	if query.MaxStrength != nil {
+		conditions = append(conditions, "strength <= ?")
+		args = append(args, *query.MaxStrength)
+	}
+	if query.Prefix != "" {
+		conditions = append(conditions, "substr(item, 1, length(?)) = ?")
+		args = append(args, query.Prefix, query.Prefix)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// Builds SQL condition for rows after the cursor.
+func (query vocabularyQuery) afterCursor() (string, []any) {
+	if query.Cursor == nil {
+		return "1", nil
+	}
+	op := ">"
+	if query.Desc {
+		op = "<"
+	}
+	if query.SortBy == "word" {
+		return "item " + op + " ?", []any{query.Cursor.Word}
+	}
+
+	column := sortColumns[query.SortBy]
+	condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND item %[2]s ?))", column, op)
+	return condition, []any{query.Cursor.Key, query.Cursor.Key, query.Cursor.Word}
+}
+
+// Returns cursor that points to the word.
+func (query vocabularyQuery) cursorAt(word Word) vocabularyCursor {
+	cursor := vocabularyCursor{
+		SortBy: query.SortBy,
+		Desc:   query.Desc,
+		Word:   word.Word,
+	}
+	switch query.SortBy {
+	case "learned":
+		cursor.Key = word.Learned.Unix()
 	case "reviewed":
-		fallthrough
+		cursor.Key = word.Reviewed.Unix()
 	case "due":
-		fallthrough
+		cursor.Key = word.Due.Unix()
 	case "strength":
-		return true
-	default:
-		return false
+		cursor.Key = int64(word.Strength)
 	}
+	return cursor
 }
 
-// Gets 'sortBy' from URL query.
-// If `sortBy` is not in the URL query or is invalid, returns "word".
-func getSortBy(q url.Values) string {
-	sortBy := q.Get("sortBy")
-	if isValidSortBy(sortBy) {
-		return sortBy
+// Lists page of words that match the query.
+// Also counts all the words that match the filters.
+func searchVocabulary(db *sql.DB, query vocabularyQuery) (VocabularyResponse, error) {
+	var page VocabularyResponse
+	if !isValidSortBy(query.SortBy) {
+		panic(fmt.Errorf("invalid sortBy value: %v", query.SortBy))
 	}
-	return "word"
+
+	// Strength is the rank of the word's interval.
+	vocabulary := `
+		WITH vocabulary AS (
+			SELECT item, learned, reviewed, due,
+				(SELECT count(*) FROM interval AS i WHERE i.interval < review.interval) AS strength
+			FROM review JOIN interval USING (interval)
+		)
+	`
+	filters, filterArgs := query.filters()
+
+	count := vocabulary + `SELECT count(*) FROM vocabulary WHERE ` + filters
+	if err := db.QueryRow(count, filterArgs...).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("vocabulary search failed: %v", err)
+	}
+
+	direction := "ASC"
+	if query.Desc {
+		direction = "DESC"
+	}
+	after, afterArgs := query.afterCursor()
+	search := vocabulary + fmt.Sprintf(`
+		SELECT item, learned, reviewed, due, strength
+		FROM vocabulary
+		WHERE %[1]s AND %[2]s
+		ORDER BY %[3]s %[4]s, item %[4]s
+		LIMIT ?
+	`, filters, after, sortColumns[query.SortBy], direction)
+
+	args := append(append(filterArgs, afterArgs...), query.Limit+1)
+	rows, err := db.Query(search, args...)
+	if err != nil {
+		return page, fmt.Errorf("vocabulary search failed: %v", err)
+	}
+	defer rows.Close()
+
+	page.Words = make([]Word, 0)
+	for rows.Next() {
+		var vocab Word
+		var learned, reviewed, due int64
+		if err := rows.Scan(&vocab.Word, &learned, &reviewed, &due, &vocab.Strength); err != nil {
+			return page, fmt.Errorf("vocabulary search failed: %v", err)
+		}
+		vocab.Learned = time.Unix(learned, 0)
+		vocab.Reviewed = time.Unix(reviewed, 0)
+		vocab.Due = time.Unix(due, 0)
+		page.Words = append(page.Words, vocab)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("vocabulary search failed: %v", err)
+	}
+
+	// The extra row is only there to check if there's a next page.
+	if len(page.Words) > query.Limit {
+		page.Words = page.Words[:query.Limit]
+		page.NextCursor = query.cursorAt(page.Words[query.Limit-1]).encode()
+	}
+	return page, nil
 }
 
 // Returns map from interval (as number of hours) to strength.
 // Use this to compute interval strength.
 // The result is not the same as `interval.ROWID`, because there can be gaps in
 // rowids.
-func queryIntervalStrengths(db *sql.DB) (map[int]int, error) {
+func queryIntervalStrengths[T database.Querier](q T) (map[int]int, error) {
 	query := `SELECT interval FROM interval ORDER BY interval ASC`
-	rows, err := db.Query(query)
+	rows, err := q.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query intervals: %v", err)
 	}
@@ -130,54 +420,115 @@ func queryIntervalStrengths(db *sql.DB) (map[int]int, error) {
 	return intervals, nil
 }
 
-// Lists words returned by query.
-//   - limit should be between 10 and 100.
-//     Silently changes limit if not.
-func searchVocabulary(db *sql.DB, limit int, after string, sortBy string) ([]Word, error) {
-	// Cap limit.
-	if limit < 10 {
-		limit = 10
+// Vocabulary search parameters that don't work with groupBy=lemma.
+var lemmaUnsupportedParameters = []string{
+	"cursor",
+	"order",
+	"sortBy",
+	"dueAfter",
+	"dueBefore",
+	"learnedAfter",
+	"learnedBefore",
+	"minStrength",
+	"maxStrength",
+	"prefix",
+}
+
+// Checks that the URL query only has parameters that work with groupBy=lemma.
+// Returns an error that can be shown to the client otherwise.
+func checkLemmaQuery(q url.Values) error {
+	for _, name := range lemmaUnsupportedParameters {
+		if q.Get(name) != "" {
+			return fmt.Errorf("%v doesn't work with groupBy=lemma.", name)
+		}
 	}
-	if limit > 100 {
-		limit = 100
+	return nil
+}
+
+// Sends vocabulary aggregated by lemma.
+func handleLemmas(db *sql.DB, w http.ResponseWriter, r *http.Request, limit int) {
+	con, err := database.NewConnection(db, r.Context(), attachCourse(r))
+	if err != nil {
+		log.Println(fmt.Errorf("could not connect to database: %v", err))
+		sendInternalError(w)
+		return
+	}
+	defer con.Close()
+
+	results, err := searchLemmas(con, limit, getAfter(r.URL.Query()))
+	if err != nil {
+		log.Println(fmt.Errorf("search error: %v", err))
+		sendInternalError(w)
+		return
 	}
+	sendJSON(w, LemmasResponse{Lemmas: results})
+}
 
-	if !isValidSortBy(sortBy) {
-		panic(fmt.Errorf("invalid sortBy value: %v", sortBy))
+// Lists reviewed words grouped by lemma, sorted by lemma.
+// Words without a lemma (or in courses without lemmas) are their own lemma.
+// `after` and `limit` apply to lemmas, not to individual forms.
+//
+// NOTE Expects the course database to be attached.
+func searchLemmas[T database.Querier](q T, limit int, after string) ([]Lemma, error) {
+	intervals, err := queryIntervalStrengths(q)
+	if err != nil {
+		return nil, fmt.Errorf("lemma search failed: %v", err)
 	}
 
-	intervals, err := queryIntervalStrengths(db)
+	ok, err := word_scheduler.HasLemmas(q)
 	if err != nil {
-		return nil, fmt.Errorf("vocabulary search failed: %v", err)
+		return nil, fmt.Errorf("lemma search failed: %v", err)
+	}
+	columns := `NULL AS lemma, NULL AS pos`
+	if ok {
+		columns = `word.lemma AS lemma, word.pos AS pos`
 	}
 
 	query := fmt.Sprintf(`
-		SELECT item AS word, learned, reviewed, due, interval AS strength
-		FROM review JOIN interval USING (interval)
-		WHERE item > ?
-		ORDER BY %s
-		LIMIT ?
-	`, sortBy)
+		WITH forms AS (
+			SELECT coalesce(lemma, item) AS lemma, coalesce(pos, '') AS pos,
+				item, learned, reviewed, due, interval
+			FROM (
+				SELECT %s, review.*
+				FROM review LEFT JOIN word ON (review.item = word.word)
+			)
+		), page AS (
+			SELECT DISTINCT lemma FROM forms
+			WHERE lemma > ?
+			ORDER BY lemma
+			LIMIT ?
+		)
+		SELECT lemma, pos, item, learned, reviewed, due, interval FROM forms
+		WHERE lemma IN page
+		ORDER BY lemma, pos, item
+	`, columns)
 
-	words := make([]Word, 0)
-	rows, err := db.Query(query, after, limit)
+	rows, err := q.Query(query, after, limit)
 	if err != nil {
-		return nil, fmt.Errorf("vocabulary search failed: %v", err)
+		return nil, fmt.Errorf("lemma search failed: %v", err)
 	}
 	defer rows.Close()
 
+	lemmas := make([]Lemma, 0)
 	for rows.Next() {
+		var lemma, pos string
 		var vocab Word
 		var learned, reviewed, due int64
 		var interval int
-		if err := rows.Scan(&vocab.Word, &learned, &reviewed, &due, &interval); err != nil {
-			return nil, fmt.Errorf("vocabulary search failed: %v", err)
+		if err := rows.Scan(&lemma, &pos, &vocab.Word, &learned, &reviewed, &due, &interval); err != nil {
+			return nil, fmt.Errorf("lemma search failed: %v", err)
 		}
 		vocab.Learned = time.Unix(learned, 0)
 		vocab.Reviewed = time.Unix(reviewed, 0)
 		vocab.Due = time.Unix(due, 0)
 		vocab.Strength = intervals[interval]
-		words = append(words, vocab)
+
+		n := len(lemmas)
+		if n == 0 || lemmas[n-1].Lemma != lemma || lemmas[n-1].POS != pos {
+			lemmas = append(lemmas, Lemma{Lemma: lemma, POS: pos})
+			n++
+		}
+		lemmas[n-1].Forms = append(lemmas[n-1].Forms, vocab)
 	}
-	return words, nil
+	return lemmas, nil
 }
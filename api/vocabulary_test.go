@@ -0,0 +1,267 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package api
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lggruspe/polycloze/review_scheduler"
+	"github.com/lggruspe/polycloze/utils"
+	"github.com/lggruspe/polycloze/word_scheduler"
+)
+
+func TestSearchLemmas(t *testing.T) {
+	// Reviewed forms should be grouped by lemma.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	query := `
+		INSERT INTO word (word, frequency_class, lemma, pos) VALUES
+		('habla', 0, 'hablar', 'VERB'),
+		('hablo', 0, 'hablar', 'VERB'),
+		('casa', 0, NULL, NULL)
+	`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	for _, word := range []string{"habla", "hablo", "casa"} {
+		if err := word_scheduler.UpdateWord(db, word, review_scheduler.Good); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	lemmas, err := searchLemmas(db, 10, "")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(lemmas) != 2 {
+		t.Fatal("expected two lemmas:", lemmas)
+	}
+	if lemmas[0].Lemma != "casa" || len(lemmas[0].Forms) != 1 {
+		t.Fatal("expected casa to be its own lemma:", lemmas[0])
+	}
+	if lemmas[1].Lemma != "hablar" || lemmas[1].POS != "VERB" || len(lemmas[1].Forms) != 2 {
+		t.Fatal("expected habla and hablo to be grouped under hablar:", lemmas[1])
+	}
+
+	lemmas, err = searchLemmas(db, 10, "casa")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(lemmas) != 1 || lemmas[0].Lemma != "hablar" {
+		t.Fatal("expected only lemmas after casa:", lemmas)
+	}
+}
+
+// Creates review DB with words with the given due dates (as Unix timestamps).
+// The nth word (starting from 0) has strength n % 3 and was learned at time n.
+func vocabularyTestDB(t *testing.T, due map[string]int64) *sql.DB {
+	db := utils.TestingDatabase()
+
+	query := `INSERT OR IGNORE INTO interval (interval) VALUES (0), (1), (2)`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	words := make([]string, 0, len(due))
+	for word := range due {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	// `due` is generated from `reviewed` and `interval` (in hours).
+	query = `
+		INSERT INTO review (item, learned, reviewed, interval)
+		VALUES (?, ?, ?, ?)
+	`
+	for n, word := range words {
+		interval := int64(n % 3)
+		reviewed := due[word] - 3600*interval
+		if _, err := db.Exec(query, word, n, reviewed, interval); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	return db
+}
+
+// Collects all pages of vocabulary search.
+func allPages(t *testing.T, db *sql.DB, query vocabularyQuery) []string {
+	var words []string
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("expected pagination to end")
+		}
+		page, err := searchVocabulary(db, query)
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if len(page.Words) > query.Limit {
+			t.Fatal("expected page to respect limit:", page.Words)
+		}
+		for _, word := range page.Words {
+			words = append(words, word.Word)
+		}
+		if page.NextCursor == "" {
+			return words
+		}
+		cursor, err := decodeVocabularyCursor(page.NextCursor)
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		query.Cursor = &cursor
+	}
+}
+
+func TestSearchVocabularyCursor(t *testing.T) {
+	// Pages should follow the sort order, even with ties.
+	t.Parallel()
+	db := vocabularyTestDB(t, map[string]int64{
+		"a": 30,
+		"b": 10,
+		"c": 20,
+		"d": 10,
+		"e": 20,
+	})
+	defer db.Close()
+
+	cases := []struct {
+		sortBy string
+		desc   bool
+		words  string
+	}{
+		{"word", false, "abcde"},
+		{"word", true, "edcba"},
+		{"due", false, "bdcea"},
+		{"due", true, "aecdb"},
+		{"strength", false, "adbec"},
+	}
+	for _, c := range cases {
+		query := vocabularyQuery{Limit: 2, SortBy: c.sortBy, Desc: c.desc}
+		words := strings.Join(allPages(t, db, query), "")
+		if words != c.words {
+			t.Fatal("unexpected order:", c.sortBy, c.desc, words, c.words)
+		}
+	}
+}
+
+func TestSearchVocabularyFilters(t *testing.T) {
+	t.Parallel()
+	db := vocabularyTestDB(t, map[string]int64{
+		"casa":   100,
+		"cosa":   200,
+		"perro":  300,
+		"gato":   400,
+		"cuando": 500,
+	})
+	defer db.Close()
+
+	one := 1
+	cases := []struct {
+		query vocabularyQuery
+		words string
+	}{
+		{vocabularyQuery{Prefix: "c"}, "casa cosa cuando"},
+		{vocabularyQuery{DueAfter: time.Unix(200, 0), DueBefore: time.Unix(400, 0)}, "cosa perro"},
+		{vocabularyQuery{LearnedAfter: time.Unix(3, 0)}, "gato perro"},
+		{vocabularyQuery{LearnedBefore: time.Unix(1, 0)}, "casa"},
+		{vocabularyQuery{MinStrength: 1, MaxStrength: &one}, "cosa perro"},
+	}
+	for _, c := range cases {
+		c.query.Limit = 10
+		c.query.SortBy = "word"
+		page, err := searchVocabulary(db, c.query)
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		var words []string
+		for _, word := range page.Words {
+			words = append(words, word.Word)
+		}
+		if strings.Join(words, " ") != c.words || page.Total != len(words) {
+			t.Fatal("unexpected results:", c.query, words, page.Total)
+		}
+	}
+}
+
+func TestSearchVocabularyTotal(t *testing.T) {
+	// Total should count all pages.
+	t.Parallel()
+	db := vocabularyTestDB(t, map[string]int64{"a": 1, "b": 2, "c": 3})
+	defer db.Close()
+
+	page, err := searchVocabulary(db, vocabularyQuery{Limit: 1, SortBy: "word"})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(page.Words) != 1 || page.Total != 3 || page.NextCursor == "" {
+		t.Fatal("unexpected page:", page)
+	}
+}
+
+func TestParseVocabularyQuery(t *testing.T) {
+	t.Parallel()
+
+	cursor := vocabularyCursor{SortBy: "due", Desc: true, Key: 10, Word: "b"}.encode()
+	valid := []string{
+		"",
+		"sortBy=due&order=desc&cursor=" + cursor,
+		"after=casa",
+		"dueAfter=2022-01-01&dueBefore=2022-02-01T00:00:00Z",
+		"minStrength=1&maxStrength=3&prefix=Ca",
+	}
+	for _, v := range valid {
+		q, _ := url.ParseQuery(v)
+		if _, err := parseVocabularyQuery(q, 10); err != nil {
+			t.Fatal("expected err to be nil:", v, err)
+		}
+	}
+
+	invalid := []string{
+		"sortBy=frequency",
+		"order=up",
+		"cursor=garbage",
+		"sortBy=due&cursor=" + cursor,
+		"sortBy=due&after=casa",
+		"dueAfter=yesterday",
+		"minStrength=-1",
+	}
+	for _, v := range invalid {
+		q, _ := url.ParseQuery(v)
+		if _, err := parseVocabularyQuery(q, 10); err == nil {
+			t.Fatal("expected err to be non-nil:", v)
+		}
+	}
+
+	for _, limit := range []string{"0", "101", "ten"} {
+		if _, ok := getLimit(url.Values{"limit": {limit}}); ok {
+			t.Fatal("expected limit to be rejected instead of clamped:", limit)
+		}
+	}
+}
+
+func TestCheckLemmaQuery(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []string{"groupBy=lemma", "groupBy=lemma&limit=5&after=casa"} {
+		q, _ := url.ParseQuery(v)
+		if err := checkLemmaQuery(q); err != nil {
+			t.Fatal("expected err to be nil:", v, err)
+		}
+	}
+
+	// Search parameters that only work without groupBy shouldn't be ignored.
+	for _, name := range lemmaUnsupportedParameters {
+		q := url.Values{"groupBy": {"lemma"}, name: {"1"}}
+		if err := checkLemmaQuery(q); err == nil {
+			t.Fatal("expected err to be non-nil:", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Security audit log.
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kind of security-related event.
+type Event string
+
+const (
+	EventSignIn         Event = "sign-in"
+	EventSignInFailed   Event = "sign-in-failed"
+	EventRegister       Event = "register"
+	EventPasswordChange Event = "password-change"
+	EventSessionRevoked Event = "session-revoked"
+	EventUserDisabled   Event = "user-disabled"
+	EventUserEnabled    Event = "user-enabled"
+	EventUserDeleted    Event = "user-deleted"
+)
+
+// Events that can be used to filter the audit log.
+var Events = []Event{
+	EventSignIn,
+	EventSignInFailed,
+	EventRegister,
+	EventPasswordChange,
+	EventSessionRevoked,
+	EventUserDisabled,
+	EventUserEnabled,
+	EventUserDeleted,
+}
+
+type AuditEntry struct {
+	ID        int
+	Time      time.Time
+	Event     Event
+	UserID    int    // 0 if the user is unknown, e.g. failed sign-in with a wrong username.
+	Username  string // As entered by the user, so it may not belong to anyone.
+	IP        string
+	UserAgent string
+	Detail    string // Extra info, e.g. the sign-in method.
+}
+
+// Adds entry to audit log.
+// Ignores entry.ID and entry.Time.
+// If entry.UserID is 0, the user ID gets looked up from entry.Username.
+func RecordAudit(db *sql.DB, entry AuditEntry) error {
+	var userID any
+	if entry.UserID > 0 {
+		userID = entry.UserID
+	}
+	query := `
+		INSERT INTO audit_log (event, user_id, username, ip, user_agent, detail)
+		VALUES (?, coalesce(?, (SELECT id FROM user WHERE username = ?)), ?, ?, ?, ?)
+	`
+	_, err := db.Exec(
+		query,
+		entry.Event,
+		userID,
+		entry.Username,
+		entry.Username,
+		entry.IP,
+		entry.UserAgent,
+		entry.Detail,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit log entry: %v", err)
+	}
+	return nil
+}
+
+// Audit log query. Zero-valued fields match everything.
+type AuditFilter struct {
+	UserID int
+	Event  Event
+	Since  time.Time // Inclusive
+	Until  time.Time // Exclusive
+	Before int       // Only entries with smaller IDs, for pagination.
+	Limit  int       // Defaults to 100.
+}
+
+// Lists audit log entries that match the filter, newest first.
+func QueryAudit(db *sql.DB, filter AuditFilter) ([]AuditEntry, error) {
+	var conditions []string
+	var args []any
+	if filter.UserID > 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Event != "" {
+		conditions = append(conditions, "event = ?")
+		args = append(args, filter.Event)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, filter.Since.Unix())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "time < ?")
+		args = append(args, filter.Until.Unix())
+	}
+	if filter.Before > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.Before)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := `
+		SELECT id, time, event, coalesce(user_id, 0), username, ip, user_agent, detail
+		FROM audit_log
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		var t int64
+		err := rows.Scan(
+			&entry.ID,
+			&t,
+			&entry.Event,
+			&entry.UserID,
+			&entry.Username,
+			&entry.IP,
+			&entry.UserAgent,
+			&entry.Detail,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query audit log: %v", err)
+		}
+		entry.Time = time.Unix(t, 0)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordAuditLooksUpUserID(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	entries := []AuditEntry{
+		{Event: EventSignInFailed, Username: "foo", IP: "10.0.0.1", UserAgent: "test"},
+		{Event: EventSignInFailed, Username: "nobody", IP: "10.0.0.2"},
+	}
+	for _, entry := range entries {
+		if err := RecordAudit(db, entry); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	result, err := QueryAudit(db, AuditFilter{})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(result) != 2 {
+		t.Fatal("expected 2 entries:", result)
+	}
+
+	// Newest first.
+	if result[0].Username != "nobody" || result[0].UserID != 0 {
+		t.Fatal("expected unknown user to have no user ID:", result[0])
+	}
+	if result[1].UserID != 1 || result[1].IP != "10.0.0.1" || result[1].UserAgent != "test" {
+		t.Fatal("unexpected entry:", result[1])
+	}
+}
+
+func TestQueryAuditFilter(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	entries := []AuditEntry{
+		{Event: EventSignIn, UserID: 1, Username: "foo"},
+		{Event: EventSignIn, UserID: 2, Username: "bar"},
+		{Event: EventPasswordChange, UserID: 1, Username: "foo"},
+		{Event: EventSignIn, UserID: 1, Username: "foo"},
+	}
+	for _, entry := range entries {
+		if err := RecordAudit(db, entry); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	result, err := QueryAudit(db, AuditFilter{UserID: 1, Event: EventSignIn})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(result) != 2 || result[0].ID != 4 || result[1].ID != 1 {
+		t.Fatal("unexpected entries:", result)
+	}
+
+	result, err = QueryAudit(db, AuditFilter{Before: 4, Limit: 2})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(result) != 2 || result[0].ID != 3 || result[1].ID != 2 {
+		t.Fatal("unexpected entries:", result)
+	}
+
+	result, err = QueryAudit(db, AuditFilter{Since: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(result) != 0 {
+		t.Fatal("expected no entries:", result)
+	}
+}
@@ -19,8 +19,13 @@ func saltHashPassword(password string) string {
 	return string(result)
 }
 
+// Registers new user.
+// Returns one of the ErrPassword* errors if the password doesn't satisfy the
+// password policy.
 func Register(db *sql.DB, username, password string) error {
-	// NOTE allows empty string as password
+	if err := CheckPassword(password); err != nil {
+		return err
+	}
 	query := `INSERT INTO user (username, password) VALUES (?, ?)`
 	hash := saltHashPassword(password)
 	if _, err := db.Exec(query, username, hash); err != nil {
@@ -34,7 +39,7 @@ func Register(db *sql.DB, username, password string) error {
 func Authenticate(db *sql.DB, username, password string) (int, error) {
 	var id int
 	var hash string
-	query := `SELECT id, password FROM user WHERE username = ?`
+	query := `SELECT id, password FROM user WHERE username = ? AND NOT disabled`
 	err := db.QueryRow(query, username).Scan(&id, &hash)
 
 	if err != nil && hash != "" {
@@ -46,7 +51,12 @@ func Authenticate(db *sql.DB, username, password string) (int, error) {
 	return id, nil
 }
 
+// Returns one of the ErrPassword* errors if the password doesn't satisfy the
+// password policy.
 func ChangePassword(db *sql.DB, userID int, password string) error {
+	if err := CheckPassword(password); err != nil {
+		return err
+	}
 	query := `UPDATE user SET password = ? WHERE id = ?`
 	hash := saltHashPassword(password)
 	if _, err := db.Exec(query, hash, userID); err != nil {
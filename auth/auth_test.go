@@ -5,6 +5,7 @@ package auth
 
 import (
 	"database/sql"
+	"errors"
 	"strings"
 	"testing"
 
@@ -25,7 +26,7 @@ func TestAuthenticateUnregistered(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if _, err := Authenticate(db, "foo", "bar"); err == nil {
+	if _, err := Authenticate(db, "foo", "correct horse"); err == nil {
 		t.Fatal("authentication should fail if user is not registered")
 	}
 }
@@ -35,10 +36,10 @@ func TestAuthenticateRegistered(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if err := Register(db, "foo", "bar"); err != nil {
+	if err := Register(db, "foo", "correct horse"); err != nil {
 		t.Fatal("initial registration should succeed:", err)
 	}
-	if _, err := Authenticate(db, "foo", "bar"); err != nil {
+	if _, err := Authenticate(db, "foo", "correct horse"); err != nil {
 		t.Fatal("authentication should succeed if username and password are correct:", err)
 	}
 }
@@ -48,10 +49,10 @@ func TestAuthenticateIncorrectPassword(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if err := Register(db, "foo", "bar"); err != nil {
+	if err := Register(db, "foo", "correct horse"); err != nil {
 		t.Fatal("initial registration should succeed:", err)
 	}
-	if _, err := Authenticate(db, "foo", "baz"); err == nil {
+	if _, err := Authenticate(db, "foo", "battery staple"); err == nil {
 		t.Fatal("authentication should fail if password is incorrect:", err)
 	}
 }
@@ -87,10 +88,10 @@ func TestRegisterTakenUsername(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if err := Register(db, "foo", "bar"); err != nil {
+	if err := Register(db, "foo", "correct horse"); err != nil {
 		t.Fatal("initial registration should succeed:", err)
 	}
-	if err := Register(db, "foo", "baz"); err == nil {
+	if err := Register(db, "foo", "battery staple"); err == nil {
 		t.Fatal("registration should fail if username is already taken")
 	}
 }
@@ -110,11 +111,11 @@ func TestRegisterEmptyPassword(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if err := Register(db, "username", ""); err != nil {
-		t.Fatal("empty string should be allowed as password:", err)
+	if err := Register(db, "username", ""); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatal("empty string should not be allowed as password:", err)
 	}
-	if _, err := Authenticate(db, "username", ""); err != nil {
-		t.Fatal("empty string should be allowed as password:", err)
+	if _, err := Authenticate(db, "username", ""); err == nil {
+		t.Fatal("expected err to be non-nil")
 	}
 }
 
@@ -123,27 +124,27 @@ func TestChangePassword(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if err := Register(db, "foo", "bar"); err != nil {
+	if err := Register(db, "foo", "correct horse"); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
-	oldID, err := Authenticate(db, "foo", "bar")
+	oldID, err := Authenticate(db, "foo", "correct horse")
 	if err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
 	// Change password
-	if err := ChangePassword(db, oldID, "baz"); err != nil {
+	if err := ChangePassword(db, oldID, "battery staple"); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
 	// Authenticating with old password should fail
-	if _, err := Authenticate(db, "foo", "bar"); err == nil {
+	if _, err := Authenticate(db, "foo", "correct horse"); err == nil {
 		t.Fatal("expected sign in with old password to fail")
 	}
 
 	// Authenticating with new password shouldn't fail
-	newID, err := Authenticate(db, "foo", "baz")
+	newID, err := Authenticate(db, "foo", "battery staple")
 	if err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
@@ -159,7 +160,7 @@ func TestChangePasswordNonExistentUser(t *testing.T) {
 	db := openDB()
 	defer db.Close()
 
-	if err := ChangePassword(db, 1, "baz"); err != nil {
+	if err := ChangePassword(db, 1, "battery staple"); err != nil {
 		t.Fatal("ChangePassword should not return error if user doesn't exist:", err)
 	}
 }
@@ -170,11 +171,11 @@ func TestChangePasswordStorage(t *testing.T) {
 	defer db.Close()
 
 	// Register user
-	if err := Register(db, "foo", "bar"); err != nil {
+	if err := Register(db, "foo", "correct horse"); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
-	id, err := Authenticate(db, "foo", "bar")
+	id, err := Authenticate(db, "foo", "correct horse")
 	if err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
+	"strings"
 )
 
 type contextValueKey int
@@ -14,14 +15,50 @@ type contextValueKey int
 // Keys for getting values from request context.
 const (
 	keyUserDB contextValueKey = iota
+	keyToken
 )
 
+// Gets bearer token from Authorization header.
+// Returns false if there's none.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// Sends error response for requests rejected by Middleware.
+// Can be replaced, e.g. to send errors in the format of a JSON API.
+var RejectRequest = func(w http.ResponseWriter, r *http.Request, status int, message string) {
+	http.Error(w, message, status)
+}
+
 // Stuffs pointer to database of users into request context.
+// Also authenticates requests with an `Authorization: Bearer` API token.
+// Requests with invalid tokens or with methods not allowed by the token's
+// scope get rejected.
 func Middleware(db *sql.DB) func(http.Handler) http.Handler {
 	// Gets user session and stuffs it in the request context.
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := context.WithValue(r.Context(), keyUserDB, db)
+
+			if bearer, ok := bearerToken(r); ok {
+				token, err := AuthenticateToken(db, bearer)
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					RejectRequest(w, r, http.StatusUnauthorized, "Unauthorized.")
+					return
+				}
+				if !token.Scope.Allows(r.Method) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+					RejectRequest(w, r, http.StatusForbidden, "Forbidden.")
+					return
+				}
+				ctx = context.WithValue(ctx, keyToken, token)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -32,3 +69,11 @@ func Middleware(db *sql.DB) func(http.Handler) http.Handler {
 func GetDB(r *http.Request) *sql.DB {
 	return r.Context().Value(keyUserDB).(*sql.DB)
 }
+
+// Gets API token used to authenticate the request.
+// Returns false if the request doesn't have a valid token.
+// Assumes Middleware is used.
+func GetToken(r *http.Request) (Token, bool) {
+	token, ok := r.Context().Value(keyToken).(Token)
+	return token, ok
+}
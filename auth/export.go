@@ -0,0 +1,97 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Account data export.
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ExportedToken struct {
+	Name     string     `json:"name"`
+	Scope    Scope      `json:"scope"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+type ExportedIdentity struct {
+	Issuer  string    `json:"issuer"`
+	Subject string    `json:"subject"`
+	Created time.Time `json:"created"`
+}
+
+// Account metadata stored in the users DB.
+// Doesn't include secrets (password hash, TOTP secret, token hashes).
+type Account struct {
+	ID         int                `json:"id"`
+	Username   string             `json:"username"`
+	Role       Role               `json:"role"`
+	TwoFactor  bool               `json:"twoFactor"`
+	Tokens     []ExportedToken    `json:"tokens"`
+	Identities []ExportedIdentity `json:"identities"`
+}
+
+// Collects account metadata for data export.
+func ExportAccount(db *sql.DB, userID int) (Account, error) {
+	var account Account
+	user, err := GetUser(db, userID)
+	if err != nil {
+		return account, fmt.Errorf("failed to export account: %v", err)
+	}
+	account.ID = user.ID
+	account.Username = user.Username
+	account.Role = user.Role
+
+	account.TwoFactor, err = HasTOTP(db, userID)
+	if err != nil {
+		return account, fmt.Errorf("failed to export account: %v", err)
+	}
+
+	tokens, err := ListTokens(db, userID)
+	if err != nil {
+		return account, fmt.Errorf("failed to export account: %v", err)
+	}
+	account.Tokens = make([]ExportedToken, 0, len(tokens))
+	for _, token := range tokens {
+		exported := ExportedToken{
+			Name:    token.Name,
+			Scope:   token.Scope,
+			Created: token.Created,
+		}
+		if !token.LastUsed.IsZero() {
+			lastUsed := token.LastUsed
+			exported.LastUsed = &lastUsed
+		}
+		account.Tokens = append(account.Tokens, exported)
+	}
+
+	account.Identities, err = listIdentities(db, userID)
+	if err != nil {
+		return account, fmt.Errorf("failed to export account: %v", err)
+	}
+	return account, nil
+}
+
+func listIdentities(db *sql.DB, userID int) ([]ExportedIdentity, error) {
+	query := `SELECT issuer, subject, created FROM user_identity WHERE user_id = ?`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]ExportedIdentity, 0)
+	for rows.Next() {
+		var identity ExportedIdentity
+		var created int64
+		if err := rows.Scan(&identity.Issuer, &identity.Subject, &created); err != nil {
+			return nil, err
+		}
+		identity.Created = time.Unix(created, 0)
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
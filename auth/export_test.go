@@ -0,0 +1,35 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"testing"
+)
+
+func TestExportAccount(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := CreateToken(db, 1, "phone", ScopeReview); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	account, err := ExportAccount(db, 1)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if account.Username != "foo" || account.TwoFactor {
+		t.Fatal("unexpected account:", account)
+	}
+	if len(account.Tokens) != 1 || account.Tokens[0].Name != "phone" || account.Tokens[0].LastUsed != nil {
+		t.Fatal("unexpected tokens:", account.Tokens)
+	}
+	if len(account.Identities) != 0 {
+		t.Fatal("expected no identities:", account.Identities)
+	}
+}
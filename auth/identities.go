@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// External identities.
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Placeholder password hash of users who sign in with an external identity.
+// It's not a valid bcrypt hash, so password sign-ins always fail.
+const noPassword = "!"
+
+// Checks if user can sign in with a password.
+// Users who registered with an external identity can't.
+func HasPassword(db *sql.DB, userID int) (bool, error) {
+	var password string
+	query := `SELECT password FROM user WHERE id = ?`
+	if err := db.QueryRow(query, userID).Scan(&password); err != nil {
+		return false, fmt.Errorf("user not found: %v", err)
+	}
+	return password != noPassword, nil
+}
+
+// Returned when a disabled user tries to sign in.
+var ErrDisabled = errors.New("user is disabled")
+
+// Finds user linked to external identity.
+// Returns user ID and username.
+// Returns ErrDisabled if the linked user is disabled.
+func FindIdentity(db *sql.DB, issuer, subject string) (int, string, error) {
+	var id int
+	var username string
+	var disabled bool
+	query := `
+		SELECT user.id, username, disabled FROM user_identity JOIN user ON (user_id = user.id)
+		WHERE issuer = ? AND subject = ?
+	`
+	if err := db.QueryRow(query, issuer, subject).Scan(&id, &username, &disabled); err != nil {
+		return 0, "", fmt.Errorf("identity not found: %v", err)
+	}
+	if disabled {
+		return id, username, ErrDisabled
+	}
+	return id, username, nil
+}
+
+// Links external identity to user.
+// Returns an error if the identity is already linked to a user.
+func LinkIdentity(db *sql.DB, userID int, issuer, subject string) error {
+	query := `INSERT INTO user_identity (issuer, subject, user_id) VALUES (?, ?, ?)`
+	if _, err := db.Exec(query, issuer, subject, userID); err != nil {
+		return errors.New("unable to link identity")
+	}
+	return nil
+}
+
+// Registers user who signs in with an external identity and links the
+// identity.
+// If the preferred username is taken, appends a number to it.
+// Returns the user ID and the username that was used.
+func RegisterIdentity(db *sql.DB, preferred, issuer, subject string) (int, string, error) {
+	preferred = strings.TrimSpace(preferred)
+	if preferred == "" {
+		return 0, "", errors.New("unable to register user: empty username")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to register user: %v", err)
+	}
+	defer tx.Rollback()
+
+	username := preferred
+	for i := 2; ; i++ {
+		var taken bool
+		query := `SELECT EXISTS (SELECT 1 FROM user WHERE username = ?)`
+		if err := tx.QueryRow(query, username).Scan(&taken); err != nil {
+			return 0, "", fmt.Errorf("unable to register user: %v", err)
+		}
+		if !taken {
+			break
+		}
+		username = fmt.Sprintf("%v-%v", preferred, i)
+	}
+
+	query := `INSERT INTO user (username, password) VALUES (?, ?)`
+	result, err := tx.Exec(query, username, noPassword)
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to register user: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to register user: %v", err)
+	}
+
+	query = `INSERT INTO user_identity (issuer, subject, user_id) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(query, issuer, subject, id); err != nil {
+		return 0, "", errors.New("unable to link identity")
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", fmt.Errorf("unable to register user: %v", err)
+	}
+	return int(id), username, nil
+}
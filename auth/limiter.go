@@ -0,0 +1,240 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Rate limiting of password attempts.
+// Each failed attempt blocks further attempts with the same key for an
+// exponentially increasing amount of time, and too many failures lock the key
+// out for a while.
+// State is stored in the users DB so it survives restarts.
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lggruspe/polycloze/database"
+)
+
+type limitPolicy struct {
+	freeAttempts int           // Failures allowed before backoff kicks in
+	lockout      int           // Failures before the key gets locked out
+	lockoutTime  time.Duration // How long lockouts last
+}
+
+var (
+	// Lenient, because students behind the same NAT share an IP address.
+	ipPolicy = limitPolicy{
+		freeAttempts: 20,
+		lockout:      100,
+		lockoutTime:  time.Hour,
+	}
+
+	userPolicy = limitPolicy{
+		freeAttempts: 3,
+		lockout:      10,
+		lockoutTime:  15 * time.Minute,
+	}
+)
+
+// Failures are forgotten after this much time without failures.
+const forgetFailures = 24 * time.Hour
+
+// Returns rate limit keys for request IP address and username.
+// Empty values are skipped.
+func LimitKeys(ip, username string) []string {
+	var keys []string
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	if username != "" {
+		keys = append(keys, "user:"+username)
+	}
+	return keys
+}
+
+func policyFor(key string) limitPolicy {
+	if strings.HasPrefix(key, "ip:") {
+		return ipPolicy
+	}
+	return userPolicy
+}
+
+// Computes how long to block key after it fails n times.
+func (p limitPolicy) delay(n int) time.Duration {
+	if n >= p.lockout {
+		return p.lockoutTime
+	}
+	if n <= p.freeAttempts {
+		return 0
+	}
+	delay := time.Second << (n - p.freeAttempts - 1)
+	if delay > p.lockoutTime {
+		return p.lockoutTime
+	}
+	return delay
+}
+
+// Checks if password attempts with any of the keys are blocked.
+// Returns how long the client has to wait, or 0 if the attempt is allowed.
+func CheckLimit(db *sql.DB, keys []string) (time.Duration, error) {
+	return checkLimitAt(db, keys, time.Now())
+}
+
+func checkLimitAt[T database.Querier](q T, keys []string, now time.Time) (time.Duration, error) {
+	wait, err := blockedFor(q, keys, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rate limit: %v", err)
+	}
+	return wait, nil
+}
+
+// Returns how long the longest-blocked key is blocked for.
+func blockedFor[T database.Querier](q T, keys []string, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	query := `SELECT blocked_until FROM login_attempt WHERE key = ?`
+	for _, key := range keys {
+		var until int64
+		err := q.QueryRow(query, key).Scan(&until)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if d := time.Unix(until, 0).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Records failed password attempt for each key.
+func RecordFailure(db *sql.DB, keys []string) error {
+	return recordFailureAt(db, keys, time.Now())
+}
+
+func recordFailureAt(db *sql.DB, keys []string, now time.Time) error {
+	err := database.InTransaction(db, func(tx *sql.Tx) error {
+		if err := forgetOldFailures(tx, now); err != nil {
+			return err
+		}
+		return addFailures(tx, keys, now)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record failed attempt: %v", err)
+	}
+	return nil
+}
+
+// Checks if password attempts with any of the keys are blocked, and if not,
+// records the attempt as a failure in the same transaction.
+// Otherwise concurrent attempts could all pass the check before any of them
+// fails. Attempts that don't fail should be undone with ReleaseAttempt.
+// Returns how long the client has to wait, or 0 if the attempt is allowed.
+func ReserveAttempt(db *sql.DB, keys []string) (time.Duration, error) {
+	return reserveAttemptAt(db, keys, time.Now())
+}
+
+func reserveAttemptAt(db *sql.DB, keys []string, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	err := database.InTransaction(db, func(tx *sql.Tx) error {
+		// Write before reading, so that the transaction holds the write
+		// lock while it checks the limit.
+		if err := forgetOldFailures(tx, now); err != nil {
+			return err
+		}
+
+		var err error
+		wait, err = blockedFor(tx, keys, now)
+		if err != nil || wait > 0 {
+			return err
+		}
+		return addFailures(tx, keys, now)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve attempt: %v", err)
+	}
+	return wait, nil
+}
+
+// Undoes ReserveAttempt after an attempt that didn't fail.
+func ReleaseAttempt(db *sql.DB, keys []string) error {
+	err := database.InTransaction(db, func(tx *sql.Tx) error {
+		for _, key := range keys {
+			var failures int
+			var last int64
+			query := `SELECT failures, last_failure FROM login_attempt WHERE key = ?`
+			err := tx.QueryRow(query, key).Scan(&failures, &last)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if failures > 0 {
+				failures--
+			}
+
+			until := time.Unix(last, 0).Add(policyFor(key).delay(failures))
+			query = `UPDATE login_attempt SET failures = ?, blocked_until = ? WHERE key = ?`
+			if _, err := tx.Exec(query, failures, until.Unix(), key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release attempt: %v", err)
+	}
+	return nil
+}
+
+// Increments failed attempts of each key, and blocks the key accordingly.
+func addFailures(tx *sql.Tx, keys []string, now time.Time) error {
+	for _, key := range keys {
+		var failures int
+		var last int64
+		query := `SELECT failures, last_failure FROM login_attempt WHERE key = ?`
+		err := tx.QueryRow(query, key).Scan(&failures, &last)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if now.Sub(time.Unix(last, 0)) > forgetFailures {
+			failures = 0
+		}
+		failures++
+
+		until := now.Add(policyFor(key).delay(failures))
+		query = `
+			INSERT INTO login_attempt (key, failures, last_failure, blocked_until)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET
+				failures = excluded.failures,
+				last_failure = excluded.last_failure,
+				blocked_until = excluded.blocked_until
+		`
+		if _, err := tx.Exec(query, key, failures, now.Unix(), until.Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleans up old entries.
+func forgetOldFailures(tx *sql.Tx, now time.Time) error {
+	query := `DELETE FROM login_attempt WHERE last_failure < ?`
+	_, err := tx.Exec(query, now.Add(-forgetFailures).Unix())
+	return err
+}
+
+// Clears failed attempts of key.
+// Should only be called with username keys after successful sign-ins, so
+// that an attacker with a valid account can't reset their IP address' limit.
+func ResetLimit(db *sql.DB, key string) error {
+	if _, err := db.Exec(`DELETE FROM login_attempt WHERE key = ?`, key); err != nil {
+		return fmt.Errorf("failed to reset rate limit: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimitBackoff(t *testing.T) {
+	// Failures beyond the free attempts should block the key for increasing
+	// amounts of time.
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	keys := LimitKeys("", "foo")
+	now := time.Now()
+
+	var previous time.Duration
+	for i := 0; i < userPolicy.lockout; i++ {
+		wait, err := checkLimitAt(db, keys, now)
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if i < userPolicy.freeAttempts && wait > 0 {
+			t.Fatal("expected free attempts to not be blocked:", i, wait)
+		}
+		if i > userPolicy.freeAttempts && wait <= previous {
+			t.Fatal("expected wait time to increase:", i, previous, wait)
+		}
+		previous = wait
+
+		if err := recordFailureAt(db, keys, now); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	wait, err := checkLimitAt(db, keys, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	// Timestamps are stored in seconds.
+	if wait <= userPolicy.lockoutTime-time.Second {
+		t.Fatal("expected key to be locked out:", wait)
+	}
+
+	// Lockout should expire.
+	wait, err = checkLimitAt(db, keys, now.Add(userPolicy.lockoutTime))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if wait > 0 {
+		t.Fatal("expected lockout to expire:", wait)
+	}
+}
+
+func TestLimitKeysAreIndependent(t *testing.T) {
+	// Locking out one username shouldn't affect other usernames, unless the IP
+	// address is also blocked.
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	now := time.Now()
+	for i := 0; i < userPolicy.lockout; i++ {
+		if err := recordFailureAt(db, LimitKeys("127.0.0.1", "foo"), now); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	wait, err := checkLimitAt(db, LimitKeys("127.0.0.1", "bar"), now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if wait > 0 {
+		t.Fatal("expected other username to not be blocked:", wait)
+	}
+}
+
+func TestResetLimit(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	keys := LimitKeys("", "foo")
+	now := time.Now()
+	for i := 0; i < userPolicy.lockout; i++ {
+		if err := recordFailureAt(db, keys, now); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	if err := ResetLimit(db, keys[0]); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	wait, err := checkLimitAt(db, keys, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if wait > 0 {
+		t.Fatal("expected reset key to not be blocked:", wait)
+	}
+}
+
+func TestLimitForgetsOldFailures(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	keys := LimitKeys("", "foo")
+	then := time.Now().Add(-2 * forgetFailures)
+	for i := 0; i < userPolicy.lockout; i++ {
+		if err := recordFailureAt(db, keys, then); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	// One new failure shouldn't lock the key out again.
+	now := time.Now()
+	if err := recordFailureAt(db, keys, now); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	wait, err := checkLimitAt(db, keys, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if wait > 0 {
+		t.Fatal("expected old failures to be forgotten:", wait)
+	}
+}
+
+func TestReserveAttemptConcurrent(t *testing.T) {
+	// Concurrent attempts shouldn't all get past the limit before any of them
+	// fails.
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	keys := LimitKeys("", "foo")
+	now := time.Now()
+
+	n := 4 * userPolicy.lockout
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := reserveAttemptAt(db, keys, now)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if wait <= 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Only free attempts and the first attempt that triggers the backoff can
+	// get through at the same time.
+	if got := allowed.Load(); got != int64(userPolicy.freeAttempts+1) {
+		t.Fatal("expected concurrent attempts to be limited:", got)
+	}
+}
+
+func TestReleaseAttempt(t *testing.T) {
+	// Released attempts shouldn't count as failures.
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	keys := LimitKeys("127.0.0.1", "foo")
+	for i := 0; i < userPolicy.lockout; i++ {
+		wait, err := ReserveAttempt(db, keys)
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if wait > 0 {
+			t.Fatal("expected released attempts to not be blocked:", i, wait)
+		}
+		if err := ReleaseAttempt(db, keys); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Password policy.
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Min number of characters in a password.
+const MinPasswordLength = 8
+
+// Max number of bytes in a password.
+// bcrypt ignores everything after the 72nd byte.
+const MaxPasswordLength = 72
+
+var (
+	ErrPasswordTooShort = fmt.Errorf("password should have at least %v characters", MinPasswordLength)
+	ErrPasswordTooLong  = fmt.Errorf("password should be at most %v bytes long", MaxPasswordLength)
+	ErrPasswordBreached = errors.New("password is too common or has appeared in a data breach")
+)
+
+// Set of common or breached passwords.
+// Only stores SHA-1 hashes, so lists of plaintext passwords and lists of
+// hashes (e.g. from Have I Been Pwned) take up the same amount of memory.
+type BreachedPasswords struct {
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// Reads list of common or breached passwords.
+// Each line is either a plaintext password or the uppercase or lowercase hex
+// SHA-1 hash of one. Hashes may be followed by ":count", like in the Have I
+// Been Pwned password lists.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load breached passwords: %v", err)
+	}
+	defer file.Close()
+
+	b := &BreachedPasswords{hashes: make(map[[sha1.Size]byte]struct{})}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		b.hashes[parseBreachedPassword(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load breached passwords: %v", err)
+	}
+	return b, nil
+}
+
+// Returns SHA-1 hash of password in breached password list.
+func parseBreachedPassword(line string) [sha1.Size]byte {
+	var sum [sha1.Size]byte
+
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) == hex.EncodedLen(sha1.Size) {
+		if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+			return sum
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// Number of passwords in the list.
+func (b *BreachedPasswords) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.hashes)
+}
+
+// Checks if the password is in the list.
+func (b *BreachedPasswords) Contains(password string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := b.hashes[sha1.Sum([]byte(password))]
+	return ok
+}
+
+var (
+	breachedMu        sync.RWMutex
+	breachedPasswords *BreachedPasswords
+)
+
+// Sets list of passwords that CheckPassword rejects.
+// Pass nil to turn off the check.
+func SetBreachedPasswords(b *BreachedPasswords) {
+	breachedMu.Lock()
+	defer breachedMu.Unlock()
+	breachedPasswords = b
+}
+
+func checkPassword(password string, breached *BreachedPasswords) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	if breached.Contains(password) {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// Checks if the password satisfies the password policy.
+func CheckPassword(password string) error {
+	breachedMu.RLock()
+	defer breachedMu.RUnlock()
+	return checkPassword(password, breachedPasswords)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPasswordLength(t *testing.T) {
+	t.Parallel()
+
+	if err := checkPassword("short", nil); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatal("expected ErrPasswordTooShort:", err)
+	}
+
+	// Length is counted in characters, not bytes.
+	if err := checkPassword("ññññññññ", nil); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if err := checkPassword(strings.Repeat("a", MaxPasswordLength), nil); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := checkPassword(strings.Repeat("a", MaxPasswordLength+1), nil); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatal("expected ErrPasswordTooLong:", err)
+	}
+	if err := checkPassword(strings.Repeat("ñ", 40), nil); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatal("expected ErrPasswordTooLong:", err)
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	t.Parallel()
+
+	// Plaintext passwords and SHA-1 hashes (with and without counts) can be
+	// mixed.
+	contents := strings.Join([]string{
+		"password",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", // "password"
+		"7c4a8d09ca3762af61e59520943dc26494f8941b", // "123456"
+		"B1B3773A05C0ED0176787A4F1574FF0075F7521E:42",
+		"",
+		"iloveyou\r",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if n := breached.Len(); n != 4 {
+		t.Fatal("expected 4 passwords:", n)
+	}
+	for _, password := range []string{"password", "123456", "qwerty", "iloveyou"} {
+		if !breached.Contains(password) {
+			t.Fatal("expected password to be in list:", password)
+		}
+	}
+	if breached.Contains("correct horse") {
+		t.Fatal("expected password to not be in list")
+	}
+	if err := checkPassword("iloveyou", breached); !errors.Is(err, ErrPasswordBreached) {
+		t.Fatal("expected ErrPasswordBreached:", err)
+	}
+}
+
+func TestLoadBreachedPasswordsMissingFile(t *testing.T) {
+	t.Parallel()
+
+	if _, err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected err to be non-nil")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Personal API tokens.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prefix of API tokens, so they're easy to recognize (e.g. in leaked logs).
+const tokenPrefix = "pc_"
+
+// Limits what an API token can be used for.
+type Scope string
+
+const (
+	// Can only make safe requests (GET and HEAD).
+	ScopeReadOnly Scope = "read-only"
+
+	// Can also upload reviews.
+	ScopeReview Scope = "review"
+)
+
+func (s Scope) IsValid() bool {
+	return s == ScopeReadOnly || s == ScopeReview
+}
+
+// Checks if the scope allows requests with the given method.
+func (s Scope) Allows(method string) bool {
+	switch method {
+	case "GET", "HEAD":
+		return s.IsValid()
+	case "POST":
+		return s == ScopeReview
+	default:
+		return false
+	}
+}
+
+// API token info. Doesn't include the token itself, which is only shown once
+// after it's created.
+type Token struct {
+	ID       int
+	UserID   int
+	Username string
+	Name     string
+	Scope    Scope
+	Created  time.Time
+	LastUsed time.Time // Zero if the token hasn't been used yet.
+}
+
+// Generates random token with 256 bits of entropy.
+func generateToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Creates new API token for user.
+// Returns the token, which only gets stored as a hash.
+func CreateToken(db *sql.DB, userID int, name string, scope Scope) (string, error) {
+	if !scope.IsValid() {
+		return "", fmt.Errorf("invalid token scope: %v", scope)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("token name should not be empty")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %v", err)
+	}
+
+	query := `INSERT INTO api_token (user_id, name, hash, scope) VALUES (?, ?, ?, ?)`
+	if _, err := db.Exec(query, userID, name, hashToken(token), scope); err != nil {
+		return "", fmt.Errorf("failed to create token: %v", err)
+	}
+	return token, nil
+}
+
+// Lists user's API tokens, newest first.
+func ListTokens(db *sql.DB, userID int) ([]Token, error) {
+	query := `
+		SELECT api_token.id, user_id, username, name, scope, created, last_used
+		FROM api_token JOIN user ON (user_id = user.id)
+		WHERE user_id = ?
+		ORDER BY api_token.id DESC
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]Token, 0)
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tokens: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(s scanner) (Token, error) {
+	var token Token
+	var created int64
+	var lastUsed sql.NullInt64
+	err := s.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Username,
+		&token.Name,
+		&token.Scope,
+		&created,
+		&lastUsed,
+	)
+	token.Created = time.Unix(created, 0)
+	if lastUsed.Valid {
+		token.LastUsed = time.Unix(lastUsed.Int64, 0)
+	}
+	return token, err
+}
+
+// Revokes user's API token.
+// Returns an error if the user doesn't own a token with the given ID.
+func RevokeToken(db *sql.DB, userID, tokenID int) error {
+	query := `DELETE FROM api_token WHERE id = ? AND user_id = ?`
+	result, err := db.Exec(query, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errors.New("failed to revoke token: token not found")
+	}
+	return nil
+}
+
+// Looks up API token and updates its last used timestamp.
+func AuthenticateToken(db *sql.DB, token string) (Token, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return Token{}, errors.New("invalid API token")
+	}
+
+	query := `
+		SELECT api_token.id, user_id, username, name, scope, created, last_used
+		FROM api_token JOIN user ON (user_id = user.id)
+		WHERE hash = ? AND NOT user.disabled
+	`
+	result, err := scanToken(db.QueryRow(query, hashToken(token)))
+	if err != nil {
+		return Token{}, errors.New("invalid API token")
+	}
+
+	query = `UPDATE api_token SET last_used = unixepoch('now') WHERE id = ?`
+	if _, err := db.Exec(query, result.ID); err != nil {
+		return Token{}, fmt.Errorf("failed to update token: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateToken(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	id, err := Authenticate(db, "foo", "correct horse")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	token, err := CreateToken(db, id, "script", ScopeReview)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Tokens shouldn't be stored in plaintext.
+	var hash string
+	query := `SELECT hash FROM api_token WHERE user_id = ?`
+	if err := db.QueryRow(query, id).Scan(&hash); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if strings.Contains(hash, token) || strings.Contains(token, hash) {
+		t.Fatal("token should not be stored in plaintext")
+	}
+
+	result, err := AuthenticateToken(db, token)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if result.UserID != id || result.Username != "foo" || result.Scope != ScopeReview {
+		t.Fatal("unexpected token info:", result)
+	}
+
+	tokens, err := ListTokens(db, id)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsed.IsZero() {
+		t.Fatal("expected last used timestamp to be updated:", tokens, err)
+	}
+}
+
+func TestCreateTokenInvalidScope(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := CreateToken(db, 1, "script", Scope("admin")); err == nil {
+		t.Fatal("expected err to be non-nil for invalid scope")
+	}
+}
+
+func TestAuthenticateInvalidToken(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if _, err := AuthenticateToken(db, "pc_foo"); err == nil {
+		t.Fatal("expected err to be non-nil for invalid token")
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := Register(db, "baz", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	token, err := CreateToken(db, 1, "script", ScopeReadOnly)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	tokens, err := ListTokens(db, 1)
+	if err != nil || len(tokens) != 1 {
+		t.Fatal("expected one token:", tokens, err)
+	}
+
+	// Users shouldn't be able to revoke other users' tokens.
+	if err := RevokeToken(db, 2, tokens[0].ID); err == nil {
+		t.Fatal("expected err to be non-nil when revoking other user's token")
+	}
+
+	if err := RevokeToken(db, 1, tokens[0].ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := AuthenticateToken(db, token); err == nil {
+		t.Fatal("expected revoked token to be invalid")
+	}
+}
+
+func TestMiddlewareBearerToken(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	token, err := CreateToken(db, 1, "script", ScopeReadOnly)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	handler := Middleware(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetToken(r); !ok {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+
+	cases := []struct {
+		method string
+		header string
+		code   int
+	}{
+		{"GET", "", http.StatusTeapot},
+		{"GET", "Bearer " + token, http.StatusOK},
+		{"POST", "Bearer " + token, http.StatusForbidden},
+		{"GET", "Bearer pc_invalid", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != c.code {
+			t.Fatal("unexpected status code:", c.method, c.header, w.Code)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// TOTP two-factor authentication.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lggruspe/polycloze/totp"
+)
+
+// Number of recovery codes generated on enrollment.
+const recoveryCodeCount = 10
+
+// Returned when 2FA code is wrong.
+var ErrInvalidCode = errors.New("invalid two-factor authentication code")
+
+// Checks if user has 2FA enabled.
+func HasTOTP(db *sql.DB, userID int) (bool, error) {
+	var enabled bool
+	query := `SELECT enabled FROM user_totp WHERE user_id = ?`
+	err := db.QueryRow(query, userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check two-factor authentication: %v", err)
+	}
+	return enabled, nil
+}
+
+// Starts 2FA enrollment.
+// Returns a new secret that has to be confirmed with ConfirmTOTP.
+func SetupTOTP(db *sql.DB, userID int) (string, error) {
+	enabled, err := HasTOTP(db, userID)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", fmt.Errorf("failed to set up two-factor authentication: %v", err)
+	}
+
+	query := `
+		INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret
+	`
+	if _, err := db.Exec(query, userID, secret); err != nil {
+		return "", fmt.Errorf("failed to set up two-factor authentication: %v", err)
+	}
+	return secret, nil
+}
+
+// Generates recovery code with 80 bits of entropy, e.g. abcd-efgh-ijkl-mnop.
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(bytes))
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Completes 2FA enrollment if the code is valid.
+// Returns recovery codes, which are only stored as hashes.
+func ConfirmTOTP(db *sql.DB, userID int, code string) ([]string, error) {
+	return confirmTOTPAt(db, userID, code, time.Now())
+}
+
+func confirmTOTPAt(db *sql.DB, userID int, code string, now time.Time) ([]string, error) {
+	var secret string
+	var enabled bool
+	query := `SELECT secret, enabled FROM user_totp WHERE user_id = ?`
+	if err := db.QueryRow(query, userID).Scan(&secret, &enabled); err != nil {
+		return nil, errors.New("two-factor authentication hasn't been set up")
+	}
+	if enabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	step, ok := totp.Validate(secret, code, now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+	defer tx.Rollback()
+
+	query = `UPDATE user_totp SET enabled = 1, last_step = ? WHERE user_id = ?`
+	if _, err := tx.Exec(query, step, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_code WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	query = `INSERT INTO recovery_code (user_id, hash) VALUES (?, ?)`
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+		}
+		if _, err := tx.Exec(query, userID, hashRecoveryCode(code)); err != nil {
+			return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+	return codes, nil
+}
+
+// Checks TOTP code or recovery code during sign-in.
+// TOTP codes can't be reused, and recovery codes can only be used once.
+func VerifyTOTP(db *sql.DB, userID int, code string) error {
+	return verifyTOTPAt(db, userID, code, time.Now())
+}
+
+func verifyTOTPAt(db *sql.DB, userID int, code string, now time.Time) error {
+	var secret string
+	query := `SELECT secret FROM user_totp WHERE user_id = ? AND enabled`
+	if err := db.QueryRow(query, userID).Scan(&secret); err != nil {
+		return ErrInvalidCode
+	}
+
+	if step, ok := totp.Validate(secret, code, now); ok {
+		// The condition makes sure that concurrent requests with the same
+		// code can't both succeed.
+		query := `UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?`
+		result, err := db.Exec(query, step, userID, step)
+		if err != nil {
+			return fmt.Errorf("failed to verify code: %v", err)
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	query = `DELETE FROM recovery_code WHERE user_id = ? AND hash = ?`
+	result, err := db.Exec(query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to verify code: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// Returns number of unused recovery codes.
+func RecoveryCodesLeft(db *sql.DB, userID int) (int, error) {
+	var count int
+	query := `SELECT count(*) FROM recovery_code WHERE user_id = ?`
+	if err := db.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %v", err)
+	}
+	return count, nil
+}
+
+// Turns off 2FA and deletes recovery codes.
+func DisableTOTP(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_code WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %v", err)
+	}
+	return tx.Commit()
+}
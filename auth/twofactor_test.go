@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lggruspe/polycloze/totp"
+)
+
+func TestTOTPEnrollment(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	secret, err := SetupTOTP(db, 1)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// 2FA shouldn't be enabled until it's confirmed.
+	if enabled, err := HasTOTP(db, 1); err != nil || enabled {
+		t.Fatal("expected 2FA to not be enabled yet:", enabled, err)
+	}
+	if _, err := confirmTOTPAt(db, 1, "000000", time.Now().Add(-time.Hour)); err == nil {
+		t.Fatal("expected wrong code to be rejected")
+	}
+
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	codes, err := confirmTOTPAt(db, 1, code, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatal("expected recovery codes:", codes)
+	}
+	if enabled, err := HasTOTP(db, 1); err != nil || !enabled {
+		t.Fatal("expected 2FA to be enabled:", enabled, err)
+	}
+
+	// The code used for enrollment shouldn't work for signing in.
+	if err := verifyTOTPAt(db, 1, code, now); err == nil {
+		t.Fatal("expected reused code to be rejected")
+	}
+
+	later := now.Add(time.Minute)
+	code, err = totp.Code(secret, later)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := verifyTOTPAt(db, 1, code, later); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := verifyTOTPAt(db, 1, code, later); err == nil {
+		t.Fatal("expected reused code to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	secret, err := SetupTOTP(db, 1)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	codes, err := confirmTOTPAt(db, 1, code, now)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Recovery codes should be stored hashed.
+	var count int
+	query := `SELECT count(*) FROM recovery_code WHERE hash = ?`
+	if err := db.QueryRow(query, codes[0]).Scan(&count); err != nil || count != 0 {
+		t.Fatal("expected recovery codes to not be stored in plaintext:", count, err)
+	}
+
+	if err := VerifyTOTP(db, 1, codes[0]); err != nil {
+		t.Fatal("expected recovery code to be accepted:", err)
+	}
+	if err := VerifyTOTP(db, 1, codes[0]); err == nil {
+		t.Fatal("expected recovery code to only work once")
+	}
+	if left, err := RecoveryCodesLeft(db, 1); err != nil || left != recoveryCodeCount-1 {
+		t.Fatal("expected one recovery code to be used up:", left, err)
+	}
+
+	if err := DisableTOTP(db, 1); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if enabled, err := HasTOTP(db, 1); err != nil || enabled {
+		t.Fatal("expected 2FA to be disabled:", enabled, err)
+	}
+	if err := VerifyTOTP(db, 1, codes[1]); err == nil {
+		t.Fatal("expected recovery codes to be deleted")
+	}
+}
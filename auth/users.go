@@ -0,0 +1,131 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// User administration.
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+type User struct {
+	ID       int
+	Username string
+	Role     Role
+	Disabled bool
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Looks up user by ID.
+func GetUser(db *sql.DB, userID int) (User, error) {
+	var user User
+	query := `SELECT id, username, role, disabled FROM user WHERE id = ?`
+	err := db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Role, &user.Disabled)
+	if err != nil {
+		return user, fmt.Errorf("user not found: %v", err)
+	}
+	return user, nil
+}
+
+// Lists all users, sorted by ID.
+func ListUsers(db *sql.DB) ([]User, error) {
+	rows, err := db.Query(`SELECT id, username, role, disabled FROM user ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.Disabled); err != nil {
+			return nil, fmt.Errorf("failed to list users: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// Sets role of user with the given username.
+func SetRole(db *sql.DB, username string, role Role) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("invalid role: %v", role)
+	}
+	result, err := db.Exec(`UPDATE user SET role = ? WHERE username = ?`, role, username)
+	if err != nil {
+		return fmt.Errorf("failed to set role: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errors.New("failed to set role: user not found")
+	}
+	return nil
+}
+
+// Disables or re-enables user.
+// Disabling a user also ends the user's sessions.
+func SetDisabled(db *sql.DB, userID int, disabled bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE user SET disabled = ? WHERE id = ?`, disabled, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errors.New("failed to update user: user not found")
+	}
+	if disabled {
+		if _, err := tx.Exec(`DELETE FROM user_session WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("failed to update user: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Deletes user along with the user's sessions, API tokens, linked identities
+// and 2FA settings.
+// Doesn't delete the user's files.
+func DeleteUser(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM user_session WHERE user_id = ?`,
+		`DELETE FROM api_token WHERE user_id = ?`,
+		`DELETE FROM user_identity WHERE user_id = ?`,
+		`DELETE FROM user_totp WHERE user_id = ?`,
+		`DELETE FROM recovery_code WHERE user_id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("failed to delete user: %v", err)
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM user WHERE id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errors.New("failed to delete user: user not found")
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package auth
+
+import (
+	"testing"
+)
+
+func TestSetRole(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	user, err := GetUser(db, 1)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if user.IsAdmin() {
+		t.Fatal("expected new user to not be an admin")
+	}
+
+	if err := SetRole(db, "foo", RoleAdmin); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if user, err := GetUser(db, 1); err != nil || !user.IsAdmin() {
+		t.Fatal("expected user to be an admin:", user, err)
+	}
+
+	if err := SetRole(db, "baz", RoleAdmin); err == nil {
+		t.Fatal("expected err to be non-nil for non-existent user")
+	}
+}
+
+func TestDisabledUserCantSignIn(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	token, err := CreateToken(db, 1, "script", ScopeReadOnly)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if err := SetDisabled(db, 1, true); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := Authenticate(db, "foo", "correct horse"); err == nil {
+		t.Fatal("expected disabled user to not be able to sign in")
+	}
+	if _, err := AuthenticateToken(db, token); err == nil {
+		t.Fatal("expected disabled user's tokens to be rejected")
+	}
+
+	if err := SetDisabled(db, 1, false); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := Authenticate(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected re-enabled user to be able to sign in:", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Parallel()
+	db := openDB()
+	defer db.Close()
+
+	if err := Register(db, "foo", "correct horse"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := CreateToken(db, 1, "script", ScopeReadOnly); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := LinkIdentity(db, 1, "https://example.com", "foo"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if err := DeleteUser(db, 1); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := GetUser(db, 1); err == nil {
+		t.Fatal("expected user to be deleted")
+	}
+	if _, _, err := FindIdentity(db, "https://example.com", "foo"); err == nil {
+		t.Fatal("expected identity to be deleted")
+	}
+	if err := DeleteUser(db, 1); err == nil {
+		t.Fatal("expected err to be non-nil for non-existent user")
+	}
+
+	// Username should be available again, but not the ID, so that new
+	// users don't inherit leftover files.
+	if err := Register(db, "foo", "battery staple"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	id, err := Authenticate(db, "foo", "battery staple")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if id == 1 {
+		t.Fatal("expected deleted user's ID to not be reused")
+	}
+}
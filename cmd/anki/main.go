@@ -0,0 +1,137 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Imports review history from Anki into a review DB.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lggruspe/polycloze/anki"
+	"github.com/lggruspe/polycloze/anki_import"
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/database"
+)
+
+type Args struct {
+	dryRun     bool
+	verbose    bool
+	field      string
+	collection string // path to .apkg or collection.anki2
+	review     string // path to review DB
+}
+
+func parseArgs() Args {
+	var args Args
+	flag.BoolVar(&args.dryRun, "n", false, "dry run (only report changes)")
+	flag.BoolVar(&args.verbose, "v", false, "verbose")
+	flag.StringVar(&args.field, "field", "", "name of note field that contains the word (default: first field)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %v [flags] <deck.apkg|collection.anki2> <l1-l2.db>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	nonFlags := flag.Args()
+	if len(nonFlags) != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	args.collection = nonFlags[0]
+	args.review = nonFlags[1]
+	return args
+}
+
+// Infers course languages from review DB file name ("{l1}-{l2}.db").
+func inferCourse(review string) (string, string, error) {
+	name := strings.TrimSuffix(filepath.Base(review), ".db")
+	l1, l2, ok := strings.Cut(name, "-")
+	if !ok {
+		return "", "", fmt.Errorf("could not infer course from file name: %v", review)
+	}
+	return l1, l2, nil
+}
+
+func printPlan(plan anki_import.Plan, verbose bool) {
+	fmt.Printf(
+		"%v notes mapped (%v reviews), %v unmapped, %v skipped\n",
+		len(plan.Mappings),
+		len(plan.Events),
+		len(plan.Unmapped),
+		len(plan.Skipped),
+	)
+	if !verbose {
+		return
+	}
+	for _, mapping := range plan.Mappings {
+		fmt.Printf("\t%v -> %v\n", mapping.Field, mapping.Word)
+	}
+	for _, field := range plan.Unmapped {
+		fmt.Printf("\t%v -> ?\n", field)
+	}
+	for _, word := range plan.Skipped {
+		fmt.Printf("\t%v (already reviewed)\n", word)
+	}
+}
+
+func importReviews(args Args) error {
+	l1, l2, err := inferCourse(args.review)
+	if err != nil {
+		return err
+	}
+	course := basedir.Course(l1, l2)
+	if _, err := os.Stat(course); err != nil {
+		return fmt.Errorf("course not installed: %v", course)
+	}
+
+	collection, err := anki.Read(args.collection)
+	if err != nil {
+		return err
+	}
+
+	// Dry runs shouldn't even upgrade the review DB.
+	var db *sql.DB
+	if args.dryRun {
+		db, err = database.Open(fmt.Sprintf("file:%s?mode=ro", args.review))
+	} else {
+		db, err = database.New(args.review)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	con, err := database.NewConnection(db, context.TODO(), database.AttachCourse(course))
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	plan, err := anki_import.MakePlan(con, collection, args.field)
+	if err != nil {
+		return err
+	}
+	printPlan(plan, args.verbose)
+
+	if args.dryRun {
+		return nil
+	}
+	return anki_import.Apply(con, plan)
+}
+
+func main() {
+	args := parseArgs()
+	if args.dryRun {
+		fmt.Println("# Dry run: no changes will be written.")
+	}
+	if err := importReviews(args); err != nil {
+		log.Fatal(err)
+	}
+}
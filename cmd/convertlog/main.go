@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Converts review logs to the current log format.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/logger"
+)
+
+type Args struct {
+	dryRun bool
+	logs   []string // paths to log files
+}
+
+func parseArgs() Args {
+	var args Args
+	flag.BoolVar(&args.dryRun, "n", false, "dry run (only check that logs can be parsed)")
+	flag.Parse()
+
+	args.logs = flag.Args()
+	if len(args.logs) == 0 {
+		pattern := filepath.Join(basedir.StateDir, "users", "*", "logs", "*.log")
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		args.logs = matches
+	}
+	return args
+}
+
+// Infers course from log file name ("{l1}-{l2}.log").
+func inferCourse(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".log")
+}
+
+func convert(path string, dryRun bool) error {
+	if dryRun {
+		events, err := logger.ParseFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v: %v events\n", path, len(events))
+		return nil
+	}
+
+	n, err := logger.ConvertFile(path, inferCourse(path))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v: %v events converted\n", path, n)
+	return nil
+}
+
+func main() {
+	args := parseArgs()
+	if args.dryRun {
+		fmt.Println("# Dry run: no changes will be written.")
+	}
+
+	failed := false
+	for _, path := range args.logs {
+		if err := convert(path, args.dryRun); err != nil {
+			log.Printf("%v: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
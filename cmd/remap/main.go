@@ -0,0 +1,153 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Remaps review items of all users after course rebuilds.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lggruspe/polycloze/basedir"
+	"github.com/lggruspe/polycloze/course_version"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/remap"
+)
+
+type Args struct {
+	dryRun  bool
+	verbose bool
+	reviews []string // paths to review DBs
+}
+
+func parseArgs() Args {
+	var args Args
+	flag.BoolVar(&args.dryRun, "n", false, "dry run (only report changes)")
+	flag.BoolVar(&args.verbose, "v", false, "verbose")
+	flag.Parse()
+
+	args.reviews = flag.Args()
+	if len(args.reviews) == 0 {
+		pattern := filepath.Join(basedir.StateDir, "users", "*", "reviews", "*.db")
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		args.reviews = matches
+	}
+	return args
+}
+
+// Infers course languages from review DB file name ("{l1}-{l2}.db").
+func inferCourse(review string) (string, string, error) {
+	name := strings.TrimSuffix(filepath.Base(review), ".db")
+	l1, l2, ok := strings.Cut(name, "-")
+	if !ok {
+		return "", "", fmt.Errorf("could not infer course from file name: %v", review)
+	}
+	return l1, l2, nil
+}
+
+// Returns version of course.
+func courseVersion(path string) (string, error) {
+	db, err := database.Open(fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	m, err := course_version.ReadMetadata(db)
+	return m.Version(), err
+}
+
+func printPlan(review string, plan remap.Plan, verbose bool) {
+	fmt.Printf("%v: %v remapped, %v unmapped\n", review, len(plan.Mappings), len(plan.Unmapped))
+	if !verbose {
+		return
+	}
+	for _, mapping := range plan.Mappings {
+		fmt.Printf("\t%v -> %v (%v)\n", mapping.Item, mapping.Word, mapping.Method)
+	}
+	for _, item := range plan.Unmapped {
+		fmt.Printf("\t%v -> ?\n", item)
+	}
+}
+
+// Remaps orphaned items in review DB.
+// Also records the course version, so that the server doesn't report the same
+// orphans again.
+func remapReviews(review string, args Args) error {
+	l1, l2, err := inferCourse(review)
+	if err != nil {
+		return err
+	}
+	course := basedir.Course(l1, l2)
+	if _, err := os.Stat(course); err != nil {
+		return fmt.Errorf("course not installed: %v", course)
+	}
+	version, err := courseVersion(course)
+	if err != nil {
+		return fmt.Errorf("could not read course version: %v", err)
+	}
+
+	// Dry runs shouldn't even upgrade the review DB.
+	var db *sql.DB
+	if args.dryRun {
+		db, err = database.Open(fmt.Sprintf("file:%s?mode=ro", review))
+	} else {
+		db, err = database.New(review)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	con, err := database.NewConnection(db, context.TODO(), database.AttachCourse(course))
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	orphans, err := course_version.OrphanedItems(con)
+	if err != nil {
+		return err
+	}
+	plan, err := remap.MakePlan(con, orphans)
+	if err != nil {
+		return err
+	}
+	printPlan(review, plan, args.verbose)
+
+	if args.dryRun {
+		return nil
+	}
+	if err := remap.Apply(con, plan); err != nil {
+		return err
+	}
+	_, err = course_version.RecordVersion(con, version)
+	return err
+}
+
+func main() {
+	args := parseArgs()
+	if args.dryRun {
+		fmt.Println("# Dry run: no changes will be written.")
+	}
+
+	failed := false
+	for _, review := range args.reviews {
+		if err := remapReviews(review, args); err != nil {
+			log.Printf("%v: %v\n", review, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Course metadata and versioning.
+package course_version
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/lggruspe/polycloze/database"
+)
+
+// Course metadata written by the course builder.
+// Courses built before the metadata table existed only have a ContentHash,
+// which gets computed by the server.
+type Metadata struct {
+	BuilderVersion string `json:"builderVersion,omitempty"`
+	DatasetDate    string `json:"datasetDate,omitempty"` // Date of Tatoeba data (YYYY-MM-DD)
+	ContentHash    string `json:"contentHash"`
+	License        string `json:"license,omitempty"`
+}
+
+// Course version.
+// Two builds of a course have the same version iff they have the same words.
+func (m Metadata) Version() string {
+	return m.ContentHash
+}
+
+func hasMetadataTable[T database.Querier](q T) (bool, error) {
+	query := `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'metadata'`
+	var count int
+	err := q.QueryRow(query).Scan(&count)
+	return count > 0, err
+}
+
+// Reads metadata from course database.
+// q should be a connection to the course database (not attached).
+func ReadMetadata[T database.Querier](q T) (Metadata, error) {
+	var m Metadata
+
+	ok, err := hasMetadataTable(q)
+	if err != nil {
+		return m, fmt.Errorf("failed to read course metadata: %v", err)
+	}
+	if ok {
+		rows, err := q.Query(`SELECT key, value FROM metadata`)
+		if err != nil {
+			return m, fmt.Errorf("failed to read course metadata: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key, value string
+			if err := rows.Scan(&key, &value); err != nil {
+				return m, fmt.Errorf("failed to read course metadata: %v", err)
+			}
+			switch key {
+			case "builder_version":
+				m.BuilderVersion = value
+			case "dataset_date":
+				m.DatasetDate = value
+			case "content_hash":
+				m.ContentHash = value
+			case "license":
+				m.License = value
+			}
+		}
+	}
+
+	if m.ContentHash == "" {
+		m.ContentHash, err = ContentHash(q)
+		if err != nil {
+			return m, fmt.Errorf("failed to read course metadata: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// Computes hash of the words in the course.
+// SHA-256 of newline-separated words sorted in code point order.
+// NOTE The course builder (python/scripts/metadata.py) computes the same
+// hash, so any changes here should be reflected there as well.
+func ContentHash[T database.Querier](q T) (string, error) {
+	rows, err := q.Query(`SELECT word FROM word ORDER BY word ASC`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	hash := sha256.New()
+	first := true
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			return "", err
+		}
+		if !first {
+			hash.Write([]byte("\n"))
+		}
+		hash.Write([]byte(word))
+		first = false
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Returns course version that the review database was last used with.
+// Returns an empty string if there's none.
+func LastVersion[T database.Querier](q T) (string, error) {
+	var version string
+	err := q.QueryRow(`SELECT version FROM course_version`).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return version, err
+}
+
+// Records course version in review database.
+// Returns the previously recorded version (empty if none).
+func RecordVersion[T database.Querier](q T, version string) (string, error) {
+	previous, err := LastVersion(q)
+	if err != nil {
+		return "", fmt.Errorf("failed to record course version: %v", err)
+	}
+	if previous == version {
+		return previous, nil
+	}
+
+	query := `
+		INSERT INTO course_version (id, version) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			version = excluded.version,
+			updated = unixepoch('now')
+	`
+	if _, err := q.Exec(query, version); err != nil {
+		return "", fmt.Errorf("failed to record course version: %v", err)
+	}
+	return previous, nil
+}
+
+// Returns review items that don't match any word in the course.
+// q should be a connection to a review database with the course attached.
+func OrphanedItems[T database.Querier](q T) ([]string, error) {
+	query := `SELECT item FROM review WHERE item NOT IN (SELECT word FROM word) ORDER BY item`
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orphaned items: %v", err)
+	}
+	defer rows.Close()
+
+	items := make([]string, 0)
+	for rows.Next() {
+		var item string
+		if err := rows.Scan(&item); err != nil {
+			return nil, fmt.Errorf("failed to find orphaned items: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Records orphaned items found after updating to the course version.
+// Replaces previously recorded items.
+func RecordOrphans[T database.Querier](q T, version string, items []string) error {
+	if _, err := q.Exec(`DELETE FROM orphaned_item`); err != nil {
+		return fmt.Errorf("failed to record orphaned items: %v", err)
+	}
+	query := `INSERT INTO orphaned_item (item, version) VALUES (?, ?)`
+	for _, item := range items {
+		if _, err := q.Exec(query, item, version); err != nil {
+			return fmt.Errorf("failed to record orphaned items: %v", err)
+		}
+	}
+	return nil
+}
+
+// Returns recorded orphaned items (see RecordOrphans).
+func RecordedOrphans[T database.Querier](q T) ([]string, error) {
+	rows, err := q.Query(`SELECT item FROM orphaned_item ORDER BY item`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read orphaned items: %v", err)
+	}
+	defer rows.Close()
+
+	items := make([]string, 0)
+	for rows.Next() {
+		var item string
+		if err := rows.Scan(&item); err != nil {
+			return nil, fmt.Errorf("failed to read orphaned items: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package course_version
+
+import (
+	"testing"
+
+	"github.com/lggruspe/polycloze/utils"
+)
+
+func TestReadMetadata(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	query := `INSERT INTO metadata (key, value) VALUES (?, ?)`
+	if _, err := db.Exec(query, "dataset_date", "2022-11-14"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := db.Exec(query, "content_hash", "abc"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	m, err := ReadMetadata(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if m.DatasetDate != "2022-11-14" || m.Version() != "abc" {
+		t.Fatal("unexpected metadata:", m)
+	}
+}
+
+func TestReadMetadataMissingTable(t *testing.T) {
+	// Old courses without metadata should still get a version.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	if _, err := db.Exec(`DROP TABLE metadata`); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	m, err := ReadMetadata(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if m.Version() == "" {
+		t.Fatal("expected content hash to be computed")
+	}
+}
+
+func TestContentHashChanges(t *testing.T) {
+	// Content hash should change when words change.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	before, err := ContentHash(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	query := `INSERT INTO word (word, frequency_class) VALUES ('foo', 0)`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	after, err := ContentHash(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if before == after {
+		t.Fatal("expected content hash to change")
+	}
+}
+
+func TestRecordVersion(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	previous, err := RecordVersion(db, "v1")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if previous != "" {
+		t.Fatal("expected no previous version:", previous)
+	}
+
+	previous, err = RecordVersion(db, "v2")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if previous != "v1" {
+		t.Fatal("expected previous version to be v1:", previous)
+	}
+
+	last, err := LastVersion(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if last != "v2" {
+		t.Fatal("expected last version to be v2:", last)
+	}
+}
+
+func TestOrphanedItems(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	queries := []string{
+		`INSERT INTO word (word, frequency_class) VALUES ('foo', 0)`,
+		`INSERT INTO review (item, interval) VALUES ('foo', 0), ('bar', 0)`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	items, err := OrphanedItems(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(items) != 1 || items[0] != "bar" {
+		t.Fatal("expected bar to be the only orphaned item:", items)
+	}
+}
+
+func TestRecordOrphans(t *testing.T) {
+	// Recording orphans should replace the old ones.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	if err := RecordOrphans(db, "v1", []string{"foo", "bar"}); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := RecordOrphans(db, "v2", []string{"baz"}); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	items, err := RecordedOrphans(db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(items) != 1 || items[0] != "baz" {
+		t.Fatal("expected only orphans from the latest version:", items)
+	}
+}
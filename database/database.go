@@ -65,8 +65,34 @@ func detach(con *sql.Conn, name string) error {
 type Querier interface {
 	*sql.DB | *sql.Tx | *Connection
 
-	Begin() (*sql.Tx, error)
 	Exec(query string, args ...any) (sql.Result, error)
 	Query(query string, args ...any) (*sql.Rows, error)
 	QueryRow(query string, args ...any) *sql.Row
 }
+
+// Runs f in a transaction.
+// If q is already a transaction, f runs in it, and committing is left to the
+// caller, so that larger changes can be made atomically.
+func InTransaction[T Querier](q T, f func(tx *sql.Tx) error) error {
+	var tx *sql.Tx
+	switch q := any(q).(type) {
+	case *sql.Tx:
+		return f(q)
+	case *sql.DB:
+		var err error
+		if tx, err = q.Begin(); err != nil {
+			return err
+		}
+	case *Connection:
+		var err error
+		if tx, err = q.Begin(); err != nil {
+			return err
+		}
+	}
+	defer tx.Rollback()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
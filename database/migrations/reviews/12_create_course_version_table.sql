@@ -0,0 +1,15 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- Version of the course that the review DB was last used with.
+-- See `course_version` package.
+CREATE TABLE course_version (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	version TEXT NOT NULL,
+	updated INTEGER NOT NULL DEFAULT (unixepoch('now'))
+);
+
+-- +goose Down
+DROP TABLE course_version;
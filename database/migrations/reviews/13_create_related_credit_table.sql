@@ -0,0 +1,15 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- Partial credit given to review items when a related form (same lemma) gets
+-- answered correctly.
+-- Items aren't scheduled for review until the credit expires.
+CREATE TABLE related_credit (
+	item TEXT PRIMARY KEY,
+	until INTEGER NOT NULL	-- UNIX timestamp
+);
+
+-- +goose Down
+DROP TABLE related_credit;
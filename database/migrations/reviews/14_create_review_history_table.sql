@@ -0,0 +1,22 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- Every answer, unlike `review`, which only has the latest one.
+CREATE TABLE review_history (
+	id INTEGER PRIMARY KEY,
+	item TEXT NOT NULL,
+	reviewed INTEGER NOT NULL,	-- UNIX timestamp
+	correct BOOLEAN NOT NULL,
+	latency INTEGER,	-- Milliseconds, NULL if unknown
+	hints INTEGER NOT NULL DEFAULT 0,
+	digraphs INTEGER NOT NULL DEFAULT 0,
+	hard BOOLEAN NOT NULL DEFAULT FALSE,	-- Correct, but the interval wasn't increased
+	interval INTEGER NOT NULL	-- Next interval in hours
+);
+
+CREATE INDEX index_review_history_item ON review_history (item);
+
+-- +goose Down
+DROP TABLE review_history;
@@ -0,0 +1,16 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- 0 (again), 1 (hard), 2 (good) or 3 (easy).
+ALTER TABLE review_history ADD COLUMN grade INTEGER NOT NULL DEFAULT 2;
+
+UPDATE review_history SET grade = CASE
+	WHEN NOT correct THEN 0
+	WHEN hard THEN 1
+	ELSE 2
+END;
+
+-- +goose Down
+ALTER TABLE review_history DROP COLUMN grade;
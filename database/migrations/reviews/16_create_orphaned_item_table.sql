@@ -0,0 +1,16 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- Review items that stopped matching words in the course after the course
+-- was updated.
+-- See `course_version` package.
+CREATE TABLE orphaned_item (
+	item TEXT PRIMARY KEY,
+	version TEXT NOT NULL,	-- Course version where the item went missing
+	detected INTEGER NOT NULL DEFAULT (unixepoch('now'))
+);
+
+-- +goose Down
+DROP TABLE orphaned_item;
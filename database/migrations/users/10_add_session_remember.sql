@@ -0,0 +1,10 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+-- "Remember me" sessions last longer.
+ALTER TABLE user_session ADD COLUMN remember INTEGER NOT NULL DEFAULT 0
+	CHECK(remember IN (0, 1));
+
+-- +goose Down
+ALTER TABLE user_session DROP COLUMN remember;
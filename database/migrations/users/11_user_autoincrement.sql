@@ -0,0 +1,45 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- Don't reuse IDs of deleted users, because new users would inherit the old
+-- user's files if they couldn't be deleted.
+-- 12 step schema change (see https://sqlite.org/lang_altertable.html#making_other_kinds_of_table_schema_changes):
+
+CREATE TABLE new_user (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL CHECK(username != ''),
+
+	-- Salted and hashed using bcrypt.
+	password TEXT NOT NULL CHECK(password != ''),
+
+	role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('user', 'admin')),
+
+	-- Disabled users can't sign in.
+	disabled INTEGER NOT NULL DEFAULT 0 CHECK(disabled IN (0, 1))
+);
+
+INSERT INTO new_user (id, username, password, role, disabled)
+SELECT id, username, password, role, disabled FROM user;
+
+DROP TABLE user;
+
+ALTER TABLE new_user RENAME TO user;
+
+-- +goose Down
+
+CREATE TABLE old_user (
+	id INTEGER PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL CHECK(username != ''),
+	password TEXT NOT NULL CHECK(password != ''),
+	role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('user', 'admin')),
+	disabled INTEGER NOT NULL DEFAULT 0 CHECK(disabled IN (0, 1))
+);
+
+INSERT INTO old_user (id, username, password, role, disabled)
+SELECT id, username, password, role, disabled FROM user;
+
+DROP TABLE user;
+
+ALTER TABLE old_user RENAME TO user;
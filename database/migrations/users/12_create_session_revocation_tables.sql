@@ -0,0 +1,24 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+
+-- Ended sessions of stores that don't keep track of sessions (i.e. cookie
+-- sessions), so that old cookies can't be used after the server restarts.
+-- See `sessions.CookieStore`.
+CREATE TABLE session_revocation (
+	session_id TEXT PRIMARY KEY,
+	revoked INTEGER NOT NULL	-- UNIX timestamp in nanoseconds
+);
+
+-- Sessions of the user that were saved before the cutoff are ended, except
+-- for `except_session`.
+CREATE TABLE session_cutoff (
+	user_id INTEGER PRIMARY KEY,
+	cutoff INTEGER NOT NULL,	-- UNIX timestamp in nanoseconds
+	except_session TEXT NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+DROP TABLE session_cutoff;
+DROP TABLE session_revocation;
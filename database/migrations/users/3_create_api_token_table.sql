@@ -0,0 +1,22 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+CREATE TABLE api_token (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES user,
+	name TEXT NOT NULL,
+
+	-- SHA-256 hash of the token (hex).
+	-- Tokens have enough entropy that they don't need to be salted.
+	hash TEXT UNIQUE NOT NULL CHECK(hash != ''),
+
+	scope TEXT NOT NULL CHECK(scope IN ('read-only', 'review')),
+	created INTEGER NOT NULL DEFAULT (unixepoch('now')),
+	last_used INTEGER	-- null if the token hasn't been used yet
+);
+
+CREATE INDEX index_api_token_user_id ON api_token (user_id);
+
+-- +goose Down
+DROP TABLE api_token;
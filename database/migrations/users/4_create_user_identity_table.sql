@@ -0,0 +1,17 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+-- External (OIDC) identities linked to local users.
+CREATE TABLE user_identity (
+	issuer TEXT NOT NULL CHECK(issuer != ''),
+	subject TEXT NOT NULL CHECK(subject != ''),
+	user_id INTEGER NOT NULL REFERENCES user,
+	created INTEGER NOT NULL DEFAULT (unixepoch('now')),
+	PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX index_user_identity_user_id ON user_identity (user_id);
+
+-- +goose Down
+DROP TABLE user_identity;
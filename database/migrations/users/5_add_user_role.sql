@@ -0,0 +1,14 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+ALTER TABLE user ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+	CHECK(role IN ('user', 'admin'));
+
+-- Disabled users can't sign in.
+ALTER TABLE user ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0
+	CHECK(disabled IN (0, 1));
+
+-- +goose Down
+ALTER TABLE user DROP COLUMN disabled;
+ALTER TABLE user DROP COLUMN role;
@@ -0,0 +1,14 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+-- Failed password attempts, for rate limiting.
+CREATE TABLE login_attempt (
+	key TEXT PRIMARY KEY,	-- "ip:{address}" or "user:{username}"
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure INTEGER NOT NULL,
+	blocked_until INTEGER NOT NULL DEFAULT 0
+);
+
+-- +goose Down
+DROP TABLE login_attempt;
@@ -0,0 +1,24 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+CREATE TABLE user_totp (
+	user_id INTEGER PRIMARY KEY REFERENCES user,
+	secret TEXT NOT NULL CHECK(secret != ''),	-- base32
+
+	-- 0 until the user confirms enrollment with a valid code.
+	enabled INTEGER NOT NULL DEFAULT 0 CHECK(enabled IN (0, 1)),
+
+	-- Last time step that was used, so codes can't be reused.
+	last_step INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_code (
+	user_id INTEGER NOT NULL REFERENCES user,
+	hash TEXT NOT NULL,	-- SHA-256 (hex)
+	PRIMARY KEY (user_id, hash)
+);
+
+-- +goose Down
+DROP TABLE recovery_code;
+DROP TABLE user_totp;
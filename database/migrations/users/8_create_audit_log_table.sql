@@ -0,0 +1,21 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+-- Security-related events, e.g. sign-ins and password changes.
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY,
+	time INTEGER NOT NULL DEFAULT (unixepoch('now')),
+	event TEXT NOT NULL,
+	user_id INTEGER,	-- NULL if the user is unknown
+	username TEXT NOT NULL DEFAULT '',	-- As entered, e.g. in failed sign-ins
+	ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX index_audit_log_user_id ON audit_log (user_id);
+
+-- +goose Down
+DROP INDEX index_audit_log_user_id;
+DROP TABLE audit_log;
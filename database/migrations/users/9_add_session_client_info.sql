@@ -0,0 +1,14 @@
+-- Copyright (c) 2022 Levi Gruspe
+-- License: MIT, or AGPLv3 or later
+
+-- +goose Up
+-- Client info, so users can tell their sessions apart.
+ALTER TABLE user_session ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_session ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_session ADD COLUMN last_seen INTEGER NOT NULL DEFAULT 0;
+UPDATE user_session SET last_seen = updated;
+
+-- +goose Down
+ALTER TABLE user_session DROP COLUMN last_seen;
+ALTER TABLE user_session DROP COLUMN ip;
+ALTER TABLE user_session DROP COLUMN user_agent;
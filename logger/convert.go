@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Writes events in the current log format.
+// course is recorded in events that don't have one.
+func Convert(w io.Writer, events []LogEvent, course string) error {
+	for _, event := range events {
+		if event.Course == "" {
+			event.Course = course
+		}
+		line, err := event.JSONLine()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrites log file in the current log format.
+// Comments and blank lines are dropped.
+// The file gets replaced all at once, so it's never left half-converted.
+// Returns the number of events in the log.
+//
+// NOTE Reviews logged while the file is being converted get lost, so don't
+// convert logs of a running server.
+func ConvertFile(path, course string) (int, error) {
+	events, err := ParseFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Convert(&buf, events, course); err != nil {
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to convert log: %v", err)
+	}
+	return len(events), nil
+}
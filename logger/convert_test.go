@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "eng-spa.log")
+	log := `/ 2022-01-01 00:00:00 foo
+# comment
+x 2022-01-02 00:00:00 bar
+`
+	if err := os.WriteFile(path, []byte(log), 0o600); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	n, err := ConvertFile(path, "eng-spa")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if n != 2 {
+		t.Fatal("expected two events:", n)
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"v":1,`) {
+		t.Fatal("expected JSONL log:", string(bytes))
+	}
+
+	events, err := ParseFile(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if events[0].Word != "foo" || events[1].Word != "bar" || events[1].Course != "eng-spa" {
+		t.Fatal("expected converted log to have the same events:", events)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatal("expected file mode to be preserved:", info.Mode())
+	}
+
+	// Converting again shouldn't change anything.
+	if _, err := ConvertFile(path, "eng-spa"); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	again, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if string(again) != string(bytes) {
+		t.Fatal("expected conversion to be idempotent")
+	}
+}
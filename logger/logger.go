@@ -4,33 +4,32 @@
 package logger
 
 import (
-	"fmt"
-	"log"
 	"os"
 	"time"
 )
 
+// Layout of timestamps in legacy logs.
 const layout string = "2006-01-02 15:04:05"
 
-func timestamp() string {
-	return time.Now().UTC().Format(layout)
-}
-
-func prefix(correct bool) string {
-	result := "x"
-	if correct {
-		result = "/"
+// Appends review to log file.
+// Sets the timestamp to the current time if it's zero.
+func LogReview(file string, event LogEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	line, err := event.JSONLine()
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("%v %v ", result, timestamp())
-}
 
-func LogReview(file string, correct bool, word string) error {
 	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	logger := log.New(f, prefix(correct), 0)
-	logger.Println(word)
-	return nil
+	// Write the whole line at once, so that concurrent reviews don't get
+	// interleaved.
+	_, err = f.Write(append(line, '\n'))
+	return err
 }
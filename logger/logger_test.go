@@ -0,0 +1,32 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package logger
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLogReview(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "eng-spa.log")
+	for _, word := range []string{"foo", "bar"} {
+		event := LogEvent{Correct: true, Word: word, Course: "eng-spa", SentenceID: 1}
+		if err := LogReview(path, event); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	events, err := ParseFile(path)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(events) != 2 || events[1].Word != "bar" || events[1].SentenceID != 1 {
+		t.Fatal("expected logged reviews:", events)
+	}
+	if events[0].Timestamp.IsZero() {
+		t.Fatal("expected timestamp to be set")
+	}
+}
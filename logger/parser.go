@@ -5,6 +5,7 @@
 package logger
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -14,12 +15,46 @@ import (
 
 var ErrParseError = errors.New("parse error")
 
+// Version of the log format.
+// Version 1 logs have one JSON object per line.
+// Legacy logs (version 0) have lines like "/ 2006-01-02 15:04:05 word".
+const Version = 1
+
 type LogEvent struct {
 	Correct   bool
-	Timestamp time.Time
+	Timestamp time.Time // Server time
 	Word      string
+
+	// Not in legacy logs.
+	Course          string // "{l1}-{l2}"
+	SentenceID      int
+	ItemType        string // e.g. "cloze"
+	Answer          string // What the student typed
+	Grade           string // "again", "hard", "good" or "easy"; empty if unknown
+	Latency         time.Duration
+	Hints           int
+	Digraphs        int
+	ClientTimestamp time.Time
+}
+
+// Log event in version 1 logs.
+type jsonEvent struct {
+	Version         int        `json:"v"`
+	Timestamp       time.Time  `json:"time"`
+	Course          string     `json:"course,omitempty"`
+	Word            string     `json:"word"`
+	Correct         bool       `json:"correct"`
+	Grade           string     `json:"grade,omitempty"`
+	SentenceID      int        `json:"sentenceID,omitempty"`
+	ItemType        string     `json:"itemType,omitempty"`
+	Answer          string     `json:"answer,omitempty"`
+	Latency         int64      `json:"latencyMs,omitempty"`
+	Hints           int        `json:"hints,omitempty"`
+	Digraphs        int        `json:"digraphs,omitempty"`
+	ClientTimestamp *time.Time `json:"clientTime,omitempty"`
 }
 
+// Formats event like in legacy logs.
 func (e LogEvent) String() string {
 	correct := "x"
 	if e.Correct {
@@ -31,9 +66,69 @@ func (e LogEvent) String() string {
 	return fmt.Sprintf("%v %v %v", correct, timestamp, e.Word)
 }
 
-func ParseLine(line string) (LogEvent, error) {
+// Encodes event as a line in the current log format (without newline).
+func (e LogEvent) JSONLine() ([]byte, error) {
+	v := jsonEvent{
+		Version:    Version,
+		Timestamp:  e.Timestamp.UTC(),
+		Course:     e.Course,
+		Word:       e.Word,
+		Correct:    e.Correct,
+		Grade:      e.Grade,
+		SentenceID: e.SentenceID,
+		ItemType:   e.ItemType,
+		Answer:     e.Answer,
+		Latency:    e.Latency.Milliseconds(),
+		Hints:      e.Hints,
+		Digraphs:   e.Digraphs,
+	}
+	if !e.ClientTimestamp.IsZero() {
+		clientTimestamp := e.ClientTimestamp.UTC()
+		v.ClientTimestamp = &clientTimestamp
+	}
+	return json.Marshal(v)
+}
+
+func parseJSONLine(line string) (LogEvent, error) {
+	var event LogEvent
+	var v jsonEvent
+	if err := json.Unmarshal([]byte(line), &v); err != nil {
+		return event, fmt.Errorf("%w: %v", ErrParseError, err)
+	}
+	if v.Version < 1 || v.Version > Version {
+		return event, fmt.Errorf("%w: unsupported log version: %v", ErrParseError, v.Version)
+	}
+	if v.Word == "" || v.Timestamp.IsZero() {
+		return event, fmt.Errorf("%w: missing word or time", ErrParseError)
+	}
+
+	event = LogEvent{
+		Correct:    v.Correct,
+		Timestamp:  v.Timestamp,
+		Word:       v.Word,
+		Course:     v.Course,
+		SentenceID: v.SentenceID,
+		ItemType:   v.ItemType,
+		Answer:     v.Answer,
+		Grade:      v.Grade,
+		Latency:    time.Duration(v.Latency) * time.Millisecond,
+		Hints:      v.Hints,
+		Digraphs:   v.Digraphs,
+	}
+	if v.ClientTimestamp != nil {
+		event.ClientTimestamp = *v.ClientTimestamp
+	}
+	return event, nil
+}
+
+func parseLegacyLine(line string) (LogEvent, error) {
 	var event LogEvent
 
+	// Correctness, timestamp and word are separated by spaces.
+	if len(line) < len("/ ")+len(layout)+len(" w") {
+		return event, ErrParseError
+	}
+
 	switch line[:2] {
 	case "x ":
 		event.Correct = false
@@ -52,15 +147,29 @@ func ParseLine(line string) (LogEvent, error) {
 	event.Timestamp = timestamp
 	line = line[len(layout):]
 
+	if line[0] != ' ' {
+		return event, ErrParseError
+	}
 	event.Word = line[1:]
 	return event, nil
 }
 
+// Parses line in either the current or the legacy log format.
+func ParseLine(line string) (LogEvent, error) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line)
+	}
+	return parseLegacyLine(line)
+}
+
+// Parses log.
+// Logs can mix lines in different formats, e.g. legacy logs that new reviews
+// got appended to.
 func Parse(s string) ([]LogEvent, error) {
 	var events []LogEvent
 
 	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n"), "\n")
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
 
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -69,7 +178,7 @@ func Parse(s string) ([]LogEvent, error) {
 
 		event, err := ParseLine(line)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
 		}
 		events = append(events, event)
 	}
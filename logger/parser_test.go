@@ -4,6 +4,7 @@
 package logger
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -135,3 +136,85 @@ func TestString(t *testing.T) {
 		)
 	}
 }
+
+func TestParseLineShort(t *testing.T) {
+	// Malformed lines should be errors, not panics.
+	t.Parallel()
+
+	lines := []string{
+		"/",
+		"x",
+		"/ ",
+		"/ 2020-01-01",
+		"/ 2020-01-01 00:00:00",
+		"/ 2020-01-01 00:00:00x",
+		"{",
+		`{"v":1}`,
+	}
+	for _, line := range lines {
+		if _, err := ParseLine(line); err == nil {
+			t.Fatal("expected error:", line)
+		}
+	}
+}
+
+func TestJSONLine(t *testing.T) {
+	t.Parallel()
+
+	event := LogEvent{
+		Correct:         true,
+		Timestamp:       time.Date(2022, 10, 1, 2, 3, 4, 567000000, time.UTC),
+		Word:            "hola",
+		Course:          "eng-spa",
+		SentenceID:      42,
+		ItemType:        "cloze",
+		Answer:          "Hola",
+		Grade:           "easy",
+		Latency:         1500 * time.Millisecond,
+		Hints:           1,
+		Digraphs:        2,
+		ClientTimestamp: time.Date(2022, 10, 1, 2, 3, 3, 0, time.UTC),
+	}
+	line, err := event.JSONLine()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	parsed, err := ParseLine(string(line))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if parsed != event {
+		t.Fatal("expected JSONLine and ParseLine to be inverse functions:", event, parsed)
+	}
+}
+
+func TestParseLineUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseLine(`{"v":99,"time":"2022-01-01T00:00:00Z","word":"foo","correct":true}`)
+	if !errors.Is(err, ErrParseError) {
+		t.Fatal("expected ErrParseError:", err)
+	}
+}
+
+func TestParseMixedFormats(t *testing.T) {
+	t.Parallel()
+
+	log := `/ 2022-01-01 00:00:00 foo
+{"v":1,"time":"2022-01-02T00:00:00.5Z","course":"eng-spa","word":"bar","correct":false,"latencyMs":2000}
+`
+	events, err := Parse(log)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("expected events to contain two elements:", events)
+	}
+	if events[0].Word != "foo" || !events[0].Correct || events[0].Course != "" {
+		t.Fatal("unexpected legacy event:", events[0])
+	}
+	if events[1].Word != "bar" || events[1].Correct || events[1].Latency != 2*time.Second {
+		t.Fatal("unexpected event:", events[1])
+	}
+}
@@ -4,21 +4,32 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/lggruspe/polycloze/api"
+	"github.com/lggruspe/polycloze/auth"
 	"github.com/lggruspe/polycloze/basedir"
 	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/oidc"
+	"github.com/lggruspe/polycloze/sessions"
 )
 
+// How often expired sessions get deleted.
+const sweepInterval = 10 * time.Minute
+
 type Args struct {
-	cors bool
-	port int
+	cors  bool
+	port  int
+	admin string
 }
 
 func defaultPortNumber() int {
@@ -32,20 +43,148 @@ func defaultPortNumber() int {
 	return 3000
 }
 
+// Gets OIDC config from environment variables.
+// Returns nil if POLYCLOZE_OIDC_ISSUER isn't set.
+func oidcConfig() *oidc.Config {
+	issuer := os.Getenv("POLYCLOZE_OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	return &oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("POLYCLOZE_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("POLYCLOZE_OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("POLYCLOZE_OIDC_REDIRECT_URL"),
+	}
+}
+
+// Gets session timeouts from environment variables (e.g. "2h").
+// Unset variables keep their default values.
+func sessionTimeouts() (*sessions.Timeouts, error) {
+	timeouts := sessions.DefaultTimeouts
+	vars := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"POLYCLOZE_SESSION_IDLE_TIMEOUT", &timeouts.Idle},
+		{"POLYCLOZE_SESSION_ABSOLUTE_TIMEOUT", &timeouts.Absolute},
+		{"POLYCLOZE_SESSION_REMEMBER_TIMEOUT", &timeouts.Remember},
+	}
+	for _, v := range vars {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %v", v.name, err)
+		}
+		*v.value = d
+	}
+	return &timeouts, nil
+}
+
+// Gets the time to answer after which correct answers count as hard from
+// POLYCLOZE_SLOW_ANSWER (e.g. "20s"). Returns 0 (disabled) if unset.
+func slowAnswer() (time.Duration, error) {
+	value := os.Getenv("POLYCLOZE_SLOW_ANSWER")
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid POLYCLOZE_SLOW_ANSWER: %v", err)
+	}
+	return d, nil
+}
+
+// Creates session store chosen by POLYCLOZE_SESSION_STORE: "sqlite"
+// (default), "memory" or "cookie".
+// db: users DB
+func sessionStore(db *sql.DB) (sessions.Store, error) {
+	switch kind := os.Getenv("POLYCLOZE_SESSION_STORE"); kind {
+	case "", "sqlite":
+		return sessions.NewSQLiteStore(db), nil
+	case "memory":
+		return sessions.NewMemoryStore(sessions.DefaultMemoryStoreCapacity), nil
+	case "cookie":
+		return cookieStore(db)
+	default:
+		return nil, fmt.Errorf("unknown session store: %v", kind)
+	}
+}
+
+// Creates cookie session store with the base64-encoded key in
+// POLYCLOZE_SESSION_KEY.
+// Uses a random key if it's not set, so sessions end when the server restarts.
+// db: users DB, for keeping track of ended sessions
+func cookieStore(db *sql.DB) (sessions.Store, error) {
+	encoded := os.Getenv("POLYCLOZE_SESSION_KEY")
+	if encoded == "" {
+		log.Println("POLYCLOZE_SESSION_KEY not set, sessions won't survive restarts")
+		key, err := sessions.GenerateCookieKey()
+		if err != nil {
+			return nil, err
+		}
+		return sessions.NewCookieStore(key, db)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POLYCLOZE_SESSION_KEY: %v", err)
+	}
+	return sessions.NewCookieStore(key, db)
+}
+
+// Decodes base64-encoded key for signing CSRF tokens in POLYCLOZE_CSRF_KEY.
+// Returns nil if it's not set, so a random key gets used.
+func csrfKey() ([]byte, error) {
+	encoded := os.Getenv("POLYCLOZE_CSRF_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POLYCLOZE_CSRF_KEY: %v", err)
+	}
+	return key, nil
+}
+
 func parseArgs() Args {
 	var args Args
 
 	flag.BoolVar(&args.cors, "c", false, "allow CORS")
 	flag.IntVar(&args.port, "p", defaultPortNumber(), "port number")
+	flag.StringVar(&args.admin, "admin", "", "grant admin role to user and exit")
 	flag.Parse()
 	return args
 }
 
 func main() {
-	api.Startup()
-
 	args := parseArgs()
-	config := api.Config{AllowCORS: args.cors, Port: args.port}
+	timeouts, err := sessionTimeouts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, err := csrfKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	slow, err := slowAnswer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := api.Config{
+		AllowCORS: args.cors,
+		Port:      args.port,
+		OIDC:      oidcConfig(),
+
+		ClientIPHeader:    os.Getenv("POLYCLOZE_CLIENT_IP_HEADER"),
+		BreachedPasswords: os.Getenv("POLYCLOZE_BREACHED_PASSWORDS"),
+		SessionTimeouts:   timeouts,
+		CSRFKey:           key,
+		SlowAnswer:        slow,
+	}
 
 	db, err := database.OpenUsersDB(basedir.Users())
 	if err != nil {
@@ -53,10 +192,27 @@ func main() {
 	}
 	defer db.Close()
 
+	if args.admin != "" {
+		if err := auth.SetRole(db, args.admin, auth.RoleAdmin); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Granted admin role to %v\n", args.admin)
+		return
+	}
+
+	store, err := sessionStore(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.SessionStore = store
+
+	api.Startup()
 	r, err := api.Router(config, db)
 	if err != nil {
 		log.Fatal(err)
 	}
+	go sessions.Sweep(context.Background(), store, sweepInterval)
+
 	log.Printf("Listening on port %v\n", args.port)
 	log.Printf("Start learning: http://127.0.0.1:%v\n", args.port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", args.port), r))
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Issuer signing keys.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Minimum time between JWKS refreshes, so that tokens with unknown key IDs
+// can't make us spam the issuer.
+const minRefreshInterval = time.Minute
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// Cached JSON web key set.
+// Gets refreshed when a token is signed with an unknown key, to handle key
+// rotation.
+type keySet struct {
+	client *http.Client
+	url    string
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	refreshed time.Time
+}
+
+func newKeySet(client *http.Client, url string) *keySet {
+	return &keySet{client: client, url: url}
+}
+
+func (k *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(k.refreshed) < minRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key: %v", kid)
+	}
+	if err := k.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key: %v", kid)
+}
+
+// NOTE Caller should hold the lock.
+func (k *keySet) refresh(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, k.client, k.url, &set); err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		pub, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[key.KeyID] = pub
+	}
+	k.keys = keys
+	k.refreshed = time.Now()
+	return nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+	switch key.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if key.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %v", key.Curve)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %v", key.KeyType)
+	}
+}
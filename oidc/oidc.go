@@ -0,0 +1,172 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// OpenID Connect sign-in (authorization code flow with PKCE).
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OIDC client configuration.
+type Config struct {
+	Issuer       string // e.g. https://accounts.example.com
+	ClientID     string
+	ClientSecret string // Optional for public clients.
+	RedirectURL  string // e.g. https://polycloze.example.com/oidc/callback
+}
+
+// Parts of the discovery document that we use.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDC provider.
+type Provider struct {
+	config    Config
+	discovery discovery
+	client    *http.Client
+	keys      *keySet
+}
+
+// Fetches provider configuration from the issuer's discovery endpoint.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	var d discovery
+	if err := getJSON(ctx, client, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	if d.Issuer != config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer mismatch: %v", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery failed: incomplete provider configuration")
+	}
+
+	p := Provider{
+		config:    config,
+		discovery: d,
+		client:    client,
+		keys:      newKeySet(client, d.JWKSURI),
+	}
+	return &p, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Generates random URL-safe string with 256 bits of entropy.
+func RandomString() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// Computes S256 PKCE code challenge of verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Returns URL of the provider's consent page.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", "openid profile email")
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", CodeChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchanges authorization code for an ID token.
+// Returns the raw (unverified) ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("code_verifier", verifier)
+	if p.config.ClientSecret == "" {
+		v.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.discovery.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("token exchange failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("token exchange failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange failed: %v: %s", resp.Status, body)
+	}
+
+	var result struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("token exchange failed: %v", err)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("token exchange failed: missing ID token")
+	}
+	return result.IDToken, nil
+}
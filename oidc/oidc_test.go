@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lggruspe/polycloze/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost/oidc/callback"
+
+func testProvider(t *testing.T, issuer *oidctest.Issuer) *Provider {
+	p, err := Discover(context.TODO(), Config{
+		Issuer:      issuer.URL(),
+		ClientID:    issuer.ClientID,
+		RedirectURL: redirectURL,
+	})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return p
+}
+
+// Follows authorization URL and returns code from the redirect.
+func authorize(t *testing.T, p *Provider, state, nonce, verifier string) string {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(p.AuthCodeURL(state, nonce, verifier))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatal("expected redirect to client:", location)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatal("expected state to be preserved:", location)
+	}
+	return location.Query().Get("code")
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	t.Parallel()
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+
+	_, err := Discover(context.TODO(), Config{
+		Issuer:   issuer.URL() + "/other",
+		ClientID: "client",
+	})
+	if err == nil {
+		t.Fatal("expected err to be non-nil for wrong issuer")
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	t.Parallel()
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+	issuer.SetSubject("alice", map[string]any{"preferred_username": "alice"})
+
+	p := testProvider(t, issuer)
+	code := authorize(t, p, "state", "nonce", "verifier")
+
+	raw, err := p.Exchange(context.TODO(), code, "verifier")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	claims, err := p.Verify(context.TODO(), raw, "nonce")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if claims.Subject != "alice" || claims.PreferredUsername != "alice" {
+		t.Fatal("unexpected claims:", claims)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	// PKCE should prevent stolen codes from being used.
+	t.Parallel()
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+
+	p := testProvider(t, issuer)
+	code := authorize(t, p, "state", "nonce", "verifier")
+	if _, err := p.Exchange(context.TODO(), code, "wrong"); err == nil {
+		t.Fatal("expected err to be non-nil for wrong code verifier")
+	}
+}
+
+func TestVerifyInvalidTokens(t *testing.T) {
+	t.Parallel()
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+	p := testProvider(t, issuer)
+
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":   issuer.URL(),
+			"sub":   "alice",
+			"aud":   "client",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	if _, err := p.Verify(context.TODO(), issuer.Sign(valid()), "nonce"); err != nil {
+		t.Fatal("expected valid token to pass verification:", err)
+	}
+
+	cases := map[string]func(map[string]any){
+		"wrong issuer":   func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]any) { c["aud"] = []string{"other"} },
+		"expired":        func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"wrong nonce":    func(c map[string]any) { c["nonce"] = "other" },
+		"no subject":     func(c map[string]any) { delete(c, "sub") },
+	}
+	for name, modify := range cases {
+		claims := valid()
+		modify(claims)
+		if _, err := p.Verify(context.TODO(), issuer.Sign(claims), "nonce"); err == nil {
+			t.Fatal("expected verification to fail:", name)
+		}
+	}
+
+	// Tamper with payload.
+	raw := issuer.Sign(valid())
+	parts := strings.Split(raw, ".")
+	tampered := issuer.Sign(map[string]any{"sub": "mallory"})
+	parts[1] = strings.Split(tampered, ".")[1]
+	if _, err := p.Verify(context.TODO(), strings.Join(parts, "."), "nonce"); err == nil {
+		t.Fatal("expected verification to fail for tampered token")
+	}
+
+	// Unsigned tokens.
+	parts[0] = "eyJhbGciOiJub25lIn0" // {"alg":"none"}
+	parts[2] = ""
+	if _, err := p.Verify(context.TODO(), strings.Join(parts, "."), "nonce"); err == nil {
+		t.Fatal("expected verification to fail for unsigned token")
+	}
+}
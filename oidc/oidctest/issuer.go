@@ -0,0 +1,215 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Local mock OIDC issuer for tests.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "test-key"
+
+// Mock issuer.
+// The authorization endpoint immediately redirects back to the client with a
+// code for the next subject, without showing a consent page.
+type Issuer struct {
+	Server   *httptest.Server
+	ClientID string
+
+	key *rsa.PrivateKey
+
+	mu      sync.Mutex
+	subject string
+	claims  map[string]any
+	codes   map[string]grant
+}
+
+// Pending authorization code.
+type grant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	subject     string
+	claims      map[string]any
+}
+
+// Starts mock issuer.
+// Caller should call Close after use.
+func NewIssuer(clientID string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	issuer := &Issuer{
+		ClientID: clientID,
+		key:      key,
+		subject:  "subject",
+		codes:    make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.handleDiscovery)
+	mux.HandleFunc("/jwks", issuer.handleJWKS)
+	mux.HandleFunc("/authorize", issuer.handleAuthorize)
+	mux.HandleFunc("/token", issuer.handleToken)
+	issuer.Server = httptest.NewServer(mux)
+	return issuer
+}
+
+func (i *Issuer) Close() {
+	i.Server.Close()
+}
+
+func (i *Issuer) URL() string {
+	return i.Server.URL
+}
+
+// Sets subject and extra claims of the next ID tokens.
+func (i *Issuer) SetSubject(subject string, claims map[string]any) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.subject = subject
+	i.claims = claims
+}
+
+func sendJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (i *Issuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, map[string]string{
+		"issuer":                 i.URL(),
+		"authorization_endpoint": i.URL() + "/authorize",
+		"token_endpoint":         i.URL() + "/token",
+		"jwks_uri":               i.URL() + "/jwks",
+	})
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (i *Issuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := i.key.PublicKey
+	sendJSON(w, map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": keyID,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   encode(pub.N.Bytes()),
+				"e":   encode(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	})
+}
+
+func (i *Issuer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != i.ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	i.mu.Lock()
+	i.codes[code] = grant{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+		subject:     i.subject,
+		claims:      i.claims,
+	}
+	i.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+	v := redirect.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	redirect.RawQuery = v.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || encode(sum[:]) != g.challenge || r.PostForm.Get("redirect_uri") != g.redirectURI {
+		w.WriteHeader(http.StatusBadRequest)
+		sendJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   i.URL(),
+		"sub":   g.subject,
+		"aud":   i.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	sendJSON(w, map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     i.Sign(claims),
+	})
+}
+
+// Signs claims as an RS256 JWT.
+func (i *Issuer) Sign(claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	if err != nil {
+		panic(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + encode(signature)
+}
+
+func randomString() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return encode(bytes)
+}
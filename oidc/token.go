@@ -0,0 +1,159 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// ID token verification.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Allowed clock difference between us and the issuer.
+const clockSkew = time.Minute
+
+// ID token claims that we use.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+}
+
+// "aud" claim can be a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verifies ID token signature and claims.
+// nonce should be the value that was sent in the authorization request.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (Claims, error) {
+	return p.verifyAt(ctx, raw, nonce, time.Now())
+}
+
+func (p *Provider) verifyAt(ctx context.Context, raw, nonce string, now time.Time) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("invalid ID token: malformed JWT")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	key, err := p.keys.get(ctx, h.KeyID)
+	if err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if err := verifySignature(h.Algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if claims.Issuer != p.config.Issuer {
+		return claims, fmt.Errorf("invalid ID token: unexpected issuer: %v", claims.Issuer)
+	}
+	if !claims.Audience.contains(p.config.ClientID) {
+		return claims, errors.New("invalid ID token: unexpected audience")
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("invalid ID token: missing subject")
+	}
+	if now.Add(-clockSkew).Unix() >= claims.Expiry {
+		return claims, errors.New("invalid ID token: expired")
+	}
+	if claims.IssuedAt > now.Add(clockSkew).Unix() {
+		return claims, errors.New("invalid ID token: issued in the future")
+	}
+	if claims.Nonce != nonce {
+		return claims, errors.New("invalid ID token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, v)
+}
+
+// Only asymmetric algorithms are allowed, so a client secret can't be used to
+// forge tokens.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type doesn't match algorithm")
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature)
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("key type doesn't match algorithm")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signing algorithm: %v", alg)
+	}
+}
@@ -0,0 +1,45 @@
+"""Course metadata."""
+
+from datetime import date
+from hashlib import sha256
+from sqlite3 import Connection
+
+
+# Increment this when the course builder changes in a way that affects the
+# contents of course files.
+BUILDER_VERSION = "1"
+
+LICENSE = (
+    "Sentences and translations from Tatoeba (https://tatoeba.org), "
+    "CC BY 2.0 FR (https://creativecommons.org/licenses/by/2.0/fr)"
+)
+
+
+def content_hash(con: Connection) -> str:
+    """Compute hash of words in course.
+
+    SHA-256 of newline-separated words sorted in code point order.
+    NOTE This is also computed in the `polycloze/course_version` package, so
+    any changes here should be reflected there as well.
+    """
+    query = "SELECT word FROM word ORDER BY word ASC"
+    words = [word for word, in con.execute(query)]
+    return sha256("\n".join(words).encode("utf-8")).hexdigest()
+
+
+def populate_metadata(con: Connection, dataset_date: date) -> None:
+    """Insert course metadata.
+
+    Should be called after the word table is final.
+    """
+    query = """
+        INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)
+    """
+    values = [
+        ("builder_version", BUILDER_VERSION),
+        ("dataset_date", dataset_date.isoformat()),
+        ("content_hash", content_hash(con)),
+        ("license", LICENSE),
+    ]
+    con.executemany(query, values)
+    con.commit()
@@ -0,0 +1,10 @@
+begin transaction;
+	pragma user_version = 5;
+
+	-- Course metadata (builder_version, dataset_date, content_hash, license).
+	create table if not exists metadata (
+		key text primary key,
+		value text not null
+		);
+
+	commit;
@@ -0,0 +1,11 @@
+begin transaction;
+	pragma user_version = 6;
+
+	-- Optional lemma and part-of-speech of each word (null if unknown).
+	-- Used to group inflected forms of the same word.
+	alter table word add column lemma text;
+	alter table word add column pos text;
+
+	create index if not exists index_word_lemma on word (lemma);
+
+	commit;
@@ -16,6 +16,7 @@ from .dependency import is_outdated, Task
 from .difficulty import compute_difficulty_values
 from .download import download, has_been_a_week, latest_data
 from .link import partition_links
+from .metadata import populate_metadata
 from .migrate import check_scripts, migrate
 from .partition import partition
 from .populate import populate
@@ -240,8 +241,10 @@ class CourseBuilderTask:
                     reversed_=lang1 < lang2,
                 )
 
+                dataset_date = latest_data(build/"tatoeba")[0].last_modified
                 with connect(database) as con:
                     shrink(con)
+                    populate_metadata(con, dataset_date)
                 move(database, target)
 
 
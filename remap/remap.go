@@ -0,0 +1,202 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Remaps review items to words in a rebuilt course.
+package remap
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lggruspe/polycloze/activity"
+	"github.com/lggruspe/polycloze/database"
+	"github.com/lggruspe/polycloze/text"
+	ws "github.com/lggruspe/polycloze/word_scheduler"
+)
+
+// How an orphaned item was mapped to a new word.
+type Method string
+
+const (
+	Casefold Method = "casefold"
+	Lemma    Method = "lemma"
+)
+
+type Mapping struct {
+	Item   string // Review item that doesn't match any word in the course
+	Word   string // Word in the course
+	Method Method
+}
+
+type Plan struct {
+	Mappings []Mapping
+	Unmapped []string
+}
+
+// Returns word in course that matches the query, or an empty string.
+func findWord[T database.Querier](q T, query string, args ...any) (string, error) {
+	var word string
+	err := q.QueryRow(query, args...).Scan(&word)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return word, err
+}
+
+// Finds new word for each orphaned review item.
+// Tries casefold equivalence first, then lemma equivalence (if the course has
+// lemmas).
+// q should be a connection to a review DB with the course attached.
+func MakePlan[T database.Querier](q T, orphans []string) (Plan, error) {
+	var plan Plan
+
+	lemmas, err := ws.HasLemmas(q)
+	if err != nil {
+		return plan, fmt.Errorf("failed to make remap plan: %v", err)
+	}
+
+	for _, item := range orphans {
+		folded := text.Casefold(item)
+
+		word, err := findWord(q, `SELECT word FROM word WHERE word = ?`, folded)
+		if err != nil {
+			return plan, fmt.Errorf("failed to make remap plan: %v", err)
+		}
+		if word != "" {
+			plan.Mappings = append(plan.Mappings, Mapping{Item: item, Word: word, Method: Casefold})
+			continue
+		}
+
+		if lemmas {
+			// Prefer the most common form of the lemma.
+			query := `
+				SELECT word FROM word WHERE lemma = ?
+				ORDER BY frequency_class ASC, id ASC
+				LIMIT 1
+			`
+			word, err = findWord(q, query, folded)
+			if err != nil {
+				return plan, fmt.Errorf("failed to make remap plan: %v", err)
+			}
+			if word != "" {
+				plan.Mappings = append(plan.Mappings, Mapping{Item: item, Word: word, Method: Lemma})
+				continue
+			}
+		}
+		plan.Unmapped = append(plan.Unmapped, item)
+	}
+	return plan, nil
+}
+
+type reviewRow struct {
+	learned  int64
+	reviewed int64
+	interval int64
+}
+
+// Returns nil if the item has no review.
+func getReviewRow(tx *sql.Tx, item string) (*reviewRow, error) {
+	var row reviewRow
+	query := `SELECT learned, reviewed, interval FROM review WHERE item = ?`
+	err := tx.QueryRow(query, item).Scan(&row.learned, &row.reviewed, &row.interval)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// Checks if review a should be kept over b when merging.
+// Prefers the longer interval, then the more recent review.
+func (a reviewRow) betterThan(b reviewRow) bool {
+	if a.interval != b.interval {
+		return a.interval > b.interval
+	}
+	return a.reviewed > b.reviewed
+}
+
+// Moves partial credit of item to word.
+// If word already has credit, keeps the one that expires later.
+func moveRelatedCredit(tx *sql.Tx, item, word string) error {
+	query := `
+		INSERT INTO related_credit (item, until)
+		SELECT ?, until FROM related_credit WHERE item = ?
+		ON CONFLICT (item) DO UPDATE SET until = max(until, excluded.until)
+	`
+	if _, err := tx.Exec(query, word, item); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM related_credit WHERE item = ?`, item)
+	return err
+}
+
+// Moves review of item to word.
+// If word already has a review, keeps the stronger one.
+// The review history of both gets kept under word.
+func moveReview(tx *sql.Tx, item, word string) error {
+	if _, err := tx.Exec(`UPDATE review_history SET item = ? WHERE item = ?`, word, item); err != nil {
+		return err
+	}
+	if err := moveRelatedCredit(tx, item, word); err != nil {
+		return err
+	}
+
+	old, err := getReviewRow(tx, item)
+	if err != nil || old == nil {
+		return err
+	}
+	existing, err := getReviewRow(tx, word)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		_, err := tx.Exec(`UPDATE review SET item = ? WHERE item = ?`, word, item)
+		return err
+	}
+
+	learned := old.learned
+	if existing.learned < learned {
+		learned = existing.learned
+	}
+
+	if old.betterThan(*existing) {
+		if _, err := tx.Exec(`DELETE FROM review WHERE item = ?`, word); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE review SET item = ?, learned = ? WHERE item = ?`, word, learned, item)
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM review WHERE item = ?`, item); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE review SET learned = ? WHERE item = ?`, learned, word)
+	return err
+}
+
+// Applies plan to review DB.
+// Remapping shouldn't count as learner activity, so today's activity stats
+// are restored after the review rows get moved.
+func Apply[T database.Querier](q T, plan Plan) error {
+	err := database.InTransaction(q, func(tx *sql.Tx) error {
+		return activity.Preserve(tx, func() error {
+			for _, mapping := range plan.Mappings {
+				if err := moveReview(tx, mapping.Item, mapping.Word); err != nil {
+					return fmt.Errorf("failed to remap %v to %v: %v", mapping.Item, mapping.Word, err)
+				}
+				if _, err := tx.Exec(`DELETE FROM orphaned_item WHERE item = ?`, mapping.Item); err != nil {
+					return fmt.Errorf("failed to remap %v to %v: %v", mapping.Item, mapping.Word, err)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply remap plan: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package remap
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/lggruspe/polycloze/utils"
+)
+
+func exec(t *testing.T, db *sql.DB, queries ...string) {
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+}
+
+func TestMakePlanCasefold(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(t, db, `INSERT INTO word (word, frequency_class) VALUES ('foo', 0)`)
+
+	plan, err := MakePlan(db, []string{"Foo", "bar"})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(plan.Mappings) != 1 || plan.Mappings[0].Word != "foo" || plan.Mappings[0].Method != Casefold {
+		t.Fatal("expected Foo to be mapped to foo:", plan.Mappings)
+	}
+	if len(plan.Unmapped) != 1 || plan.Unmapped[0] != "bar" {
+		t.Fatal("expected bar to be unmapped:", plan.Unmapped)
+	}
+}
+
+func TestMakePlanLemma(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(
+		t,
+		db,
+		`INSERT INTO word (word, frequency_class, lemma) VALUES ('hablo', 1, 'hablar'), ('habla', 0, 'hablar')`,
+	)
+
+	plan, err := MakePlan(db, []string{"hablar"})
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(plan.Mappings) != 1 || plan.Mappings[0].Word != "habla" || plan.Mappings[0].Method != Lemma {
+		t.Fatal("expected hablar to be mapped to most common form:", plan.Mappings)
+	}
+}
+
+func TestApplyMerge(t *testing.T) {
+	// When two items map to the same word, the stronger review should be kept.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(
+		t,
+		db,
+		`INSERT INTO review (item, learned, reviewed, interval) VALUES ('foo', 100, 100, 24), ('Foo', 50, 200, 48)`,
+	)
+
+	plan := Plan{Mappings: []Mapping{{Item: "Foo", Word: "foo", Method: Casefold}}}
+	if err := Apply(db, plan); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM review`).Scan(&count); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if count != 1 {
+		t.Fatal("expected reviews to be merged:", count)
+	}
+
+	var learned, interval int
+	query := `SELECT learned, interval FROM review WHERE item = 'foo'`
+	if err := db.QueryRow(query).Scan(&learned, &interval); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if learned != 50 || interval != 48 {
+		t.Fatal("expected merged review to keep earliest learned date and longest interval:", learned, interval)
+	}
+}
+
+func TestApplyReviewHistory(t *testing.T) {
+	// Remapped items should keep their review history.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(
+		t,
+		db,
+		`INSERT INTO review (item, learned, reviewed, interval) VALUES ('foo', 100, 100, 24), ('Foo', 50, 200, 48)`,
+		`INSERT INTO review_history (item, reviewed, correct, interval) VALUES ('foo', 100, 1, 24), ('Foo', 50, 1, 24), ('Foo', 200, 1, 48)`,
+	)
+
+	plan := Plan{Mappings: []Mapping{{Item: "Foo", Word: "foo", Method: Casefold}}}
+	if err := Apply(db, plan); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var foo, orphaned int
+	query := `SELECT count(*) FILTER (WHERE item = 'foo'), count(*) FILTER (WHERE item = 'Foo') FROM review_history`
+	if err := db.QueryRow(query).Scan(&foo, &orphaned); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if foo != 3 || orphaned != 0 {
+		t.Fatal("expected review history to be moved to the new word:", foo, orphaned)
+	}
+}
+
+func TestApplyRelatedCredit(t *testing.T) {
+	// Remapped items should keep their partial credit, and merged credit
+	// should expire at the later time.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(
+		t,
+		db,
+		`INSERT INTO review (item, interval) VALUES ('foo', 24), ('Foo', 48), ('Bar', 24)`,
+		`INSERT INTO related_credit (item, until) VALUES ('foo', 100), ('Foo', 200), ('Bar', 300)`,
+	)
+
+	plan := Plan{Mappings: []Mapping{
+		{Item: "Foo", Word: "foo", Method: Casefold},
+		{Item: "Bar", Word: "bar", Method: Casefold},
+	}}
+	if err := Apply(db, plan); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	credit := make(map[string]int)
+	rows, err := db.Query(`SELECT item, until FROM related_credit`)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item string
+		var until int
+		if err := rows.Scan(&item, &until); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		credit[item] = until
+	}
+	if len(credit) != 2 || credit["foo"] != 200 || credit["bar"] != 300 {
+		t.Fatal("expected credit to be moved to the new words:", credit)
+	}
+}
+
+func TestApplyActivityUnchanged(t *testing.T) {
+	// Remapping shouldn't count as learner activity.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	exec(
+		t,
+		db,
+		`INSERT INTO review (item, interval) VALUES ('foo', 24), ('Foo', 0)`,
+	)
+
+	total := func() int {
+		var n int
+		query := `SELECT coalesce(sum(forgotten + unimproved + crammed + learned + strengthened), 0) FROM activity`
+		if err := db.QueryRow(query).Scan(&n); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		return n
+	}
+
+	before := total()
+	plan := Plan{Mappings: []Mapping{{Item: "Foo", Word: "foo", Method: Casefold}}}
+	if err := Apply(db, plan); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if after := total(); before != after {
+		t.Fatal("expected activity to be unchanged:", before, after)
+	}
+}
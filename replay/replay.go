@@ -10,6 +10,7 @@ import (
 
 	"github.com/lggruspe/polycloze/database"
 	"github.com/lggruspe/polycloze/logger"
+	rs "github.com/lggruspe/polycloze/review_scheduler"
 	ws "github.com/lggruspe/polycloze/word_scheduler"
 )
 
@@ -31,9 +32,34 @@ func Tomorrow() time.Time {
 	return Today().Add(day).UTC()
 }
 
-func Replay(c *database.Connection, events []logger.LogEvent) error {
+// Returns grade of logged review.
+// Events without grades (e.g. from legacy logs) are graded as good or again.
+func grade(event logger.LogEvent) (rs.Grade, error) {
+	if event.Grade == "" {
+		return rs.GradeOf(event.Correct), nil
+	}
+	return rs.ParseGrade(event.Grade)
+}
+
+// Replays events in order.
+// Doesn't start its own transaction, so q can be a transaction to make the
+// whole replay atomic.
+func Replay[T database.Querier](q T, events []logger.LogEvent) error {
 	for _, event := range events {
-		err := ws.UpdateWordAt(c, event.Word, event.Correct, event.Timestamp)
+		grade, err := grade(event)
+		if err != nil {
+			return err
+		}
+
+		// Slow answers are graded as hard, and the review history keeps
+		// the other details, so replay them like the API does.
+		answer := rs.Answer{
+			Grade:    grade,
+			Latency:  event.Latency,
+			Hints:    event.Hints,
+			Digraphs: event.Digraphs,
+		}
+		err = ws.UpdateWordWith(q, event.Word, answer, event.Timestamp)
 		if err != nil {
 			return err
 		}
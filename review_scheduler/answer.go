@@ -0,0 +1,51 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package review_scheduler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Details of an answer.
+type Answer struct {
+	Grade Grade
+
+	// Time it took to answer. Zero if unknown.
+	Latency time.Duration
+
+	// Number of times the student got feedback (e.g. about typos) before
+	// answering.
+	Hints int
+
+	// Number of digraphs the student typed.
+	Digraphs int
+}
+
+// Correct answers that take longer than this are hard.
+// Zero disables latency-aware grading.
+var slowAnswerThreshold atomic.Int64
+
+// Sets threshold for grading correct answers as hard.
+// Zero (the default) disables latency-aware grading.
+func SetSlowAnswerThreshold(threshold time.Duration) {
+	slowAnswerThreshold.Store(int64(threshold))
+}
+
+func getSlowAnswerThreshold() time.Duration {
+	return time.Duration(slowAnswerThreshold.Load())
+}
+
+func (a Answer) Correct() bool {
+	return a.Grade.Correct()
+}
+
+// Returns grade used for scheduling.
+// Good answers that are slower than the threshold are graded as hard.
+func (a Answer) grade(threshold time.Duration) Grade {
+	if a.Grade == Good && threshold > 0 && a.Latency > threshold {
+		return Hard
+	}
+	return a.Grade
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package review_scheduler
+
+import (
+	"fmt"
+)
+
+// Outcome of a review.
+type Grade int
+
+const (
+	Again Grade = iota // Incorrect, resets the interval
+	Hard               // Correct, keeps the current interval
+	Good               // Correct, increases the interval by one step
+	Easy               // Correct, increases the interval by two steps
+)
+
+var gradeNames = []string{"again", "hard", "good", "easy"}
+
+// Converts correct/incorrect outcome into a grade.
+func GradeOf(correct bool) Grade {
+	if correct {
+		return Good
+	}
+	return Again
+}
+
+func ParseGrade(s string) (Grade, error) {
+	for i, name := range gradeNames {
+		if s == name {
+			return Grade(i), nil
+		}
+	}
+	return Again, fmt.Errorf("invalid grade: %q", s)
+}
+
+func (g Grade) String() string {
+	if g < Again || g > Easy {
+		return fmt.Sprintf("Grade(%d)", int(g))
+	}
+	return gradeNames[g]
+}
+
+func (g Grade) Correct() bool {
+	return g > Again
+}
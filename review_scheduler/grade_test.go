@@ -0,0 +1,37 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package review_scheduler
+
+import (
+	"testing"
+)
+
+func TestParseGrade(t *testing.T) {
+	t.Parallel()
+
+	for _, grade := range []Grade{Again, Hard, Good, Easy} {
+		parsed, err := ParseGrade(grade.String())
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if parsed != grade {
+			t.Fatal("expected ParseGrade and String to be inverse functions:", grade, parsed)
+		}
+	}
+
+	if _, err := ParseGrade("correct"); err == nil {
+		t.Fatal("expected error for invalid grade")
+	}
+}
+
+func TestGradeOf(t *testing.T) {
+	t.Parallel()
+
+	if GradeOf(true) != Good || !GradeOf(true).Correct() {
+		t.Fatal("expected correct answers to be good")
+	}
+	if GradeOf(false) != Again || GradeOf(false).Correct() {
+		t.Fatal("expected incorrect answers to be again")
+	}
+}
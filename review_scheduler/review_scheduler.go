@@ -87,32 +87,83 @@ func mostRecentReview(tx *sql.Tx, item string) (*Review, error) {
 }
 
 // Updates review status of item.
-func UpdateReviewAt[T database.Querier](q T, item string, correct bool, now time.Time) error {
-	tx, err := q.Begin()
+func UpdateReviewAt[T database.Querier](q T, item string, grade Grade, now time.Time) error {
+	return UpdateReviewWith(q, item, Answer{Grade: grade}, now)
+}
+
+// Updates review status of item, and records the answer in the review history.
+// Good answers slower than the threshold (see SetSlowAnswerThreshold) are
+// graded as hard.
+func UpdateReviewWith[T database.Querier](q T, item string, answer Answer, now time.Time) error {
+	return updateReview(q, item, answer, getSlowAnswerThreshold(), now)
+}
+
+// Records answer in review history.
+// grade: grade used for scheduling
+func insertHistory(tx *sql.Tx, item string, answer Answer, grade Grade, next Review) error {
+	var latency sql.NullInt64
+	if answer.Latency > 0 {
+		latency.Int64 = answer.Latency.Milliseconds()
+		latency.Valid = true
+	}
+	query := `
+		INSERT INTO review_history (item, reviewed, correct, latency, hints, digraphs, hard, grade, interval)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := tx.Exec(
+		query,
+		item,
+		next.Reviewed.Unix(),
+		answer.Correct(),
+		latency,
+		answer.Hints,
+		answer.Digraphs,
+		grade == Hard,
+		grade,
+		int64(next.Interval.Hours()),
+	)
+	return err
+}
+
+// Runs in the caller's transaction if q is a transaction.
+func updateReview[T database.Querier](q T, item string, answer Answer, threshold time.Duration, now time.Time) error {
+	err := database.InTransaction(q, func(tx *sql.Tx) error {
+		return updateReviewTx(tx, item, answer, threshold, now)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to update review: %v", err)
 	}
+	return nil
+}
+
+func updateReviewTx(tx *sql.Tx, item string, answer Answer, threshold time.Duration, now time.Time) error {
+	grade := answer.grade(threshold)
 
 	review, err := mostRecentReview(tx, item)
 	if err != nil {
-		return fmt.Errorf("failed to update review: %v", err)
+		return err
 	}
 
 	if review == nil || !now.Before(review.Due()) {
 		// Only update interval stats if the student didn't cram
-		if err := updateIntervalStats(tx, review, correct); err != nil {
-			return fmt.Errorf("failed to update review: %v", err)
+		if err := updateIntervalStats(tx, review, grade.Correct()); err != nil {
+			return err
 		}
 	}
 
-	next, err := nextReview(tx, review, correct, now)
+	next, err := nextReview(tx, review, grade, now)
 	if err != nil {
-		return fmt.Errorf("failed to update review: %v", err)
+		return err
+	}
+	if err := insertHistory(tx, item, answer, grade, next); err != nil {
+		return err
 	}
 
+	// Use the review time instead of the current time, so that replayed
+	// reviews get the same intervals as the original ones.
 	query := `
 		INSERT INTO review (item, interval, learned, reviewed)
-		VALUES (?, ?, unixepoch('now'), unixepoch('now'))
+		VALUES (?, ?, ?, ?)
 		ON CONFLICT (item) DO UPDATE SET
 			interval = excluded.interval,
 			reviewed = excluded.reviewed
@@ -121,16 +172,15 @@ func UpdateReviewAt[T database.Querier](q T, item string, correct bool, now time
 		query,
 		item,
 		int64(next.Interval.Hours()),
+		next.Reviewed.Unix(),
+		next.Reviewed.Unix(),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update review: %v", err)
-	}
-	if err := autoTune(tx); err != nil {
-		return fmt.Errorf("failed to update review: %v", err)
+		return err
 	}
-	return tx.Commit()
+	return autoTune(tx)
 }
 
-func UpdateReview[T database.Querier](q T, item string, correct bool) error {
-	return UpdateReviewAt(q, item, correct, time.Now().UTC())
+func UpdateReview[T database.Querier](q T, item string, grade Grade) error {
+	return UpdateReviewAt(q, item, grade, time.Now().UTC())
 }
@@ -4,6 +4,7 @@
 package review_scheduler
 
 import (
+	"database/sql"
 	"testing"
 	"time"
 
@@ -33,10 +34,10 @@ func TestUpdate(t *testing.T) {
 	db := utils.TestingDatabase()
 	defer db.Close()
 
-	if err := UpdateReview(db, "foo", false); err != nil {
+	if err := UpdateReview(db, "foo", Again); err != nil {
 		t.Fatal("expected err to be nil", err)
 	}
-	if err := UpdateReview(db, "bar", true); err != nil {
+	if err := UpdateReview(db, "bar", Good); err != nil {
 		t.Fatal("expected err to be nil", err)
 	}
 
@@ -61,7 +62,7 @@ func TestUpdateRecentlyAnsweredItemDoesntGetScheduled(t *testing.T) {
 
 	items := []string{"foo", "bar", "baz"}
 	for _, item := range items {
-		if err := UpdateReview(db, item, true); err != nil {
+		if err := UpdateReview(db, item, Good); err != nil {
 			t.Fatal("expected err to be nil:", err)
 		}
 	}
@@ -82,10 +83,10 @@ func TestUpdateIncorrectThenCorrect(t *testing.T) {
 	db := utils.TestingDatabase()
 	defer db.Close()
 
-	if err := UpdateReview(db, "foo", false); err != nil {
+	if err := UpdateReview(db, "foo", Again); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
-	if err := UpdateReview(db, "foo", true); err != nil {
+	if err := UpdateReview(db, "foo", Good); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
@@ -113,14 +114,14 @@ func TestUpdateSuccessfulReviewDoesNotDecreaseIntervalSize(t *testing.T) {
 
 	now := time.Now().UTC()
 
-	if err := UpdateReviewAt(db, "foo", true, now); err != nil {
+	if err := UpdateReviewAt(db, "foo", Good, now); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
 	before := query()
 
 	now = now.Add(3 * 24 * time.Hour)
-	if err := UpdateReviewAt(db, "foo", true, now); err != nil {
+	if err := UpdateReviewAt(db, "foo", Good, now); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
@@ -138,7 +139,7 @@ func TestCase(t *testing.T) {
 	db := utils.TestingDatabase()
 	defer db.Close()
 
-	if err := UpdateReview(db, "Foo", false); err != nil {
+	if err := UpdateReview(db, "Foo", Again); err != nil {
 		t.Fatal("expected nil err", err)
 	}
 
@@ -163,7 +164,7 @@ func TestReviewTimestampType(t *testing.T) {
 	db := utils.TestingDatabase()
 	defer db.Close()
 
-	if err := UpdateReview(db, "foo", true); err != nil {
+	if err := UpdateReview(db, "foo", Good); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
@@ -209,3 +210,145 @@ func TestReviewTimestampType(t *testing.T) {
 		}
 	}
 }
+
+func TestSlowCorrectAnswerKeepsInterval(t *testing.T) {
+	// Correct answers slower than the threshold shouldn't increase the
+	// interval.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	query := func(item string) time.Duration {
+		row := db.QueryRow(`select interval from review where item = ?`, item)
+		var interval time.Duration
+		if err := row.Scan(&interval); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		return interval * time.Hour
+	}
+
+	threshold := 10 * time.Second
+	now := time.Now().UTC()
+	for _, item := range []string{"fast", "slow"} {
+		if err := updateReview(db, item, Answer{Grade: Good}, threshold, now); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	before := query("slow")
+
+	now = now.Add(3 * 24 * time.Hour)
+	fast := Answer{Grade: Good, Latency: 2 * time.Second}
+	if err := updateReview(db, "fast", fast, threshold, now); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	slow := Answer{Grade: Good, Latency: time.Minute}
+	if err := updateReview(db, "slow", slow, threshold, now); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if after := query("slow"); after != before {
+		t.Fatal("expected slow answer to keep interval:", before, after)
+	}
+	if after := query("fast"); after <= before {
+		t.Fatal("expected fast answer to increase interval:", before, after)
+	}
+}
+
+func TestReviewHistory(t *testing.T) {
+	// Every answer should be recorded, with unknown latencies as NULL.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	now := time.Now().UTC()
+	if err := UpdateReviewAt(db, "foo", Again, now); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	answer := Answer{Grade: Good, Latency: 1500 * time.Millisecond, Hints: 1, Digraphs: 2}
+	if err := UpdateReviewWith(db, "foo", answer, now.Add(time.Minute)); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT correct, latency, hints, digraphs, hard, grade FROM review_history
+		WHERE item = 'foo' ORDER BY id
+	`)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	defer rows.Close()
+
+	type entry struct {
+		correct  bool
+		latency  sql.NullInt64
+		hints    int
+		digraphs int
+		hard     bool
+		grade    Grade
+	}
+	var history []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.correct, &e.latency, &e.hints, &e.digraphs, &e.hard, &e.grade); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if len(history) != 2 {
+		t.Fatal("expected one entry per answer:", history)
+	}
+	if history[0].correct || history[0].latency.Valid || history[0].grade != Again {
+		t.Fatal("expected incorrect answer with unknown latency:", history[0])
+	}
+	if h := history[1]; !h.correct || h.latency.Int64 != 1500 || h.hints != 1 || h.digraphs != 2 || h.hard || h.grade != Good {
+		t.Fatal("unexpected history entry:", h)
+	}
+}
+
+func TestGradedIntervals(t *testing.T) {
+	// Hard answers should keep the interval, and easy answers should skip
+	// one.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+
+	query := func(item string) time.Duration {
+		row := db.QueryRow(`select interval from review where item = ?`, item)
+		var interval time.Duration
+		if err := row.Scan(&interval); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		return interval * time.Hour
+	}
+
+	now := time.Now().UTC()
+	items := map[Grade]string{Hard: "hard", Good: "good", Easy: "easy"}
+	for _, item := range items {
+		if err := UpdateReviewAt(db, item, Good, now); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+	before := query("good")
+
+	now = now.Add(3 * 24 * time.Hour)
+	for grade, item := range items {
+		if err := UpdateReviewAt(db, item, grade, now); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	hard, good, easy := query("hard"), query("good"), query("easy")
+	if hard != before {
+		t.Fatal("expected hard answer to keep interval:", before, hard)
+	}
+	if good <= before || easy <= good {
+		t.Fatal("expected easy answer to skip an interval:", before, good, easy)
+	}
+}
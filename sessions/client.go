@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Client info of sessions.
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Header that contains the client's IP address when running behind a reverse
+// proxy (e.g. "Fly-Client-IP" on Fly.io).
+// If empty, the IP address of the connection gets used.
+var ClientIPHeader string
+
+// How often the last-seen time of a session gets updated.
+// Updating it on every request would turn every page load into a write.
+const lastSeenResolution = time.Minute
+
+// Gets IP address of client.
+func ClientIP(r *http.Request) string {
+	if ClientIPHeader != "" {
+		if ip := strings.TrimSpace(r.Header.Get(ClientIPHeader)); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Records client info and last-seen time of session, which renews the
+// session.
+// Returns false if the session was renewed less than lastSeenResolution ago,
+// so it doesn't need to be saved again yet.
+func renew(record Record, r *http.Request) (Record, bool) {
+	now := time.Now()
+	if now.Sub(record.LastSeen) < lastSeenResolution {
+		return record, false
+	}
+	record.LastSeen = now
+	record.IP = ClientIP(r)
+	record.UserAgent = r.UserAgent()
+	return record, true
+}
+
+// Info about a signed-in session, for showing to the user.
+type Info struct {
+	// Identifies session without revealing the session ID, which would be
+	// enough to hijack the session.
+	Handle string
+
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+	Current   bool // Whether it's the session that requested the list.
+}
+
+// Derives handle from session ID.
+func handle(id string) string {
+	sum := sha256.Sum256([]byte("session-handle:" + id))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// Lists user's sessions, most recently seen first.
+// current: ID of the session that's making the request
+// Returns ErrNotSupported if the store can't list sessions.
+func ListUserSessions(store Store, userID int, current string) ([]Info, error) {
+	records, err := store.List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Info, 0, len(records))
+	for _, record := range records {
+		sessions = append(sessions, Info{
+			Handle:    handle(record.ID),
+			Created:   record.Created,
+			LastSeen:  record.LastSeen,
+			IP:        record.IP,
+			UserAgent: record.UserAgent,
+			Current:   record.ID == current,
+		})
+	}
+	return sessions, nil
+}
+
+// Ends user's session with the given handle.
+// Returns an error if the user doesn't have a session with the handle.
+func EndSessionByHandle(store Store, userID int, h string) error {
+	records, err := store.List(userID)
+	if err != nil {
+		return fmt.Errorf("failed to end session: %v", err)
+	}
+	for _, record := range records {
+		if handle(record.ID) == h {
+			if err := store.Delete(record.ID); err != nil {
+				return fmt.Errorf("failed to end session: %v", err)
+			}
+			return nil
+		}
+	}
+	return errors.New("failed to end session: session not found")
+}
+
+// Ends all of user's sessions except the current one.
+func EndOtherSessions(store Store, userID int, current string) error {
+	if err := store.DeleteUser(userID, current); err != nil {
+		return fmt.Errorf("failed to end sessions: %v", err)
+	}
+	return nil
+}
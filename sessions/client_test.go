@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package sessions
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+)
+
+// Starts signed-in session for user with the given user agent.
+func startUserSession(t *testing.T, db *sql.DB, userID int, userAgent string) *Session {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", userAgent)
+	store := NewSQLiteStore(db)
+	s, err := StartSession(store, httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	s.Data["userID"] = userID
+	s.Data["username"] = "foo"
+	if err := SaveData(store, httptest.NewRecorder(), s); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return s
+}
+
+func TestListUserSessions(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	phone := startUserSession(t, db, 1, "phone")
+	startUserSession(t, db, 1, "laptop")
+	startUserSession(t, db, 2, "other user")
+
+	sessions, err := ListUserSessions(NewSQLiteStore(db), 1, phone.ID)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatal("expected 2 sessions:", sessions)
+	}
+
+	current := 0
+	for _, info := range sessions {
+		if info.Handle == phone.ID {
+			t.Fatal("handle should not reveal session ID")
+		}
+		if info.IP != "192.0.2.1" || info.LastSeen.IsZero() {
+			t.Fatal("expected client info to be recorded:", info)
+		}
+		if info.Current {
+			current++
+			if info.UserAgent != "phone" {
+				t.Fatal("unexpected current session:", info)
+			}
+		}
+	}
+	if current != 1 {
+		t.Fatal("expected exactly one current session:", sessions)
+	}
+}
+
+func TestEndSessionByHandle(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	phone := startUserSession(t, db, 1, "phone")
+	laptop := startUserSession(t, db, 1, "laptop")
+	other := startUserSession(t, db, 2, "other user")
+
+	sessions, err := ListUserSessions(NewSQLiteStore(db), 2, other.ID)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Users can't end other users' sessions.
+	if err := EndSessionByHandle(NewSQLiteStore(db), 1, sessions[0].Handle); err == nil {
+		t.Fatal("expected err to be non-nil")
+	}
+
+	if err := EndSessionByHandle(NewSQLiteStore(db), 1, handle(laptop.ID)); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	sessions, err = ListUserSessions(NewSQLiteStore(db), 1, phone.ID)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatal("expected only the current session to be left:", sessions)
+	}
+}
+
+func TestEndOtherSessions(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	phone := startUserSession(t, db, 1, "phone")
+	startUserSession(t, db, 1, "laptop")
+	other := startUserSession(t, db, 2, "other user")
+
+	if err := EndOtherSessions(NewSQLiteStore(db), 1, phone.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if data := loadData(db, phone.ID); data["userID"] != 1 {
+		t.Fatal("expected current session to still be signed in:", data)
+	}
+	if sessions, _ := ListUserSessions(NewSQLiteStore(db), 1, phone.ID); len(sessions) != 1 {
+		t.Fatal("expected other sessions to be ended:", sessions)
+	}
+	if data := loadData(db, other.ID); data["userID"] != 2 {
+		t.Fatal("expected other user's session to not be affected:", data)
+	}
+}
@@ -4,10 +4,10 @@
 package sessions
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // Name of cookie that stores session ID.
@@ -20,18 +20,22 @@ func getCookie(r *http.Request) (*http.Cookie, error) {
 	return r.Cookie(cookieName)
 }
 
-// Checks if the session ID in the cookie is still valid (in DB and not expired).
-func validateCookie(db *sql.DB, c *http.Cookie) error {
+// Checks if the session in the cookie is still valid (in store and not
+// expired).
+// Returns the session record.
+func validateCookie(store Store, c *http.Cookie) (Record, error) {
 	if c.Name != cookieName {
-		return errors.New("incorrect cookie name")
+		return Record{}, errors.New("incorrect cookie name")
 	}
-	var id string
-	// TODO scan expiry date for checking
-	query := `SELECT session_id FROM user_session WHERE session_id = ?`
-	if err := db.QueryRow(query, c.Value).Scan(&id); err != nil {
-		return fmt.Errorf("invalid session ID: %v", err)
+
+	record, err := store.Load(c.Value)
+	if err != nil {
+		return record, fmt.Errorf("invalid session: %v", err)
+	}
+	if record.expired(time.Now(), getTimeouts()) {
+		return record, errors.New("invalid session: session expired")
 	}
-	return nil
+	return record, nil
 }
 
 func setCookie(w http.ResponseWriter, id string) {
@@ -45,6 +49,19 @@ func setCookie(w http.ResponseWriter, id string) {
 	http.SetCookie(w, &c)
 }
 
+// Sets cookie that outlives the browser session, for "remember me" sessions.
+func setPersistentCookie(w http.ResponseWriter, id string, maxAge time.Duration) {
+	c := http.Cookie{
+		Name:     cookieName,
+		Value:    id,
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+		Secure:   true,
+		MaxAge:   int(maxAge.Seconds()),
+	}
+	http.SetCookie(w, &c)
+}
+
 func deleteCookie(w http.ResponseWriter) {
 	c := http.Cookie{
 		Name:     cookieName,
@@ -0,0 +1,254 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Stateless session store.
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Size of CookieStore keys in bytes (AES-256).
+const CookieKeySize = 32
+
+// Additional data for sealing cookies, so sealed values from other parts of
+// the app can't be used as session cookies.
+var cookieStoreAD = []byte("polycloze-session")
+
+// Stores sessions in the session cookie itself, encrypted and authenticated
+// with AES-GCM. No session lookups needed, so it scales without shared
+// storage.
+//
+// The store can't list sessions. Ended sessions are recorded in the users DB
+// until they would've expired anyway, so they can't be resumed with an old
+// cookie, even after the server restarts. The store keeps a copy of these
+// records in memory, so loading sessions doesn't query the DB.
+// Disabling or deleting a user ends the user's sessions, so their cookies get
+// rejected too.
+type CookieStore struct {
+	aead cipher.AEAD
+	db   *sql.DB
+
+	mu      sync.RWMutex
+	revoked map[string]int64      // Session ID -> time of revocation (ns)
+	cutoffs map[int]sessionCutoff // User ID -> cutoff
+}
+
+// Sessions of the user that were last updated at or before the cutoff have
+// ended, except for one.
+type sessionCutoff struct {
+	cutoff int64 // ns
+	except string
+}
+
+// Generates random CookieStore key.
+func GenerateCookieKey() ([]byte, error) {
+	key := make([]byte, CookieKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// key: secret key with CookieKeySize bytes
+// db: users DB
+func NewCookieStore(key []byte, db *sql.DB) (*CookieStore, error) {
+	if len(key) != CookieKeySize {
+		return nil, fmt.Errorf("session cookie key should be %v bytes long", CookieKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie store: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie store: %v", err)
+	}
+	c := &CookieStore{aead: aead, db: db}
+	if err := c.reload(); err != nil {
+		return nil, fmt.Errorf("failed to create cookie store: %v", err)
+	}
+	return c, nil
+}
+
+// Reloads ended sessions from the users DB.
+// Picks up sessions that were ended by other servers that share the DB.
+func (c *CookieStore) reload() error {
+	revoked := make(map[string]int64)
+	rows, err := c.db.Query(`SELECT session_id, revoked FROM session_revocation`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var t int64
+		if err := rows.Scan(&id, &t); err != nil {
+			return err
+		}
+		revoked[id] = t
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cutoffs := make(map[int]sessionCutoff)
+	rows, err = c.db.Query(`SELECT user_id, cutoff, except_session FROM session_cutoff`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int
+		var cutoff sessionCutoff
+		if err := rows.Scan(&userID, &cutoff.cutoff, &cutoff.except); err != nil {
+			return err
+		}
+		cutoffs[userID] = cutoff
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revoked = revoked
+	c.cutoffs = cutoffs
+	return nil
+}
+
+// IDs are random and aren't stored, so uniqueness isn't checked.
+func (c *CookieStore) New() (Record, error) {
+	id, err := generateID()
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to generate ID: %v", err)
+	}
+	now := time.Now()
+	return Record{ID: id, Created: now, Updated: now}, nil
+}
+
+// Returns the sealed record.
+func (c *CookieStore) Save(record Record) (string, error) {
+	plaintext, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to save session: %v", err)
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to save session: %v", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, cookieStoreAD)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *CookieStore) Load(cookie string) (Record, error) {
+	var record Record
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return record, ErrNotFound
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, cookieStoreAD)
+	if err != nil {
+		return record, ErrNotFound
+	}
+	if err := json.Unmarshal(plaintext, &record); err != nil {
+		return record, ErrNotFound
+	}
+
+	return record, c.check(record)
+}
+
+// Checks if session was ended.
+// Returns ErrNotFound if it was.
+func (c *CookieStore) check(record Record) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.revoked[record.ID]; ok {
+		return ErrNotFound
+	}
+	cutoff, ok := c.cutoffs[record.UserID]
+	if ok && record.ID != cutoff.except && !record.Updated.After(time.Unix(0, cutoff.cutoff)) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (c *CookieStore) Delete(id string) error {
+	now := time.Now().UnixNano()
+	query := `
+		INSERT INTO session_revocation (session_id, revoked) VALUES (?, ?)
+		ON CONFLICT (session_id) DO NOTHING
+	`
+	if _, err := c.db.Exec(query, id, now); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.revoked[id]; !ok {
+		c.revoked[id] = now
+	}
+	return nil
+}
+
+func (c *CookieStore) DeleteUser(userID int, except string) error {
+	cutoff := sessionCutoff{cutoff: time.Now().UnixNano(), except: except}
+	query := `
+		INSERT INTO session_cutoff (user_id, cutoff, except_session) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			cutoff = excluded.cutoff,
+			except_session = excluded.except_session
+	`
+	if _, err := c.db.Exec(query, userID, cutoff.cutoff, cutoff.except); err != nil {
+		return fmt.Errorf("failed to delete user sessions: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cutoffs[userID] = cutoff
+	return nil
+}
+
+func (c *CookieStore) List(userID int) ([]Record, error) {
+	return nil, ErrNotSupported
+}
+
+// Forgets ended sessions that have expired anyway, and reloads the rest.
+// Sessions stored in cookies can't be deleted, so this always returns 0.
+func (c *CookieStore) DeleteExpired(now time.Time, t Timeouts) (int64, error) {
+	// Sessions can be renewed until they hit the absolute timeout, or forever
+	// if they're "remember me" sessions. Either way, a session that ended at
+	// time x can't have been renewed after x, so it expires by x + the longest
+	// timeout.
+	longest := t.Absolute
+	if t.Remember > longest {
+		longest = t.Remember
+	}
+
+	before := now.Add(-longest).UnixNano()
+	queries := []string{
+		`DELETE FROM session_revocation WHERE revoked <= ?`,
+		`DELETE FROM session_cutoff WHERE cutoff <= ?`,
+	}
+	for _, query := range queries {
+		if _, err := c.db.Exec(query, before); err != nil {
+			return 0, fmt.Errorf("failed to delete expired sessions: %v", err)
+		}
+	}
+	if err := c.reload(); err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %v", err)
+	}
+	return 0, nil
+}
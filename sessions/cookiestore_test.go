@@ -0,0 +1,291 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package sessions
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lggruspe/polycloze/database"
+)
+
+// Creates users DB with users 1 and 2.
+func testUsersDB(t *testing.T) *sql.DB {
+	db, err := database.OpenUsersDB(":memory:")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	query := `INSERT INTO user (id, username, password) VALUES (1, 'foo', '!'), (2, 'bar', '!')`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return db
+}
+
+func newTestCookieStore(t *testing.T, key []byte, db *sql.DB) *CookieStore {
+	store, err := NewCookieStore(key, db)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return store
+}
+
+func testCookieStore(t *testing.T) *CookieStore {
+	key, err := GenerateCookieKey()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return newTestCookieStore(t, key, testUsersDB(t))
+}
+
+// Creates signed-in session record and returns the cookie value.
+func saveCookieRecord(t *testing.T, store *CookieStore, userID int) (Record, string) {
+	record, err := store.New()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	record.UserID = userID
+	record.Username = "foo"
+	record.Updated = time.Now()
+	cookie, err := store.Save(record)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return record, cookie
+}
+
+func TestNewCookieStoreKeySize(t *testing.T) {
+	t.Parallel()
+	if _, err := NewCookieStore([]byte("too short"), nil); err == nil {
+		t.Fatal("expected err to be non-nil")
+	}
+}
+
+func TestCookieStoreRoundTrip(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+
+	record, cookie := saveCookieRecord(t, store, 1)
+	loaded, err := store.Load(cookie)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if loaded.ID != record.ID || loaded.UserID != 1 || loaded.Username != "foo" {
+		t.Fatal("expected loaded record to match saved record:", loaded, record)
+	}
+}
+
+func TestCookieStoreTamperedCookie(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+
+	_, cookie := saveCookieRecord(t, store, 1)
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	sealed[len(sealed)/2] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(sealed)
+	if _, err := store.Load(tampered); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected tampered cookie to be rejected:", err)
+	}
+
+	// Cookies sealed with another key are rejected too.
+	if _, err := testCookieStore(t).Load(cookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected cookie from another store to be rejected:", err)
+	}
+}
+
+func TestCookieStoreDelete(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+
+	record, cookie := saveCookieRecord(t, store, 1)
+	if err := store.Delete(record.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := store.Load(cookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected deleted session to be rejected:", err)
+	}
+}
+
+func TestCookieStoreDeleteUser(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+
+	current, currentCookie := saveCookieRecord(t, store, 1)
+	_, otherCookie := saveCookieRecord(t, store, 1)
+	_, otherUserCookie := saveCookieRecord(t, store, 2)
+
+	if err := store.DeleteUser(1, current.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := store.Load(currentCookie); err != nil {
+		t.Fatal("expected excepted session to be kept:", err)
+	}
+	if _, err := store.Load(otherCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected other session to be rejected:", err)
+	}
+	if _, err := store.Load(otherUserCookie); err != nil {
+		t.Fatal("expected other user's session to not be affected:", err)
+	}
+
+	// Signing in again after the cutoff works.
+	time.Sleep(time.Millisecond)
+	_, cookie := saveCookieRecord(t, store, 1)
+	if _, err := store.Load(cookie); err != nil {
+		t.Fatal("expected new session to be valid:", err)
+	}
+}
+
+func TestCookieStoreList(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+	if _, err := store.List(1); !errors.Is(err, ErrNotSupported) {
+		t.Fatal("expected ErrNotSupported:", err)
+	}
+}
+
+func TestCookieStoreRestart(t *testing.T) {
+	// Ended sessions should stay ended after the server restarts.
+	t.Parallel()
+	key, err := GenerateCookieKey()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	db := testUsersDB(t)
+	store := newTestCookieStore(t, key, db)
+
+	deleted, deletedCookie := saveCookieRecord(t, store, 1)
+	if err := store.Delete(deleted.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	_, cutoffCookie := saveCookieRecord(t, store, 2)
+	if err := store.DeleteUser(2, ""); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	restarted := newTestCookieStore(t, key, db)
+	if _, err := restarted.Load(deletedCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected deleted session to be rejected after restart:", err)
+	}
+	if _, err := restarted.Load(cutoffCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ended session to be rejected after restart:", err)
+	}
+}
+
+func TestCookieStoreDisabledOrDeletedUser(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+
+	// Same as what the admin console does.
+	_, disabledCookie := saveCookieRecord(t, store, 1)
+	_, deletedCookie := saveCookieRecord(t, store, 2)
+	queries := []string{
+		`UPDATE user SET disabled = 1 WHERE id = 1`,
+		`DELETE FROM user WHERE id = 2`,
+	}
+	for i, query := range queries {
+		if _, err := store.db.Exec(query); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if err := EndUserSessions(store, i+1); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+	}
+
+	if _, err := store.Load(disabledCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected disabled user's session to be rejected:", err)
+	}
+	if _, err := store.Load(deletedCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected deleted user's session to be rejected:", err)
+	}
+}
+
+func TestCookieStoreLoadWithoutDB(t *testing.T) {
+	// Loading sessions shouldn't query the users DB.
+	t.Parallel()
+	store := testCookieStore(t)
+
+	deleted, deletedCookie := saveCookieRecord(t, store, 1)
+	if err := store.Delete(deleted.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	_, endedCookie := saveCookieRecord(t, store, 2)
+	if err := store.DeleteUser(2, ""); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	_, cookie := saveCookieRecord(t, store, 1)
+
+	// Queries fail after this.
+	if err := store.db.Close(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if _, err := store.Load(cookie); err != nil {
+		t.Fatal("expected valid session to load without the DB:", err)
+	}
+	if _, err := store.Load(deletedCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected deleted session to be rejected:", err)
+	}
+	if _, err := store.Load(endedCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ended session to be rejected:", err)
+	}
+}
+
+func TestCookieStoreSharedDB(t *testing.T) {
+	// Sessions ended by another server that shares the users DB get rejected
+	// after the next sweep.
+	t.Parallel()
+	key, err := GenerateCookieKey()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	db := testUsersDB(t)
+	store := newTestCookieStore(t, key, db)
+	other := newTestCookieStore(t, key, db)
+
+	record, cookie := saveCookieRecord(t, store, 1)
+	if err := other.Delete(record.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := store.DeleteExpired(time.Now(), DefaultTimeouts); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := store.Load(cookie); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected session ended by other server to be rejected:", err)
+	}
+}
+
+func TestCookieStoreDeleteExpired(t *testing.T) {
+	t.Parallel()
+	store := testCookieStore(t)
+
+	record, _ := saveCookieRecord(t, store, 1)
+	if err := store.Delete(record.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if err := store.DeleteUser(1, ""); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	later := time.Now().Add(DefaultTimeouts.Remember + time.Minute)
+	if _, err := store.DeleteExpired(later, DefaultTimeouts); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	var count int
+	query := `SELECT (SELECT count(*) FROM session_revocation) + (SELECT count(*) FROM session_cutoff)`
+	if err := store.db.QueryRow(query).Scan(&count); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if count != 0 {
+		t.Fatal("expected expired revocations to be forgotten:", count)
+	}
+}
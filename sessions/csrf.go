@@ -1,26 +1,162 @@
 // Copyright (c) 2022 Levi Gruspe
 // License: GNU AGPLv3 or later
 
+// CSRF tokens.
 package sessions
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 )
 
+// Min size of CSRF keys in bytes.
+const CSRFKeySize = 32
+
+// How long CSRF tokens stay valid.
+// Pages that stay open longer than this (e.g. the study page) need to be
+// reloaded.
+var CSRFTokenLifetime = 24 * time.Hour
+
+// Name of cookie for double-submitting CSRF tokens in JSON API requests.
+// Unlike the session cookie, scripts can read it.
+const csrfCookieName = "csrf-token"
+
+// Header that contains the CSRF token of JSON API requests.
+const CSRFHeader = "X-CSRF-Token"
+
+// Tokens contain the time they were issued, a random nonce (so every token is
+// different), and an HMAC of both and the session ID.
+const (
+	csrfTimestampSize = 8
+	csrfNonceSize     = 8
+	csrfTokenSize     = csrfTimestampSize + csrfNonceSize + sha256.Size
+)
+
+// Tokens issued slightly in the future are accepted, in case the clocks of
+// servers behind the same load balancer don't agree.
+const csrfClockSkew = time.Minute
+
+var (
+	csrfKeyMu sync.RWMutex
+	csrfKey   []byte
+)
+
+func init() {
+	key := make([]byte, CSRFKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	csrfKey = key
+}
+
+// Sets server secret for signing CSRF tokens.
+// By default, a random key is used, so tokens become invalid when the server
+// restarts, and servers that share sessions won't accept each other's tokens.
+func SetCSRFKey(key []byte) error {
+	if len(key) < CSRFKeySize {
+		return fmt.Errorf("CSRF key should be at least %v bytes long", CSRFKeySize)
+	}
+	csrfKeyMu.Lock()
+	defer csrfKeyMu.Unlock()
+	csrfKey = append([]byte(nil), key...)
+	return nil
+}
+
+// Computes MAC of token payload (timestamp and nonce) for the session.
+func csrfMAC(sessionID string, payload []byte) []byte {
+	csrfKeyMu.RLock()
+	mac := hmac.New(sha256.New, csrfKey)
+	csrfKeyMu.RUnlock()
+
+	mac.Write([]byte("csrf:"))
+	mac.Write([]byte(sessionID))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
 // Creates CSRF token for session.
-// Input should be base64 encoded.
+// Every call returns a different token.
 func CSRFToken(sessionID string) string {
-	bytes, err := base64.StdEncoding.DecodeString(sessionID)
-	if err != nil {
+	return csrfTokenAt(sessionID, time.Now())
+}
+
+func csrfTokenAt(sessionID string, now time.Time) string {
+	payload := make([]byte, csrfTimestampSize+csrfNonceSize)
+	binary.BigEndian.PutUint64(payload, uint64(now.Unix()))
+	if _, err := rand.Read(payload[csrfTimestampSize:]); err != nil {
 		panic(err)
 	}
-	result := sha256.Sum256(bytes)
-	bytes = result[:]
-	return base64.StdEncoding.EncodeToString(bytes)
+
+	token := append(payload, csrfMAC(sessionID, payload)...)
+	return base64.RawURLEncoding.EncodeToString(token)
 }
 
 // Validates CSRF token.
+// Tokens are only valid for the session they were issued to, and only for
+// CSRFTokenLifetime.
 func CheckCSRFToken(sessionID, token string) bool {
-	return CSRFToken(sessionID) == token
+	return checkCSRFTokenAt(sessionID, token, time.Now())
+}
+
+func checkCSRFTokenAt(sessionID, token string, now time.Time) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(decoded) != csrfTokenSize {
+		return false
+	}
+	payload := decoded[:csrfTimestampSize+csrfNonceSize]
+	mac := decoded[csrfTimestampSize+csrfNonceSize:]
+
+	// Check the MAC first, so the timestamp can be trusted.
+	if !hmac.Equal(mac, csrfMAC(sessionID, payload)) {
+		return false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if issued.After(now.Add(csrfClockSkew)) {
+		return false
+	}
+	return now.Sub(issued) < CSRFTokenLifetime
+}
+
+// Creates CSRF token for session, and also sets it as the double-submit
+// cookie for JSON API requests.
+// Scripts should read the cookie, which always has the latest token, instead
+// of the token in the page, which may be older if the user has other tabs open.
+func SetCSRFCookie(w http.ResponseWriter, sessionID string) string {
+	token := CSRFToken(sessionID)
+	c := http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+		MaxAge:   int(CSRFTokenLifetime.Seconds()),
+	}
+	http.SetCookie(w, &c)
+	return token
+}
+
+// Checks double-submitted CSRF token of JSON API request.
+// The token in the CSRFHeader header has to match the CSRF cookie, and has to
+// be valid for the session.
+// Cross-site scripts can't set headers on cross-origin requests, nor read the
+// cookie.
+func CheckCSRFHeader(r *http.Request, sessionID string) bool {
+	token := r.Header.Get(CSRFHeader)
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || token == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Value)) != 1 {
+		return false
+	}
+	return CheckCSRFToken(sessionID, token)
 }
@@ -4,7 +4,11 @@
 package sessions
 
 import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 // Generates session ID for testing.
@@ -36,3 +40,129 @@ func TestCSRFTokenIdNotEqual(t *testing.T) {
 		t.Fatal("expected token and session ID to be different:", id, token)
 	}
 }
+
+func TestCSRFTokenPerRequest(t *testing.T) {
+	t.Parallel()
+
+	id := tid()
+	a, b := CSRFToken(id), CSRFToken(id)
+	if a == b {
+		t.Fatal("expected tokens to be different:", a)
+	}
+	if !CheckCSRFToken(id, a) || !CheckCSRFToken(id, b) {
+		t.Fatal("expected both tokens to be valid")
+	}
+}
+
+func TestCSRFTokenOtherSession(t *testing.T) {
+	t.Parallel()
+
+	if CheckCSRFToken(tid(), CSRFToken(tid())) {
+		t.Fatal("expected token to be invalid for other session")
+	}
+}
+
+func TestCSRFTokenExpiry(t *testing.T) {
+	t.Parallel()
+
+	id := tid()
+	now := time.Now()
+	token := csrfTokenAt(id, now)
+	if !checkCSRFTokenAt(id, token, now.Add(CSRFTokenLifetime-time.Minute)) {
+		t.Fatal("expected token to still be valid")
+	}
+	if checkCSRFTokenAt(id, token, now.Add(CSRFTokenLifetime)) {
+		t.Fatal("expected token to expire")
+	}
+	if checkCSRFTokenAt(id, token, now.Add(-time.Hour)) {
+		t.Fatal("expected token from the future to be invalid")
+	}
+}
+
+func TestCSRFTokenTampered(t *testing.T) {
+	t.Parallel()
+
+	id := tid()
+	decoded, err := base64.RawURLEncoding.DecodeString(CSRFToken(id))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Pushing back the timestamp to extend the token's lifetime breaks the MAC.
+	decoded[csrfTimestampSize-1]++
+	if CheckCSRFToken(id, base64.RawURLEncoding.EncodeToString(decoded)) {
+		t.Fatal("expected tampered token to be invalid")
+	}
+
+	for _, token := range []string{"", "not base64!", "c2hvcnQ"} {
+		if CheckCSRFToken(id, token) {
+			t.Fatal("expected malformed token to be invalid:", token)
+		}
+	}
+}
+
+func TestCheckCSRFHeader(t *testing.T) {
+	t.Parallel()
+
+	id := tid()
+	w := httptest.NewRecorder()
+	token := SetCSRFCookie(w, id)
+	cookie := w.Result().Cookies()[0]
+	if cookie.HttpOnly || cookie.Value != token {
+		t.Fatal("expected cookie to be readable by scripts:", cookie)
+	}
+
+	request := func(header string, cookie *http.Cookie) *http.Request {
+		r := httptest.NewRequest("POST", "/", nil)
+		if header != "" {
+			r.Header.Set(CSRFHeader, header)
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		return r
+	}
+
+	if !CheckCSRFHeader(request(token, cookie), id) {
+		t.Fatal("expected double-submitted token to be valid")
+	}
+	if CheckCSRFHeader(request(token, nil), id) {
+		t.Fatal("expected token without cookie to be invalid")
+	}
+	if CheckCSRFHeader(request("", cookie), id) {
+		t.Fatal("expected cookie without header to be invalid")
+	}
+	if CheckCSRFHeader(request(CSRFToken(id), cookie), id) {
+		t.Fatal("expected header that doesn't match cookie to be invalid")
+	}
+	if CheckCSRFHeader(request(token, cookie), tid()) {
+		t.Fatal("expected token to be invalid for other session")
+	}
+}
+
+func TestRotateSession(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	store := NewSQLiteStore(db)
+	s := startUserSession(t, db, 1, "phone")
+	old := s.ID
+	token := CSRFToken(old)
+
+	if err := RotateSession(store, httptest.NewRecorder(), s); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if s.ID == old {
+		t.Fatal("expected session ID to change")
+	}
+	if _, err := store.Load(old); err == nil {
+		t.Fatal("expected old session to be ended")
+	}
+	if data := loadData(db, s.ID); data["userID"] != 1 {
+		t.Fatal("expected session data to be kept:", data)
+	}
+	if CheckCSRFToken(s.ID, token) {
+		t.Fatal("expected old CSRF token to be invalid after rotation")
+	}
+}
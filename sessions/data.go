@@ -4,22 +4,17 @@
 package sessions
 
 import (
-	"database/sql"
+	"net/http"
+	"time"
 )
 
-// Gets session data from the database.
-// Returns an empty map even if the ID does not exist.
-func getData(db *sql.DB, id string) map[string]any {
-	var userID sql.NullInt32
-	var username sql.NullString
-
+// Gets session data from session record.
+// Returns an empty map if the user isn't signed in.
+func getData(record Record) map[string]any {
 	data := make(map[string]any)
-	query := `SELECT user_id, username FROM user_session WHERE session_id = ?`
-	if err := db.QueryRow(query, id).Scan(&userID, &username); err == nil {
-		if userID.Valid && username.Valid {
-			data["userID"] = int(userID.Int32)
-			data["username"] = username.String
-		}
+	if record.UserID != 0 {
+		data["userID"] = record.UserID
+		data["username"] = record.Username
 	}
 	return data
 }
@@ -27,8 +22,26 @@ func getData(db *sql.DB, id string) map[string]any {
 // Saves session data.
 // The session must exist already.
 // `SaveData` would still return `nil`, but wouldn't insert a new entry for the missing session.
-func SaveData(db *sql.DB, s *Session) error {
-	query := `UPDATE user_session SET user_id = ?, username = ?, updated = unixepoch('now') WHERE session_id = ?`
-	_, err := db.Exec(query, s.Data["userID"], s.Data["username"], s.ID)
-	return err
+// Stores that keep sessions in cookies need to update the cookie, hence `w`.
+func SaveData(store Store, w http.ResponseWriter, s *Session) error {
+	record := s.record
+	record.ID = s.ID
+	record.UserID = 0
+	record.Username = ""
+
+	userID, ok := s.Data["userID"].(int)
+	username, _ := s.Data["username"].(string)
+	if ok {
+		record.UserID = userID
+		record.Username = username
+	}
+	record.Updated = time.Now()
+
+	value, err := store.Save(record)
+	if err != nil {
+		return err
+	}
+	s.record = record
+	saveCookie(w, value, record.Remember)
+	return nil
 }
@@ -5,10 +5,21 @@ package sessions
 
 import (
 	"database/sql"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
 
+// Loads session data from SQLite store.
+// Returns an empty map if the session doesn't exist.
+func loadData(db *sql.DB, id string) map[string]any {
+	record, err := NewSQLiteStore(db).Load(id)
+	if err != nil {
+		return make(map[string]any)
+	}
+	return getData(record)
+}
+
 // Gets `updated` timestamp of session.
 func timestamp(db *sql.DB, id string) (int, error) {
 	var updated int
@@ -17,14 +28,14 @@ func timestamp(db *sql.DB, id string) (int, error) {
 	return updated, err
 }
 
-func TestGetDataNonExistentID(t *testing.T) {
+func TestLoadDataNonExistentID(t *testing.T) {
 	// The result should be a non-nil empty map.
 	t.Parallel()
 	id := "abcdefg"
 	db := testDB()
 	defer db.Close()
 
-	data := getData(db, id)
+	data := loadData(db, id)
 	if data == nil {
 		t.Fatal("expected non-nil result:", data)
 	}
@@ -35,7 +46,7 @@ func TestGetDataNonExistentID(t *testing.T) {
 }
 
 func TestSaveDataNonExistentID(t *testing.T) {
-	// Allowed, but getData should be empty.
+	// Allowed, but loadData should be empty.
 	t.Parallel()
 	id := "abcdefg"
 	db := testDB()
@@ -48,11 +59,11 @@ func TestSaveDataNonExistentID(t *testing.T) {
 			"username": "foobar",
 		},
 	}
-	if err := SaveData(db, &s); err != nil {
+	if err := SaveData(NewSQLiteStore(db), httptest.NewRecorder(), &s); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
-	data := getData(db, id)
+	data := loadData(db, id)
 	if len(data) != 0 {
 		t.Fatal("expected the result to be an empty map:", data)
 	}
@@ -76,11 +87,11 @@ func TestGetSaveNonEmptyData(t *testing.T) {
 	if err := reserveID(db, id); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
-	if err := SaveData(db, &s); err != nil {
+	if err := SaveData(NewSQLiteStore(db), httptest.NewRecorder(), &s); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
-	data := getData(db, id)
+	data := loadData(db, id)
 	if data["username"] != s.Data["username"] {
 		t.Fatal(
 			"expected usernames to be equal:",
@@ -119,21 +130,21 @@ func TestGetSaveEmptyData(t *testing.T) {
 	if err := reserveID(db, id); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
-	if err := SaveData(db, &s); err != nil {
+	if err := SaveData(NewSQLiteStore(db), httptest.NewRecorder(), &s); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
-	if data := getData(db, id); len(data) != 2 {
+	if data := loadData(db, id); len(data) != 2 {
 		t.Fatal("expected result to contain two entries:", data)
 	}
 
 	// Next, save session with empty data.
 	s.Data = make(map[string]any)
 
-	if err := SaveData(db, &s); err != nil {
+	if err := SaveData(NewSQLiteStore(db), httptest.NewRecorder(), &s); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
-	if data := getData(db, id); len(data) != 0 {
+	if data := loadData(db, id); len(data) != 0 {
 		t.Fatal("expected result to be an empty map:", data)
 	}
 }
@@ -150,7 +161,7 @@ func TestSaveDataTimestamp(t *testing.T) {
 	if err := reserveID(db, id); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
-	if err := SaveData(db, &s); err != nil {
+	if err := SaveData(NewSQLiteStore(db), httptest.NewRecorder(), &s); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
@@ -162,7 +173,7 @@ func TestSaveDataTimestamp(t *testing.T) {
 	// Sleep for one second to make sure timestamp will change.
 	time.Sleep(time.Second)
 
-	if err := SaveData(db, &s); err != nil {
+	if err := SaveData(NewSQLiteStore(db), httptest.NewRecorder(), &s); err != nil {
 		t.Fatal("expected err to be nil:", err)
 	}
 
@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Session expiry.
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Session lifetimes.
+type Timeouts struct {
+	// Sessions end after this much inactivity.
+	// Each request renews the session, so learners don't get signed out in
+	// the middle of a lesson.
+	Idle time.Duration
+
+	// Sessions end this long after sign-in, even if they're active.
+	Absolute time.Duration
+
+	// "Remember me" sessions end after this much inactivity instead, and
+	// don't have an absolute timeout.
+	Remember time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Idle:     2 * time.Hour,
+	Absolute: 24 * time.Hour,
+	Remember: 30 * 24 * time.Hour,
+}
+
+func (t Timeouts) validate() error {
+	if t.Idle <= 0 || t.Absolute <= 0 || t.Remember <= 0 {
+		return errors.New("session timeouts should be positive")
+	}
+	if t.Idle > t.Absolute {
+		return errors.New("idle session timeout should not be longer than absolute timeout")
+	}
+	return nil
+}
+
+var (
+	timeoutsMu sync.RWMutex
+	timeouts   = DefaultTimeouts
+)
+
+// Sets session lifetimes.
+func SetTimeouts(t Timeouts) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	timeouts = t
+	return nil
+}
+
+func getTimeouts() Timeouts {
+	timeoutsMu.RLock()
+	defer timeoutsMu.RUnlock()
+	return timeouts
+}
+
+// Deletes expired sessions.
+// Returns the number of deleted sessions.
+func DeleteExpired(store Store) (int64, error) {
+	return store.DeleteExpired(time.Now(), getTimeouts())
+}
+
+// Deletes expired sessions periodically until the context is done.
+// Meant to be run in its own goroutine.
+func Sweep(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := DeleteExpired(store); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// Makes session last longer ("remember me").
+// The cookie gets replaced with a persistent one.
+func Remember(store Store, w http.ResponseWriter, s *Session) error {
+	record := s.record
+	record.ID = s.ID
+	record.Remember = true
+
+	value, err := store.Save(record)
+	if err != nil {
+		return fmt.Errorf("failed to remember session: %v", err)
+	}
+	s.record = record
+	saveCookie(w, value, true)
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package sessions
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Checks if session in SQLite store has expired by the given time.
+func isExpired(t *testing.T, db *sql.DB, id string, now time.Time) bool {
+	record, err := NewSQLiteStore(db).Load(id)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	return record.expired(now, DefaultTimeouts)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	s := startUserSession(t, db, 1, "phone")
+	now := time.Now()
+	if isExpired(t, db, s.ID, now) {
+		t.Fatal("expected new session to be valid")
+	}
+
+	later := now.Add(DefaultTimeouts.Idle + time.Minute)
+	if !isExpired(t, db, s.ID, later) {
+		t.Fatal("expected idle session to expire")
+	}
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	s := startUserSession(t, db, 1, "phone")
+
+	// Pretend the session stayed active.
+	later := time.Now().Add(DefaultTimeouts.Absolute + time.Minute)
+	query := `UPDATE user_session SET last_seen = ? WHERE session_id = ?`
+	if _, err := db.Exec(query, later.Unix(), s.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if !isExpired(t, db, s.ID, later) {
+		t.Fatal("expected old session to expire even if it's active")
+	}
+}
+
+func TestRememberSession(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	s := startUserSession(t, db, 1, "phone")
+	w := httptest.NewRecorder()
+	if err := Remember(NewSQLiteStore(db), w, s); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge != int(DefaultTimeouts.Remember.Seconds()) {
+		t.Fatal("expected persistent cookie:", cookies)
+	}
+
+	now := time.Now()
+	if isExpired(t, db, s.ID, now.Add(DefaultTimeouts.Absolute+time.Minute)) {
+		t.Fatal("expected remembered session to outlive normal sessions")
+	}
+	if !isExpired(t, db, s.ID, now.Add(DefaultTimeouts.Remember+time.Minute)) {
+		t.Fatal("expected remembered session to expire eventually")
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	t.Parallel()
+	db := testDB()
+	defer db.Close()
+
+	idle := startUserSession(t, db, 1, "phone")
+	active := startUserSession(t, db, 1, "laptop")
+
+	later := time.Now().Add(DefaultTimeouts.Idle + time.Minute)
+	query := `UPDATE user_session SET last_seen = ? WHERE session_id = ?`
+	if _, err := db.Exec(query, later.Unix(), active.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	n, err := NewSQLiteStore(db).DeleteExpired(later, DefaultTimeouts)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if n != 1 {
+		t.Fatal("expected one session to be deleted:", n)
+	}
+	if data := loadData(db, idle.ID); len(data) != 0 {
+		t.Fatal("expected idle session to be deleted:", data)
+	}
+	if data := loadData(db, active.ID); len(data) == 0 {
+		t.Fatal("expected active session to not be deleted")
+	}
+}
+
+func TestTimeoutsValidate(t *testing.T) {
+	t.Parallel()
+
+	if err := DefaultTimeouts.validate(); err != nil {
+		t.Fatal("expected default timeouts to be valid:", err)
+	}
+	invalid := []Timeouts{
+		{Idle: 0, Absolute: time.Hour, Remember: time.Hour},
+		{Idle: 2 * time.Hour, Absolute: time.Hour, Remember: time.Hour},
+	}
+	for _, timeouts := range invalid {
+		if err := timeouts.validate(); err == nil {
+			t.Fatal("expected err to be non-nil:", timeouts)
+		}
+	}
+}
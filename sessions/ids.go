@@ -50,13 +50,8 @@ func reserveID(db *sql.DB, id string) error {
 }
 
 // Deletes session ID from the database.
-// Also deletes old (created > 4 hours ago) and idle (updated > 30 minutes ago) sessions.
+// Expired sessions get deleted by `Sweep` instead.
 func deleteID(db *sql.DB, id string) error {
-	query := `
-		DELETE FROM user_session WHERE session_id = ?
-			OR created < (unixepoch('now') - 14400)
-			OR updated < (unixepoch('now') - 1800)
-	`
-	_, err := db.Exec(query, id)
+	_, err := db.Exec(`DELETE FROM user_session WHERE session_id = ?`, id)
 	return err
 }
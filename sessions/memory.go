@@ -0,0 +1,160 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// In-memory session store.
+package sessions
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default max number of sessions in MemoryStore.
+const DefaultMemoryStoreCapacity = 10000
+
+// Stores sessions in memory, so page loads don't have to wait for the users
+// DB. Sessions don't survive restarts.
+// When the store is full, the least recently used session gets evicted.
+type MemoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List               // Most recently used first.
+	elements map[string]*list.Element // Values are Records.
+}
+
+// capacity: max number of sessions
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = DefaultMemoryStoreCapacity
+	}
+	return &MemoryStore{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// Adds record to the front of the list, and evicts the least recently used
+// records if the store is full.
+// Assumes the lock is held.
+func (m *MemoryStore) push(record Record) {
+	m.elements[record.ID] = m.order.PushFront(record)
+	for m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.elements, oldest.Value.(Record).ID)
+	}
+}
+
+// Assumes the lock is held.
+func (m *MemoryStore) remove(id string) {
+	if element, ok := m.elements[id]; ok {
+		m.order.Remove(element)
+		delete(m.elements, id)
+	}
+}
+
+func (m *MemoryStore) New() (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		id, err := generateID()
+		if err != nil {
+			return Record{}, fmt.Errorf("failed to generate a unique ID: %v", err)
+		}
+		if _, ok := m.elements[id]; ok {
+			continue
+		}
+
+		now := time.Now()
+		record := Record{ID: id, Created: now, Updated: now}
+		m.push(record)
+		return record, nil
+	}
+}
+
+// Session ID is used as the cookie value.
+// Does nothing if the session doesn't exist (e.g. if it was evicted).
+func (m *MemoryStore) Save(record Record) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.elements[record.ID]; ok {
+		element.Value = record
+		m.order.MoveToFront(element)
+	}
+	return record.ID, nil
+}
+
+func (m *MemoryStore) Load(cookie string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.elements[cookie]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	m.order.MoveToFront(element)
+	return element.Value.(Record), nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+func (m *MemoryStore) DeleteUser(userID int, except string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, element := range m.elements {
+		if element.Value.(Record).UserID == userID && id != except {
+			m.remove(id)
+		}
+	}
+	return nil
+}
+
+// Lists user's sessions, most recently seen first.
+func (m *MemoryStore) List(userID int) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := make([]Record, 0)
+	for _, element := range m.elements {
+		if record := element.Value.(Record); record.UserID == userID {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+	return records, nil
+}
+
+func (m *MemoryStore) DeleteExpired(now time.Time, t Timeouts) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for id, element := range m.elements {
+		if element.Value.(Record).expired(now, t) {
+			m.remove(id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Number of sessions in the store.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package sessions
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore(2)
+
+	first, err := store.New()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	second, err := store.New()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	// Using the first session makes the second one the least recently used.
+	if _, err := store.Load(first.ID); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, err := store.New(); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if store.Len() != 2 {
+		t.Fatal("expected store to be at capacity:", store.Len())
+	}
+	if _, err := store.Load(second.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected least recently used session to be evicted:", err)
+	}
+	if _, err := store.Load(first.ID); err != nil {
+		t.Fatal("expected recently used session to be kept:", err)
+	}
+}
+
+func TestMemoryStoreDeleteUser(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore(0)
+
+	var ids []string
+	for _, userID := range []int{1, 1, 2} {
+		record, err := store.New()
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		record.UserID = userID
+		record.Username = "foo"
+		if _, err := store.Save(record); err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		ids = append(ids, record.ID)
+	}
+
+	if err := store.DeleteUser(1, ids[0]); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	records, err := store.List(1)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(records) != 1 || records[0].ID != ids[0] {
+		t.Fatal("expected only the excepted session to be left:", records)
+	}
+	if _, err := store.Load(ids[2]); err != nil {
+		t.Fatal("expected other user's session to not be affected:", err)
+	}
+}
+
+func TestMemoryStoreDeleteExpired(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore(0)
+
+	record, err := store.New()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	record.LastSeen = time.Now()
+	if _, err := store.Save(record); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	later := time.Now().Add(DefaultTimeouts.Idle + time.Minute)
+	n, err := store.DeleteExpired(later, DefaultTimeouts)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if n != 1 || store.Len() != 0 {
+		t.Fatal("expected expired session to be deleted:", n, store.Len())
+	}
+}
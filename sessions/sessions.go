@@ -4,81 +4,152 @@
 package sessions
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Session struct {
 	ID   string
 	Data map[string]any
+
+	record Record
+}
+
+// Returns when the session started.
+// Sessions get replaced on sign-in (see RotateSession), so this is also when
+// the user signed in.
+func (s *Session) Created() time.Time {
+	return s.record.Created
+}
+
+// Sets session cookie.
+// "Remember me" sessions get a persistent cookie.
+func saveCookie(w http.ResponseWriter, value string, remember bool) {
+	if remember {
+		setPersistentCookie(w, value, getTimeouts().Remember)
+	} else {
+		setCookie(w, value)
+	}
 }
 
 // Starts a new session.
 // Overwrites existing sessions, if any.
-func StartSession(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Session, error) {
-	if err := EndSession(db, w, r); err != nil {
+func StartSession(store Store, w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if err := EndSession(store, w, r); err != nil {
 		return nil, fmt.Errorf("failed to start session: %v", err)
 	}
 
-	id, err := generateUniqueID(db)
+	record, err := store.New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to start session: %v", err)
 	}
+	record.LastSeen = time.Now()
+	record.IP = ClientIP(r)
+	record.UserAgent = r.UserAgent()
 
-	setCookie(w, id)
+	value, err := store.Save(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	setCookie(w, value)
 
 	s := Session{
-		ID:   id,
-		Data: make(map[string]any),
+		ID:     record.ID,
+		Data:   make(map[string]any),
+		record: record,
 	}
 	return &s, nil
 }
 
 // Resumes an existing (valid) session.
 // If there's none, returns an error.
-func ResumeSession(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Session, error) {
+func ResumeSession(store Store, w http.ResponseWriter, r *http.Request) (*Session, error) {
 	c, err := getCookie(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resume session: %v", err)
 	}
 
-	if err := validateCookie(db, c); err != nil {
-		_ = EndSession(db, w, r)
+	record, err := validateCookie(store, c)
+	if err != nil {
+		_ = EndSession(store, w, r)
 		return nil, fmt.Errorf("failed to resume session: %v", err)
 	}
 
+	// Failing to renew the session shouldn't end it, because it's still
+	// valid.
+	if renewed, ok := renew(record, r); ok {
+		if value, err := store.Save(renewed); err == nil {
+			record = renewed
+			saveCookie(w, value, record.Remember)
+		}
+	}
+
 	s := Session{
-		ID:   c.Value,
-		Data: getData(db, c.Value),
+		ID:     record.ID,
+		Data:   getData(record),
+		record: record,
 	}
 	return &s, nil
 }
 
 // Resumes an existing (valid) session, or starts a new one if there's none yet.
-func StartOrResumeSession(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Session, error) {
-	s, err := ResumeSession(db, w, r)
+func StartOrResumeSession(store Store, w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s, err := ResumeSession(store, w, r)
 	if err == nil {
 		return s, nil
 	}
-	return StartSession(db, w, r)
+	return StartSession(store, w, r)
 }
 
-// Ends a session.
-// Does nothing if there's no client session cookie.
-func EndSession(db *sql.DB, w http.ResponseWriter, r *http.Request) error {
-	var id string
-	c, err := getCookie(r)
-	if err == nil {
-		id = c.Value
+// Moves session to a new ID, and ends the old one.
+// Should be done on sign-in, so that CSRF tokens that were issued before the
+// user signed in (and session IDs planted by attackers) become useless.
+// The session's absolute lifetime restarts.
+func RotateSession(store Store, w http.ResponseWriter, s *Session) error {
+	fresh, err := store.New()
+	if err != nil {
+		return fmt.Errorf("failed to rotate session: %v", err)
 	}
 
-	// Deleting empty ID doesn't delete any specific session, but deletes stale sessions.
-	if err := deleteID(db, id); err != nil {
-		return fmt.Errorf("failed to end session: %v", err)
+	record := s.record
+	record.ID = fresh.ID
+	record.Created = fresh.Created
+	value, err := store.Save(record)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session: %v", err)
+	}
+	if err := store.Delete(s.ID); err != nil {
+		return fmt.Errorf("failed to rotate session: %v", err)
+	}
+
+	s.ID = record.ID
+	s.record = record
+	saveCookie(w, value, record.Remember)
+	return nil
+}
+
+// Ends a session.
+// Does nothing if there's no client session cookie.
+func EndSession(store Store, w http.ResponseWriter, r *http.Request) error {
+	if c, err := getCookie(r); err == nil {
+		// Nothing to delete if the session doesn't exist.
+		if record, err := store.Load(c.Value); err == nil {
+			if err := store.Delete(record.ID); err != nil {
+				return fmt.Errorf("failed to end session: %v", err)
+			}
+		}
 	}
 
 	// Deletes the cookie whether valid or not.
 	deleteCookie(w)
 	return nil
 }
+
+// Ends all sessions of user.
+func EndUserSessions(store Store, userID int) error {
+	if err := store.DeleteUser(userID, ""); err != nil {
+		return fmt.Errorf("failed to end sessions: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Session store backed by the users DB.
+package sessions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stores sessions in the `user_session` table.
+// Sessions survive restarts, and users can list and end their sessions.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// db: users DB
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) New() (Record, error) {
+	id, err := generateUniqueID(s.db)
+	if err != nil {
+		return Record{}, err
+	}
+	now := time.Now()
+	return Record{ID: id, Created: now, Updated: now}, nil
+}
+
+// Session ID is used as the cookie value.
+// Does nothing if the session doesn't exist.
+func (s *SQLiteStore) Save(record Record) (string, error) {
+	var userID, username any
+	if record.UserID != 0 {
+		userID = record.UserID
+		username = record.Username
+	}
+
+	query := `
+		UPDATE user_session
+		SET user_id = ?, username = ?, updated = ?, last_seen = ?, remember = ?,
+			ip = ?, user_agent = ?
+		WHERE session_id = ?
+	`
+	_, err := s.db.Exec(
+		query,
+		userID,
+		username,
+		record.Updated.Unix(),
+		record.LastSeen.Unix(),
+		record.Remember,
+		record.IP,
+		record.UserAgent,
+		record.ID,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to save session: %v", err)
+	}
+	return record.ID, nil
+}
+
+const selectRecord = `
+	SELECT session_id, user_id, username, created, updated, last_seen, remember,
+		ip, user_agent
+	FROM user_session
+`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRecord(s scanner) (Record, error) {
+	var record Record
+	var userID sql.NullInt32
+	var username sql.NullString
+	var created, updated, lastSeen int64
+	err := s.Scan(
+		&record.ID,
+		&userID,
+		&username,
+		&created,
+		&updated,
+		&lastSeen,
+		&record.Remember,
+		&record.IP,
+		&record.UserAgent,
+	)
+	if err != nil {
+		return record, err
+	}
+	if userID.Valid && username.Valid {
+		record.UserID = int(userID.Int32)
+		record.Username = username.String
+	}
+	record.Created = time.Unix(created, 0)
+	record.Updated = time.Unix(updated, 0)
+	record.LastSeen = time.Unix(lastSeen, 0)
+	return record, nil
+}
+
+func (s *SQLiteStore) Load(cookie string) (Record, error) {
+	record, err := scanRecord(s.db.QueryRow(selectRecord+` WHERE session_id = ?`, cookie))
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, ErrNotFound
+	}
+	if err != nil {
+		return record, fmt.Errorf("failed to load session: %v", err)
+	}
+	return record, nil
+}
+
+func (s *SQLiteStore) Delete(id string) error {
+	if err := deleteID(s.db, id); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteUser(userID int, except string) error {
+	query := `DELETE FROM user_session WHERE user_id = ? AND session_id != ?`
+	if _, err := s.db.Exec(query, userID, except); err != nil {
+		return fmt.Errorf("failed to delete sessions: %v", err)
+	}
+	return nil
+}
+
+// Lists user's sessions, most recently seen first.
+func (s *SQLiteStore) List(userID int) ([]Record, error) {
+	rows, err := s.db.Query(selectRecord+` WHERE user_id = ? ORDER BY last_seen DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	defer rows.Close()
+
+	records := make([]Record, 0)
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// SQL condition that's true for sessions that haven't expired.
+// Takes the current time, idle, absolute and remember timeouts (in seconds)
+// as arguments.
+// Should agree with `Record.expired`.
+const unexpired = `
+	(
+		(remember AND last_seen > ?1 - ?4)
+		OR (NOT remember AND last_seen > ?1 - ?2 AND created > ?1 - ?3)
+	)
+`
+
+func (s *SQLiteStore) DeleteExpired(now time.Time, t Timeouts) (int64, error) {
+	query := `DELETE FROM user_session WHERE NOT ` + unexpired
+	result, err := s.db.Exec(
+		query,
+		now.Unix(),
+		int64(t.Idle.Seconds()),
+		int64(t.Absolute.Seconds()),
+		int64(t.Remember.Seconds()),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Session storage.
+package sessions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// Returned by `Store.Load` when the session doesn't exist.
+	ErrNotFound = errors.New("session not found")
+
+	// Returned by stores that don't keep track of sessions, e.g. when listing
+	// sessions stored in cookies.
+	ErrNotSupported = errors.New("not supported by session store")
+)
+
+// Stored session.
+type Record struct {
+	ID       string
+	UserID   int    // 0 if the user isn't signed in.
+	Username string // Empty if the user isn't signed in.
+
+	Created  time.Time
+	Updated  time.Time // When the session data was last saved, e.g. on sign-in.
+	LastSeen time.Time
+	Remember bool
+
+	IP        string
+	UserAgent string
+}
+
+// Checks if session has expired.
+func (r Record) expired(now time.Time, t Timeouts) bool {
+	if r.Remember {
+		return now.Sub(r.LastSeen) >= t.Remember
+	}
+	return now.Sub(r.LastSeen) >= t.Idle || now.Sub(r.Created) >= t.Absolute
+}
+
+// Session storage backend.
+type Store interface {
+	// Creates record for a new session with a unique random ID.
+	New() (Record, error)
+
+	// Saves session record.
+	// Returns the value of the session cookie that refers to the record.
+	Save(record Record) (string, error)
+
+	// Loads session record using the value of the session cookie.
+	// Returns ErrNotFound if there's no such session.
+	// Doesn't check if the session has expired.
+	Load(cookie string) (Record, error)
+
+	// Deletes session with the given ID.
+	// It's not an error to delete a session that doesn't exist.
+	Delete(id string) error
+
+	// Deletes user's sessions, except the one with the given ID.
+	DeleteUser(userID int, except string) error
+
+	// Lists user's sessions.
+	// May return ErrNotSupported.
+	List(userID int) ([]Record, error)
+
+	// Deletes sessions that expired by the given time.
+	// Returns the number of deleted sessions.
+	DeleteExpired(now time.Time, t Timeouts) (int64, error)
+}
+
+type contextValueKey int
+
+const keyStore contextValueKey = iota
+
+// Stuffs session store into request context.
+func Middleware(store Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), keyStore, store)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Gets session store from request context.
+// Returns false if Middleware isn't used.
+func GetStore(r *http.Request) (Store, bool) {
+	store, ok := r.Context().Value(keyStore).(Store)
+	return store, ok
+}
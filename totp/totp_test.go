@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodeRFC6238(t *testing.T) {
+	// Test vectors from RFC 6238 (SHA1), truncated to 6 digits.
+	t.Parallel()
+
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range cases {
+		code, err := Code(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal("expected err to be nil:", err)
+		}
+		if code != expected {
+			t.Fatal("unexpected code:", unix, code, expected)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	t.Parallel()
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, now.Add(-period*time.Second))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, ok := Validate(secret, code, now); !ok {
+		t.Fatal("expected code from previous step to be accepted")
+	}
+
+	code, err = Code(secret, now.Add(-3*period*time.Second))
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if _, ok := Validate(secret, code, now); ok {
+		t.Fatal("expected old code to be rejected")
+	}
+}
+
+func TestURI(t *testing.T) {
+	t.Parallel()
+
+	uri := URI("polycloze", "foo bar", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/polycloze:foo%20bar?") {
+		t.Fatal("unexpected label:", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=polycloze") {
+		t.Fatal("expected URI to contain secret and issuer:", uri)
+	}
+}
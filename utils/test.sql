@@ -9,6 +9,10 @@ CREATE TABLE language (
 		code char(3) not null check (length(code) = 3),
 		name text not null
 		, bcp47 text not null);
+CREATE TABLE metadata (
+		key text primary key,
+		value text not null
+		);
 CREATE TABLE sentence (
 		id integer primary key,
 		tatoeba_id integer unique,	-- null for non-tatoeba sentences
@@ -29,6 +33,7 @@ CREATE TABLE word (
 		id integer primary key,
 		word text unique not null,
 		frequency_class integer not null
-		);
+		, lemma text, pos text);
 CREATE INDEX index_contains_word on contains (word);
+CREATE INDEX index_word_lemma on word (lemma);
 COMMIT;
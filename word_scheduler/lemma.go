@@ -0,0 +1,193 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+// Lemma-aware scheduling.
+// Words with the same lemma and part of speech are forms of the same word.
+package word_scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lggruspe/polycloze/database"
+)
+
+// Fraction of a learned form's interval that gets credited when a related form
+// gets answered correctly.
+const relatedFormCredit = 0.5
+
+// Checks if the course has lemmas.
+// Courses built before lemmas were added don't have a lemma column.
+func HasLemmas[T database.Querier](q T) (bool, error) {
+	rows, err := q.Query(`SELECT * FROM word LIMIT 0`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	for _, column := range columns {
+		if column == "lemma" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns other forms of the word (same lemma and part of speech).
+// Returns nothing if the course doesn't have lemmas or if the word has no
+// lemma.
+func RelatedForms[T database.Querier](q T, word string) ([]string, error) {
+	ok, err := HasLemmas(q)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	query := `
+		SELECT b.word FROM word AS a JOIN word AS b
+		ON (a.lemma = b.lemma AND a.pos IS b.pos)
+		WHERE a.word = ? AND b.word != a.word
+		ORDER BY b.id ASC
+	`
+	rows, err := q.Query(query, word)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var forms []string
+	for rows.Next() {
+		var form string
+		if err := rows.Scan(&form); err != nil {
+			return nil, err
+		}
+		forms = append(forms, form)
+	}
+	return forms, nil
+}
+
+// Updates partial credit after a review.
+// The reviewed item loses its own credit, because it just got a real review.
+// If the answer was correct, learned related forms get partial credit, so they
+// don't get scheduled for review again too soon.
+func updateRelatedCredit[T database.Querier](q T, word string, correct bool, now time.Time) error {
+	if _, err := q.Exec(`DELETE FROM related_credit WHERE item = ?`, word); err != nil {
+		return fmt.Errorf("failed to update related credit: %v", err)
+	}
+	if !correct {
+		return nil
+	}
+
+	forms, err := RelatedForms(q, word)
+	if err != nil {
+		return fmt.Errorf("failed to update related credit: %v", err)
+	}
+
+	query := `
+		INSERT INTO related_credit (item, until)
+		SELECT item, ? + CAST(? * interval * 3600 AS INTEGER) FROM review
+		WHERE item = ? AND interval > 0
+		ON CONFLICT (item) DO UPDATE SET
+			until = max(until, excluded.until)
+	`
+	for _, form := range forms {
+		if _, err := q.Exec(query, now.Unix(), relatedFormCredit, form); err != nil {
+			return fmt.Errorf("failed to update related credit: %v", err)
+		}
+	}
+	return nil
+}
+
+// Returns set of items that have unexpired partial credit.
+func creditedItems[T database.Querier](q T, now time.Time) (map[string]bool, error) {
+	rows, err := q.Query(`SELECT item FROM related_credit WHERE until > ?`, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[string]bool)
+	for rows.Next() {
+		var item string
+		if err := rows.Scan(&item); err != nil {
+			return nil, err
+		}
+		items[item] = true
+	}
+	return items, nil
+}
+
+// Max number of words per query in distinctLemmas, to stay under SQLite's
+// limit on the number of variables.
+const maxVariables = 500
+
+// Adds lemma keys (lemma and part of speech) of words to keys.
+// Words without lemmas are left out.
+func lemmaKeys[T database.Querier](q T, words []string, keys map[string]string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(words)), ", ")
+	query := fmt.Sprintf(
+		`SELECT word, lemma, pos FROM word WHERE word IN (%s) AND lemma IS NOT NULL`,
+		placeholders,
+	)
+	args := make([]any, len(words))
+	for i, word := range words {
+		args[i] = word
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var word, lemma string
+		var pos *string
+		if err := rows.Scan(&word, &lemma, &pos); err != nil {
+			return err
+		}
+		key := lemma
+		if pos != nil {
+			key += "\x00" + *pos
+		}
+		keys[word] = key
+	}
+	return rows.Err()
+}
+
+// Keeps only one form of each lemma, so that related forms aren't introduced
+// in the same batch.
+// Preserves the order of words.
+func distinctLemmas[T database.Querier](q T, words []string) ([]string, error) {
+	if len(words) == 0 {
+		return words, nil
+	}
+
+	keys := make(map[string]string)
+	for start := 0; start < len(words); start += maxVariables {
+		end := start + maxVariables
+		if end > len(words) {
+			end = len(words)
+		}
+		if err := lemmaKeys(q, words[start:end], keys); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, word := range words {
+		if key, ok := keys[word]; ok {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		result = append(result, word)
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2022 Levi Gruspe
+// License: GNU AGPLv3 or later
+
+package word_scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	rs "github.com/lggruspe/polycloze/review_scheduler"
+	"github.com/lggruspe/polycloze/utils"
+)
+
+// Inserts forms of "hablar" and an unrelated word.
+func insertForms(t *testing.T, db *sql.DB) {
+	query := `
+		INSERT INTO word (word, frequency_class, lemma, pos) VALUES
+		('habla', 0, 'hablar', 'VERB'),
+		('hablo', 0, 'hablar', 'VERB'),
+		('hablamos', 0, 'hablar', 'VERB'),
+		('casa', 0, 'casa', 'NOUN')
+	`
+	if _, err := db.Exec(query); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+}
+
+func TestRelatedForms(t *testing.T) {
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	insertForms(t, db)
+
+	forms, err := RelatedForms(db, "habla")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(forms) != 2 || forms[0] != "hablo" || forms[1] != "hablamos" {
+		t.Fatal("expected hablo and hablamos to be related to habla:", forms)
+	}
+
+	forms, err = RelatedForms(db, "casa")
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(forms) != 0 {
+		t.Fatal("expected casa to have no related forms:", forms)
+	}
+}
+
+func TestGetWordsWithDistinctLemmas(t *testing.T) {
+	// New words should include at most one form of each lemma.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	insertForms(t, db)
+
+	words, err := GetWordsWith(db, 10, func(_ string) bool { return true })
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(words) != 2 || words[0] != "habla" || words[1] != "casa" {
+		t.Fatal("expected one form of hablar and casa:", words)
+	}
+}
+
+func TestDistinctLemmasManyWords(t *testing.T) {
+	// Long lists of words shouldn't exceed SQLite's limit on variables, and
+	// forms in different chunks should still be deduplicated.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	insertForms(t, db)
+
+	words := []string{"habla"}
+	for i := 0; i < 2*maxVariables; i++ {
+		words = append(words, fmt.Sprintf("word%v", i))
+	}
+	words = append(words, "hablo", "casa")
+
+	result, err := distinctLemmas(db, words)
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(result) != len(words)-1 || result[len(result)-1] != "casa" {
+		t.Fatal("expected hablo to be left out:", result[len(result)-2:])
+	}
+}
+
+func TestUpdateWordCreditsRelatedForms(t *testing.T) {
+	// Learned related forms shouldn't be scheduled right after a form gets
+	// answered correctly.
+	t.Parallel()
+
+	db := utils.TestingDatabase()
+	defer db.Close()
+	insertForms(t, db)
+
+	// Learn "hablo" two days ago, so that it's due now.
+	past := time.Now().UTC().Add(-48 * time.Hour)
+	if err := UpdateWordAt(db, "hablo", rs.Good, past); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	query := `UPDATE review SET reviewed = ? WHERE item = 'hablo'`
+	if _, err := db.Exec(query, past.Unix()); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	if err := UpdateWord(db, "habla", rs.Good); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+
+	words, err := GetWordsWith(db, 10, func(_ string) bool { return true })
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	for _, word := range words {
+		if word == "hablo" {
+			t.Fatal("expected hablo to not be scheduled for review:", words)
+		}
+	}
+
+	// Reviewing "hablo" itself should remove the credit.
+	if err := UpdateWord(db, "hablo", rs.Again); err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	words, err = GetWordsWith(db, 10, func(_ string) bool { return true })
+	if err != nil {
+		t.Fatal("expected err to be nil:", err)
+	}
+	if len(words) == 0 || words[0] != "hablo" {
+		t.Fatal("expected hablo to be scheduled for review:", words)
+	}
+}
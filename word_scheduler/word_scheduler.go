@@ -30,15 +30,45 @@ func GetWordsAt[T database.Querier](q T, n int, due time.Time) ([]string, error)
 
 // Returns up to words to make flashcards for.
 // Only includes words that satisfy the predicate.
+// Skips reviews of words that got partial credit from related forms, and
+// introduces at most one form of each lemma at a time.
 func GetWordsWith[T database.Querier](q T, n int, pred func(word string) bool) ([]string, error) {
-	reviews, err := rs.ScheduleReviewNowWith(q, n, pred)
+	credited, err := creditedItems(q, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	words, err := GetNewWordsWith(q, n-len(reviews), Placement(q), pred)
+	reviews, err := rs.ScheduleReviewNowWith(q, n, func(item string) bool {
+		return !credited[item] && pred(item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lemmas, err := HasLemmas(q)
+	if err != nil {
+		return nil, err
+	}
+	if !lemmas {
+		words, err := GetNewWordsWith(q, n-len(reviews), Placement(q), pred)
+		if err != nil {
+			return nil, err
+		}
+		return append(reviews, words...), nil
+	}
+
+	// Get extra words, because some of them will get filtered out.
+	m := n - len(reviews)
+	words, err := GetNewWordsWith(q, 2*m, Placement(q), pred)
 	if err != nil {
 		return nil, err
 	}
+	words, err = distinctLemmas(q, words)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > m {
+		words = words[:m]
+	}
 	return append(reviews, words...), nil
 }
 
@@ -60,23 +90,28 @@ func isNewWord[T database.Querier](q T, word string) bool {
 	return err != nil && errors.Is(err, sql.ErrNoRows)
 }
 
-func UpdateWord[T database.Querier](q T, word string, correct bool) error {
-	if isNewWord(q, word) {
-		class := frequencyClass(q, word)
-		if err := updateNewWordStat(q, class, correct); err != nil {
-			return err
-		}
-	}
-	return rs.UpdateReview(q, text.Casefold(word), correct)
+func UpdateWord[T database.Querier](q T, word string, grade rs.Grade) error {
+	return UpdateWordAt(q, word, grade, time.Now().UTC())
 }
 
 // See UpdateReviewAt.
-func UpdateWordAt[T database.Querier](q T, word string, correct bool, at time.Time) error {
+// Also gives partial credit to related forms (see updateRelatedCredit).
+func UpdateWordAt[T database.Querier](q T, word string, grade rs.Grade, at time.Time) error {
+	return UpdateWordWith(q, word, rs.Answer{Grade: grade}, at)
+}
+
+// Same as UpdateWordAt, but also records answer details in the review
+// history (see UpdateReviewWith).
+func UpdateWordWith[T database.Querier](q T, word string, answer rs.Answer, at time.Time) error {
 	if isNewWord(q, word) {
 		class := frequencyClass(q, word)
-		if err := updateNewWordStat(q, class, correct); err != nil {
+		if err := updateNewWordStat(q, class, answer.Correct()); err != nil {
 			return err
 		}
 	}
-	return rs.UpdateReviewAt(q, text.Casefold(word), correct, at)
+	word = text.Casefold(word)
+	if err := rs.UpdateReviewWith(q, word, answer, at); err != nil {
+		return err
+	}
+	return updateRelatedCredit(q, word, answer.Correct(), at)
 }
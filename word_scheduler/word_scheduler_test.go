@@ -52,7 +52,7 @@ func TestCase(t *testing.T) {
 	s := wordScheduler()
 	defer s.Close()
 
-	if err := UpdateWord(s, "Foo", false); err != nil {
+	if err := UpdateWord(s, "Foo", rs.Again); err != nil {
 		t.Fatal("expected err to be nil", err)
 	}
 